@@ -45,7 +45,7 @@ func generateAlertCSV(alerts []CSPMAlert, filename string) error {
 		}
 	}
 
-	fmt.Printf("Generated CSV file: %s with %d alerts\n", filename, len(alerts))
+	logger.Printf("Generated CSV file: %s with %d alerts\n", filename, len(alerts))
 	return nil
 }
 
@@ -84,6 +84,6 @@ func generateAWSAndGCPCSVs(alerts []CSPMAlert) (awsFile, gcpFile string, err err
 		gcpFile = gcpFilename
 	}
 
-	fmt.Printf("Generated CSV files - AWS: %d alerts, GCP: %d alerts\n", len(awsAlerts), len(gcpAlerts))
+	logger.Printf("Generated CSV files - AWS: %d alerts, GCP: %d alerts\n", len(awsAlerts), len(gcpAlerts))
 	return awsFile, gcpFile, nil
 }
@@ -0,0 +1,778 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/samber/do/v2"
+)
+
+// Exit codes of the command-line interface
+const (
+	exitOK      = 0
+	exitFailed  = 1 // the operation failed
+	exitUsage   = 2 // bad arguments or configuration
+	exitPartial = 3 // the operation completed, but only partly
+)
+
+// syncTargets are the operations `adam sync` accepts
+var syncTargets = []string{
+	OpContainerProfiles,
+	OpHostProfiles,
+	OpAppEmbeddedProfiles,
+	OpContainerPolicies,
+	OpHostPolicies,
+	OpAppEmbeddedPolicies,
+}
+
+const cliUsage = `Usage: adam [command] [flags]
+
+Commands:
+  serve                          Start the HTTP server, job workers and scheduler (default)
+  sync <target>                  Fetch and save from Prisma Cloud, target one of:
+                                   %s
+  verdict export [--file path]   Write the not-yet-reviewed entries to a CSV file
+  verdict send                   Email the not-yet-reviewed entries as CSV
+  verdict import <file.csv>      Update verdicts from a reviewed CSV and push
+                                 reviewed ones to Prisma Cloud (--no-push to skip)
+                                 Any invalid row refuses the file; --lenient
+                                 applies the valid rows and reports the rest
+  verdict import <file.csv> --dry-run
+                                 Show what the push would change and a token
+  verdict import --confirm <token>
+                                 Apply exactly that previewed change
+  verdict history --id <id> | --collection <name> [--value v]
+                                 Who changed which verdicts, when and from
+                                 which file, newest first
+  policy snapshots               List stored policy versions, newest first
+                                 (--kind to filter, --limit, default 50)
+  policy diff <from> [<to>]      Diff two versions by id, or "live" for the
+                                 policy in Prisma Cloud; to defaults to live
+  policy rollback <id> [--dry-run]
+                                 Put a stored version back into Prisma Cloud
+  drift show                     Show the entries new, disappeared or reappeared
+                                 in the latest profile sync (--kind, --sync id,
+                                 --collection)
+  drift send                     Email the newly learned entries awaiting a
+                                 verdict since the previous drift email
+  retention run [--dry-run]      Purge or archive stale profile entries under
+                                 RETENTION_UNSEEN_DAYS and RETENTION_ARCHIVE_ORPHANED
+  retention runs [--limit n]     List retention runs, newest first
+  retention show <id>            Show the entries a retention run removed
+  token issue <name> --scopes <list> [--expires 720h]
+                                 Issue an API token; scopes are sync, review,
+                                 push, report and admin. The token is shown once
+  token list                     List API tokens, without their secrets
+  token revoke <id>              Revoke an API token
+  report weekly [--dry-run]      Generate the weekly CSPM alert report; a dry run
+                                 keeps the CSV files instead of emailing them
+  help                           Show this help
+
+Flags for every command except serve:
+  --tenant <name>     Tenant to use, defaults to the first configured tenant
+  --output text|json  Result format on stdout; logs always go to stderr
+
+sync also accepts --allow-partial to save what was fetched before a failure.
+verdict accepts --kind %s; export, import and history
+default to container, send emails every kind unless one is given. import
+records --reviewer in the verdict history, defaulting to the logged-in user;
+with --confirm it is recorded as the approver of the previewed verdicts.
+
+Exit codes: 0 success, 1 failure, 2 usage or configuration error,
+3 completed partially (partial sync saved, or verdicts saved but not pushed)
+`
+
+func printUsage(w io.Writer) {
+	fmt.Fprintf(w, cliUsage, strings.Join(syncTargets, ", "), strings.Join(verdictKinds, "|"))
+}
+
+// runCLI runs the command in args, writes its result to stdout and returns
+// the process exit code
+func runCLI(args []string, stdout io.Writer) int {
+	if len(args) == 0 || args[0] == "serve" {
+		injector, err := startProgram()
+		if err != nil {
+			return startError(err)
+		}
+		defer do.MustInvoke[*sql.DB](injector).Close()
+
+		serve(injector)
+		return exitOK
+	}
+
+	switch args[0] {
+	case "sync":
+		return cmdSync(args[1:], stdout)
+	case "verdict":
+		return cmdVerdict(args[1:], stdout)
+	case "policy":
+		return cmdPolicy(args[1:], stdout)
+	case "drift":
+		return cmdDrift(args[1:], stdout)
+	case "retention":
+		return cmdRetention(args[1:], stdout)
+	case "token":
+		return cmdToken(args[1:], stdout)
+	case "report":
+		return cmdReport(args[1:], stdout)
+	case "help", "-h", "--help":
+		printUsage(stdout)
+		return exitOK
+	}
+
+	fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", args[0])
+	printUsage(os.Stderr)
+	return exitUsage
+}
+
+// cliCommand holds what every one-off command needs once its flags are parsed
+type cliCommand struct {
+	name    string
+	flags   *flag.FlagSet
+	tenant  string
+	output  string
+	service *Service
+	stdout  io.Writer
+	cleanup func()
+}
+
+func newCLICommand(name string, stdout io.Writer) *cliCommand {
+	cmd := &cliCommand{name: name, flags: flag.NewFlagSet(name, flag.ContinueOnError), stdout: stdout}
+	cmd.flags.StringVar(&cmd.tenant, "tenant", "", "tenant to use")
+	cmd.flags.StringVar(&cmd.output, "output", "text", "result format: text or json")
+	// usageError reports parse errors, so the flag package stays quiet
+	cmd.flags.SetOutput(io.Discard)
+	return cmd
+}
+
+// parse parses flags that may appear before or after positional arguments
+func (c *cliCommand) parse(args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := c.flags.Parse(args); err != nil {
+			return nil, err
+		}
+		args = c.flags.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if c.output != "text" && c.output != "json" {
+		return nil, fmt.Errorf("--output must be text or json, got %q", c.output)
+	}
+
+	return positional, nil
+}
+
+// start wires the services and resolves the tenant. Progress logs go to stderr,
+// so stdout only carries the result.
+func (c *cliCommand) start() error {
+	logger.SetOutput(os.Stderr)
+
+	injector, err := startProgram()
+	if err != nil {
+		return err
+	}
+
+	c.service = do.MustInvoke[*Service](injector)
+	c.cleanup = func() { do.MustInvoke[*sql.DB](injector).Close() }
+
+	c.tenant, err = c.service.ResolveTenant(c.tenant)
+	if err != nil {
+		c.cleanup()
+		return err
+	}
+	return nil
+}
+
+func (c *cliCommand) close() {
+	if c.cleanup != nil {
+		c.cleanup()
+	}
+}
+
+// result prints the outcome like the HTTP API would and returns the exit code
+func (c *cliCommand) result(message string, data any, err error, code int) int {
+	if err != nil {
+		message = fmt.Sprintf("%s: %v", message, err)
+		if code == exitOK {
+			code = exitFailed
+		}
+	}
+
+	if c.output == "json" {
+		out, marshalErr := json.MarshalIndent(Response{Message: message, Data: data}, "", "  ")
+		if marshalErr != nil {
+			fmt.Fprintf(os.Stderr, "Error: failed to marshal result: %v\n", marshalErr)
+			return exitFailed
+		}
+		fmt.Fprintln(c.stdout, string(out))
+		return code
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", message)
+	} else {
+		fmt.Fprintln(c.stdout, message)
+	}
+	if data != nil {
+		out, _ := json.MarshalIndent(data, "", "  ")
+		fmt.Fprintln(c.stdout, string(out))
+	}
+	return code
+}
+
+// usageError reports bad arguments or configuration; -h and --help show the usage instead
+func usageError(stdout io.Writer, err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		printUsage(stdout)
+		return exitOK
+	}
+
+	fmt.Fprintf(os.Stderr, "Error: %v\n\n", err)
+	printUsage(os.Stderr)
+	return exitUsage
+}
+
+// startError reports configuration or database errors found while starting up
+func startError(err error) int {
+	fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+	return exitUsage
+}
+
+// cliContext is cancelled on Ctrl-C or SIGTERM so an interrupted sync stops cleanly
+func cliContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+func cmdSync(args []string, stdout io.Writer) int {
+	cmd := newCLICommand("sync", stdout)
+	allowPartial := cmd.flags.Bool("allow-partial", false, "save what was fetched before a failure")
+
+	positional, err := cmd.parse(args)
+	if err != nil {
+		return usageError(stdout, err)
+	}
+	if len(positional) != 1 {
+		return usageError(stdout, fmt.Errorf("sync needs exactly one target: %s", strings.Join(syncTargets, ", ")))
+	}
+
+	target := positional[0]
+	valid := false
+	for _, t := range syncTargets {
+		valid = valid || t == target
+	}
+	if !valid {
+		return usageError(stdout, fmt.Errorf("unknown sync target %q, use one of: %s", target, strings.Join(syncTargets, ", ")))
+	}
+
+	if err := cmd.start(); err != nil {
+		return startError(err)
+	}
+	defer cmd.close()
+
+	fn, err := cmd.service.Operation(target, cmd.tenant, *allowPartial)
+	if err != nil {
+		return usageError(stdout, err)
+	}
+
+	ctx, cancel := cliContext()
+	defer cancel()
+
+	// The sync runs as a job, so it never overlaps one of the same tenant and
+	// target that the server or scheduler is running
+	var data any
+	job, err := cmd.service.Jobs.Run(ctx, cmd.tenant, target, func(ctx context.Context) (any, error) {
+		var fnErr error
+		data, fnErr = fn(ctx)
+		return data, fnErr
+	})
+	if errors.Is(err, errJobAlreadyActive) {
+		return cmd.result(fmt.Sprintf("sync %s", target), job, err, exitFailed)
+	}
+	if err == nil && job.Error != "" {
+		err = errors.New(job.Error)
+	}
+
+	code := exitOK
+	if result, ok := data.(SyncResult); ok && result.Partial {
+		code = exitPartial
+	}
+	return cmd.result(fmt.Sprintf("sync %s", target), data, err, code)
+}
+
+func cmdVerdict(args []string, stdout io.Writer) int {
+	if len(args) == 0 {
+		return usageError(stdout, fmt.Errorf("verdict needs a subcommand: export, send, import or history"))
+	}
+
+	cmd := newCLICommand("verdict "+args[0], stdout)
+	kindName := cmd.flags.String("kind", "", "profile kind: "+strings.Join(verdictKinds, ", "))
+	// resolveKind validates --kind once the flags are parsed
+	resolveKind := func() (string, error) { return ResolveVerdictKind(*kindName) }
+
+	switch args[0] {
+	case "export":
+		file := cmd.flags.String("file", "", "where to write the CSV, defaults to a timestamped file in the working directory")
+		if positional, err := cmd.parse(args[1:]); err != nil || len(positional) > 0 {
+			return usageError(stdout, errors.Join(err, unexpectedArgs(positional)))
+		}
+		kind, err := resolveKind()
+		if err != nil {
+			return usageError(stdout, err)
+		}
+		if err := cmd.start(); err != nil {
+			return startError(err)
+		}
+		defer cmd.close()
+
+		filename, err := cmd.service.Repo.ExportNotYetVerdict(cmd.tenant, kind, *file)
+		return cmd.result("verdict export", map[string]string{"tenant": cmd.tenant, "kind": kind, "file": filename}, err, exitOK)
+
+	case "send":
+		if positional, err := cmd.parse(args[1:]); err != nil || len(positional) > 0 {
+			return usageError(stdout, errors.Join(err, unexpectedArgs(positional)))
+		}
+		var kinds []string
+		if *kindName != "" {
+			kind, err := resolveKind()
+			if err != nil {
+				return usageError(stdout, err)
+			}
+			kinds = []string{kind}
+		}
+		if err := cmd.start(); err != nil {
+			return startError(err)
+		}
+		defer cmd.close()
+
+		err := cmd.service.SendVerdict(cmd.tenant, kinds...)
+		data := map[string]string{"tenant": cmd.tenant}
+		if kinds != nil {
+			data["kind"] = kinds[0]
+		}
+		return cmd.result("verdict send", data, err, exitOK)
+
+	case "import":
+		noPush := cmd.flags.Bool("no-push", false, "only update verdicts locally")
+		dryRun := cmd.flags.Bool("dry-run", false, "show the policy changes and a confirm token without saving anything")
+		confirm := cmd.flags.String("confirm", "", "apply a previous dry run by its token, no CSV file needed")
+		reviewer := cmd.flags.String("reviewer", currentUser(), "who reviewed the verdicts, for the verdict history")
+		lenient := cmd.flags.Bool("lenient", false, "apply the valid rows even when others are rejected")
+		positional, err := cmd.parse(args[1:])
+		if err != nil {
+			return usageError(stdout, err)
+		}
+
+		if *confirm != "" {
+			if len(positional) > 0 || *dryRun || *noPush || *lenient {
+				return usageError(stdout, fmt.Errorf("--confirm takes no CSV file, --dry-run, --no-push or --lenient"))
+			}
+			if err := cmd.start(); err != nil {
+				return startError(err)
+			}
+			defer cmd.close()
+
+			ctx, cancel := cliContext()
+			defer cancel()
+
+			result, err := cmd.service.ConfirmVerdicts(ctx, cmd.tenant, *confirm, *reviewer)
+			code := exitOK
+			if result.PCPushError != "" {
+				code = exitPartial
+			}
+			return cmd.result("verdict import", result, err, code)
+		}
+
+		if len(positional) != 1 {
+			return usageError(stdout, fmt.Errorf("verdict import needs exactly one CSV file"))
+		}
+		if *dryRun && *noPush {
+			return usageError(stdout, fmt.Errorf("--dry-run previews a push, it cannot be combined with --no-push"))
+		}
+		kind, err := resolveKind()
+		if err != nil {
+			return usageError(stdout, err)
+		}
+
+		data, err := os.ReadFile(positional[0])
+		if err != nil {
+			return usageError(stdout, err)
+		}
+
+		if err := cmd.start(); err != nil {
+			return startError(err)
+		}
+		defer cmd.close()
+
+		rows, err := parseCSVWithAutoDetect(bytes.NewReader(data))
+		if err != nil {
+			return cmd.result("verdict import", nil, fmt.Errorf("failed to process CSV: %v", err), exitFailed)
+		}
+		capabilities, validation, err := cmd.service.ValidateVerdicts(cmd.tenant, kind, rows, *lenient)
+		var invalid *VerdictValidationError
+		if errors.As(err, &invalid) {
+			return cmd.result("verdict import", invalid.Validation, err, exitFailed)
+		}
+		if err != nil {
+			return cmd.result("verdict import", nil, fmt.Errorf("failed to validate CSV: %v", err), exitFailed)
+		}
+		provenance := VerdictProvenance{Reviewer: *reviewer, Approver: *reviewer, Source: VerdictSourceCLI, FileHash: fileHash(data)}
+
+		// Rows a lenient import skipped make it partial
+		code := exitOK
+		if validation.Rejected > 0 {
+			code = exitPartial
+		}
+
+		ctx, cancel := cliContext()
+		defer cancel()
+
+		if *dryRun {
+			preview, err := cmd.service.PreviewVerdicts(ctx, cmd.tenant, kind, capabilities, provenance)
+			preview.Validation = &validation
+			return cmd.result("verdict import", preview, err, code)
+		}
+
+		result, err := cmd.service.ImportVerdicts(ctx, cmd.tenant, kind, capabilities, !*noPush, provenance)
+		result.Validation = &validation
+		if result.PCPushError != "" {
+			code = exitPartial
+		}
+		return cmd.result("verdict import", result, err, code)
+
+	case "history":
+		id := cmd.flags.Int64("id", 0, "entry id to show the changes of")
+		collection := cmd.flags.String("collection", "", "collection to show the changes of")
+		value := cmd.flags.String("value", "", "only changes of entries with this value, e.g. /usr/bin/curl")
+		limit := cmd.flags.Int("limit", 100, "how many changes to list")
+		if positional, err := cmd.parse(args[1:]); err != nil || len(positional) > 0 {
+			return usageError(stdout, errors.Join(err, unexpectedArgs(positional)))
+		}
+		if *id == 0 && *collection == "" {
+			return usageError(stdout, fmt.Errorf("verdict history needs --id or --collection"))
+		}
+		if *id < 0 || *limit < 1 {
+			return usageError(stdout, fmt.Errorf("--id and --limit must be positive"))
+		}
+		kind, err := resolveKind()
+		if err != nil {
+			return usageError(stdout, err)
+		}
+		if err := cmd.start(); err != nil {
+			return startError(err)
+		}
+		defer cmd.close()
+
+		filter := VerdictHistoryFilter{Kind: kind, EntryID: *id, Collection: *collection, Value: *value, Limit: *limit}
+		changes, err := cmd.service.VerdictHistory(cmd.tenant, filter)
+		return cmd.result("verdict history", changes, err, exitOK)
+	}
+
+	return usageError(stdout, fmt.Errorf("unknown verdict subcommand %q, use export, send, import or history", args[0]))
+}
+
+// currentUser names the logged-in user as the default reviewer of an import
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return "cli"
+}
+
+func cmdPolicy(args []string, stdout io.Writer) int {
+	if len(args) == 0 {
+		return usageError(stdout, fmt.Errorf("policy needs a subcommand: snapshots, diff or rollback"))
+	}
+
+	cmd := newCLICommand("policy "+args[0], stdout)
+
+	switch args[0] {
+	case "snapshots":
+		kind := cmd.flags.String("kind", "", "profile kind: "+strings.Join(verdictKinds, ", ")+", all when empty")
+		limit := cmd.flags.Int("limit", 50, "how many versions to list")
+		if positional, err := cmd.parse(args[1:]); err != nil || len(positional) > 0 {
+			return usageError(stdout, errors.Join(err, unexpectedArgs(positional)))
+		}
+		if *limit < 1 {
+			return usageError(stdout, fmt.Errorf("--limit must be at least 1"))
+		}
+		if err := cmd.start(); err != nil {
+			return startError(err)
+		}
+		defer cmd.close()
+
+		snapshots, err := cmd.service.ListSnapshots(cmd.tenant, *kind, *limit)
+		return cmd.result("policy snapshots", snapshots, err, exitOK)
+
+	case "diff":
+		positional, err := cmd.parse(args[1:])
+		if err != nil {
+			return usageError(stdout, err)
+		}
+		if len(positional) < 1 || len(positional) > 2 {
+			return usageError(stdout, fmt.Errorf("policy diff needs a snapshot id to diff from and optionally one to diff to"))
+		}
+		from, to := positional[0], "live"
+		if len(positional) == 2 {
+			to = positional[1]
+		}
+		if err := cmd.start(); err != nil {
+			return startError(err)
+		}
+		defer cmd.close()
+
+		ctx, cancel := cliContext()
+		defer cancel()
+
+		diff, err := cmd.service.DiffSnapshots(ctx, cmd.tenant, from, to)
+		return cmd.result("policy diff", diff, err, exitOK)
+
+	case "rollback":
+		dryRun := cmd.flags.Bool("dry-run", false, "only show what the rollback would change")
+		positional, err := cmd.parse(args[1:])
+		if err != nil {
+			return usageError(stdout, err)
+		}
+		if len(positional) != 1 {
+			return usageError(stdout, fmt.Errorf("policy rollback needs exactly one snapshot id"))
+		}
+		id, err := strconv.ParseInt(positional[0], 10, 64)
+		if err != nil {
+			return usageError(stdout, fmt.Errorf("invalid snapshot id %q", positional[0]))
+		}
+		if err := cmd.start(); err != nil {
+			return startError(err)
+		}
+		defer cmd.close()
+
+		ctx, cancel := cliContext()
+		defer cancel()
+
+		result, err := cmd.service.RollbackPolicy(ctx, cmd.tenant, id, *dryRun)
+		return cmd.result("policy rollback", result, err, exitOK)
+	}
+
+	return usageError(stdout, fmt.Errorf("unknown policy subcommand %q, use snapshots, diff or rollback", args[0]))
+}
+
+func cmdDrift(args []string, stdout io.Writer) int {
+	if len(args) == 0 {
+		return usageError(stdout, fmt.Errorf("drift needs a subcommand: show or send"))
+	}
+
+	cmd := newCLICommand("drift "+args[0], stdout)
+
+	switch args[0] {
+	case "show":
+		kindName := cmd.flags.String("kind", "", "profile kind: "+strings.Join(verdictKinds, ", "))
+		syncID := cmd.flags.Int64("sync", 0, "profile sync id, defaults to the latest one")
+		collection := cmd.flags.String("collection", "", "only show one collection")
+		if positional, err := cmd.parse(args[1:]); err != nil || len(positional) > 0 {
+			return usageError(stdout, errors.Join(err, unexpectedArgs(positional)))
+		}
+		kind, err := ResolveVerdictKind(*kindName)
+		if err != nil {
+			return usageError(stdout, err)
+		}
+		if *syncID < 0 {
+			return usageError(stdout, fmt.Errorf("--sync must be a profile sync id"))
+		}
+		if err := cmd.start(); err != nil {
+			return startError(err)
+		}
+		defer cmd.close()
+
+		report, err := cmd.service.GetDrift(cmd.tenant, kind, *syncID, *collection)
+		return cmd.result("drift show", report, err, exitOK)
+
+	case "send":
+		if positional, err := cmd.parse(args[1:]); err != nil || len(positional) > 0 {
+			return usageError(stdout, errors.Join(err, unexpectedArgs(positional)))
+		}
+		if err := cmd.start(); err != nil {
+			return startError(err)
+		}
+		defer cmd.close()
+
+		summary, err := cmd.service.SendDriftSummary(cmd.tenant)
+		return cmd.result("drift send", summary, err, exitOK)
+	}
+
+	return usageError(stdout, fmt.Errorf("unknown drift subcommand %q, use show or send", args[0]))
+}
+
+func cmdRetention(args []string, stdout io.Writer) int {
+	if len(args) == 0 {
+		return usageError(stdout, fmt.Errorf("retention needs a subcommand: run, runs or show"))
+	}
+
+	cmd := newCLICommand("retention "+args[0], stdout)
+
+	switch args[0] {
+	case "run":
+		dryRun := cmd.flags.Bool("dry-run", false, "only report the entries that would be removed")
+		if positional, err := cmd.parse(args[1:]); err != nil || len(positional) > 0 {
+			return usageError(stdout, errors.Join(err, unexpectedArgs(positional)))
+		}
+		if err := cmd.start(); err != nil {
+			return startError(err)
+		}
+		defer cmd.close()
+
+		report, err := cmd.service.ApplyRetention(cmd.tenant, *dryRun)
+		return cmd.result("retention run", report, err, exitOK)
+
+	case "runs":
+		limit := cmd.flags.Int("limit", 50, "how many runs to list")
+		if positional, err := cmd.parse(args[1:]); err != nil || len(positional) > 0 {
+			return usageError(stdout, errors.Join(err, unexpectedArgs(positional)))
+		}
+		if *limit < 1 {
+			return usageError(stdout, fmt.Errorf("--limit must be at least 1"))
+		}
+		if err := cmd.start(); err != nil {
+			return startError(err)
+		}
+		defer cmd.close()
+
+		runs, err := cmd.service.ListRetentionRuns(cmd.tenant, *limit)
+		return cmd.result("retention runs", runs, err, exitOK)
+
+	case "show":
+		positional, err := cmd.parse(args[1:])
+		if err != nil {
+			return usageError(stdout, err)
+		}
+		if len(positional) != 1 {
+			return usageError(stdout, fmt.Errorf("retention show needs exactly one run id"))
+		}
+		id, err := strconv.ParseInt(positional[0], 10, 64)
+		if err != nil {
+			return usageError(stdout, fmt.Errorf("invalid retention run id %q", positional[0]))
+		}
+		if err := cmd.start(); err != nil {
+			return startError(err)
+		}
+		defer cmd.close()
+
+		run, err := cmd.service.GetRetentionRun(cmd.tenant, id)
+		return cmd.result("retention show", run, err, exitOK)
+	}
+
+	return usageError(stdout, fmt.Errorf("unknown retention subcommand %q, use run, runs or show", args[0]))
+}
+
+func cmdToken(args []string, stdout io.Writer) int {
+	if len(args) == 0 {
+		return usageError(stdout, fmt.Errorf("token needs a subcommand: issue, list or revoke"))
+	}
+
+	cmd := newCLICommand("token "+args[0], stdout)
+
+	switch args[0] {
+	case "issue":
+		scopeList := cmd.flags.String("scopes", "", "comma-separated scopes: "+strings.Join(tokenScopes, ", "))
+		expires := cmd.flags.Duration("expires", 0, "how long the token is valid, forever when 0")
+		positional, err := cmd.parse(args[1:])
+		if err != nil {
+			return usageError(stdout, err)
+		}
+		if len(positional) != 1 {
+			return usageError(stdout, fmt.Errorf("token issue needs exactly one token name"))
+		}
+		scopes, err := parseScopes(*scopeList)
+		if err != nil {
+			return usageError(stdout, err)
+		}
+		if *expires < 0 {
+			return usageError(stdout, fmt.Errorf("--expires must not be negative"))
+		}
+		if err := cmd.start(); err != nil {
+			return startError(err)
+		}
+		defer cmd.close()
+
+		token, err := cmd.service.IssueToken(positional[0], scopes, *expires)
+		return cmd.result("token issue", token, err, exitOK)
+
+	case "list":
+		if positional, err := cmd.parse(args[1:]); err != nil || len(positional) > 0 {
+			return usageError(stdout, errors.Join(err, unexpectedArgs(positional)))
+		}
+		if err := cmd.start(); err != nil {
+			return startError(err)
+		}
+		defer cmd.close()
+
+		list, err := cmd.service.ListTokens()
+		return cmd.result("token list", list, err, exitOK)
+
+	case "revoke":
+		positional, err := cmd.parse(args[1:])
+		if err != nil {
+			return usageError(stdout, err)
+		}
+		if len(positional) != 1 {
+			return usageError(stdout, fmt.Errorf("token revoke needs exactly one token id"))
+		}
+		id, err := strconv.ParseInt(positional[0], 10, 64)
+		if err != nil {
+			return usageError(stdout, fmt.Errorf("invalid token id %q", positional[0]))
+		}
+		if err := cmd.start(); err != nil {
+			return startError(err)
+		}
+		defer cmd.close()
+
+		token, err := cmd.service.RevokeToken(id)
+		return cmd.result("token revoke", token, err, exitOK)
+	}
+
+	return usageError(stdout, fmt.Errorf("unknown token subcommand %q, use issue, list or revoke", args[0]))
+}
+
+func cmdReport(args []string, stdout io.Writer) int {
+	if len(args) == 0 || args[0] != "weekly" {
+		return usageError(stdout, fmt.Errorf("report needs a report name: weekly"))
+	}
+
+	cmd := newCLICommand("report weekly", stdout)
+	dryRun := cmd.flags.Bool("dry-run", false, "write the CSV files without emailing them")
+	if positional, err := cmd.parse(args[1:]); err != nil || len(positional) > 0 {
+		return usageError(stdout, errors.Join(err, unexpectedArgs(positional)))
+	}
+
+	if err := cmd.start(); err != nil {
+		return startError(err)
+	}
+	defer cmd.close()
+
+	ctx, cancel := cliContext()
+	defer cancel()
+
+	result, err := cmd.service.GenerateWeeklyAlertReport(ctx, cmd.tenant, *dryRun)
+	return cmd.result("report weekly", result, err, exitOK)
+}
+
+func unexpectedArgs(args []string) error {
+	if len(args) == 0 {
+		return nil
+	}
+	return fmt.Errorf("unexpected arguments: %s", strings.Join(args, " "))
+}
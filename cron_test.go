@@ -0,0 +1,101 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+		"@weekdays",
+	} {
+		if _, err := parseCron(expr, time.UTC); err == nil {
+			t.Errorf("parseCron(%q) accepted an invalid expression", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	at := func(value string) time.Time {
+		parsed, err := time.Parse("2006-01-02 15:04", value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return parsed
+	}
+
+	tests := []struct {
+		expr  string
+		after string
+		want  string // empty when nothing matches
+	}{
+		{"*/15 * * * *", "2026-10-17 10:07", "2026-10-17 10:15"},
+		{"*/15 * * * *", "2026-10-17 10:15", "2026-10-17 10:30"},
+		{"0 9 * * 1", "2026-10-17 10:00", "2026-10-19 09:00"},
+		{"0 9 * * mon", "2026-10-19 09:00", "2026-10-26 09:00"},
+		{"0 0 * * 7", "2026-10-17 10:00", "2026-10-18 00:00"},
+		{"@daily", "2026-12-31 23:59", "2027-01-01 00:00"},
+		{"@hourly", "2026-10-17 10:00", "2026-10-17 11:00"},
+		{"0 0 1 jan *", "2026-10-17 10:00", "2027-01-01 00:00"},
+		{"5,35 8-9 * * *", "2026-10-17 08:40", "2026-10-17 09:05"},
+		// Both day fields restricted: either one matches
+		{"30 2 1-7 * fri", "2026-10-17 10:00", "2026-10-23 02:30"},
+		{"30 2 1-7 * fri", "2026-10-30 10:00", "2026-11-01 02:30"},
+		{"0 0 29 2 *", "2026-03-01 00:00", "2028-02-29 00:00"},
+		{"0 0 30 2 *", "2026-10-17 10:00", ""},
+	}
+	for _, tt := range tests {
+		schedule, err := parseCron(tt.expr, time.UTC)
+		if err != nil {
+			t.Fatalf("parseCron(%q): %v", tt.expr, err)
+		}
+		got := schedule.Next(at(tt.after))
+		if tt.want == "" {
+			if !got.IsZero() {
+				t.Errorf("%q after %s = %s, want no match", tt.expr, tt.after, got)
+			}
+			continue
+		}
+		if want := at(tt.want); !got.Equal(want) {
+			t.Errorf("%q after %s = %s, want %s", tt.expr, tt.after, got, want)
+		}
+	}
+}
+
+func TestCronNextAcrossDST(t *testing.T) {
+	location, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("no time zone data:", err)
+	}
+
+	tests := []struct {
+		expr  string
+		after time.Time
+		want  time.Time
+	}{
+		// 02:30 does not exist on the day clocks spring forward
+		{"30 2 * * *", time.Date(2026, 3, 7, 12, 0, 0, 0, location), time.Date(2026, 3, 9, 2, 30, 0, 0, location)},
+		{"0 * * * *", time.Date(2026, 3, 8, 1, 30, 0, 0, location), time.Date(2026, 3, 8, 3, 0, 0, 0, location)},
+		{"0 9 * * *", time.Date(2026, 11, 1, 0, 30, 0, 0, location), time.Date(2026, 11, 1, 9, 0, 0, 0, location)},
+	}
+	for _, tt := range tests {
+		schedule, err := parseCron(tt.expr, location)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := schedule.Next(tt.after); !got.Equal(tt.want) {
+			t.Errorf("%q after %s = %s, want %s", tt.expr, tt.after, got, tt.want)
+		}
+	}
+}
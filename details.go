@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+var errProfileEntryNotFound = errors.New("profile entry not found")
+
+// ProfileDetail is one distinct observation behind a container profile entry:
+// the image, namespace and cluster of the profile it came from and, for
+// processes, the user, parent path, command line and MD5 it ran with
+type ProfileDetail struct {
+	Image       string     `json:"image,omitempty"`
+	Namespace   string     `json:"namespace,omitempty"`
+	Cluster     string     `json:"cluster,omitempty"`
+	User        string     `json:"user,omitempty"`
+	PPath       string     `json:"ppath,omitempty"`
+	Command     string     `json:"command,omitempty"`
+	MD5         string     `json:"md5,omitempty"`
+	Modified    bool       `json:"modified"`
+	Interactive bool       `json:"interactive"`
+	FirstSeen   *time.Time `json:"first_seen,omitempty"`
+	LastSeen    *time.Time `json:"last_seen,omitempty"`
+}
+
+// ProfileEntryDetails is a container profile entry with its observations
+type ProfileEntryDetails struct {
+	ID         int64           `json:"id"`
+	Collection string          `json:"collection"`
+	Key        string          `json:"key"`
+	Value      string          `json:"value"`
+	Verdict    string          `json:"verdict"`
+	Details    []ProfileDetail `json:"details"`
+}
+
+// detailHeader names the CSV columns detailColumns fills, after remarks
+var detailHeader = []string{"users", "parent_paths", "commands", "md5s", "modified", "interactive", "images", "namespaces", "clusters"}
+
+// detailColumns summarizes the observations of an entry for the verdict CSV.
+// Each column lists the distinct values, sorted and joined by " | ".
+// modified and interactive are true when any observation was.
+func detailColumns(details []ProfileDetail) []string {
+	var users, ppaths, commands, md5s, images, namespaces, clusters []string
+	modified, interactive := false, false
+	for _, d := range details {
+		users = append(users, d.User)
+		ppaths = append(ppaths, d.PPath)
+		commands = append(commands, d.Command)
+		md5s = append(md5s, d.MD5)
+		images = append(images, d.Image)
+		namespaces = append(namespaces, d.Namespace)
+		clusters = append(clusters, d.Cluster)
+		modified = modified || d.Modified
+		interactive = interactive || d.Interactive
+	}
+
+	flag := func(b bool) string {
+		if len(details) == 0 {
+			return ""
+		}
+		if b {
+			return "true"
+		}
+		return "false"
+	}
+
+	return []string{
+		joinDistinct(users),
+		joinDistinct(ppaths),
+		joinDistinct(commands),
+		joinDistinct(md5s),
+		flag(modified),
+		flag(interactive),
+		joinDistinct(images),
+		joinDistinct(namespaces),
+		joinDistinct(clusters),
+	}
+}
+
+// joinDistinct joins the distinct non-empty values, sorted. The separator
+// is neither a comma nor a semicolon, so it cannot tip the delimiter detection
+// of a re-imported export.
+func joinDistinct(values []string) string {
+	distinct := []string{}
+	for _, v := range values {
+		if v != "" && !slices.Contains(distinct, v) {
+			distinct = append(distinct, v)
+		}
+	}
+	slices.Sort(distinct)
+	return strings.Join(distinct, " | ")
+}
+
+// GetProfileDetails returns a container profile entry with the observations behind it
+func (s *Service) GetProfileDetails(tenant string, id int64) (ProfileEntryDetails, error) {
+	return s.Repo.GetProfileDetails(tenant, id)
+}
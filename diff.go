@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"slices"
+	"strings"
+)
+
+// PolicyDiff is what replacing a live runtime policy with another would
+// change, rule by rule. Rules are matched by name.
+type PolicyDiff struct {
+	RulesAdded   []string   `json:"rules_added,omitempty"`
+	RulesRemoved []string   `json:"rules_removed,omitempty"`
+	Rules        []RuleDiff `json:"rules,omitempty"`
+	// Shadowed names the live rule each added rule is placed ahead of
+	Shadowed []ShadowedRule `json:"shadowed,omitempty"`
+}
+
+// ShadowedRule is a rule added for a collection ahead of the live rule the
+// collection fell under, which no longer applies to it
+type ShadowedRule struct {
+	Rule       string `json:"rule"`
+	Collection string `json:"collection"`
+	Shadows    string `json:"shadows"`
+}
+
+// RuleDiff lists the changes of one rule. Added and Removed hold list entries
+// by field path, e.g. "processes.deniedList.paths"; Changed holds single
+// values such as effects.
+type RuleDiff struct {
+	Name    string              `json:"name"`
+	Added   map[string][]string `json:"added,omitempty"`
+	Removed map[string][]string `json:"removed,omitempty"`
+	Changed []FieldChange       `json:"changed,omitempty"`
+}
+
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// Empty reports whether the policies are the same
+func (d PolicyDiff) Empty() bool {
+	return len(d.RulesAdded) == 0 && len(d.RulesRemoved) == 0 && len(d.Rules) == 0
+}
+
+// diffIgnoredFields change on every save in Prisma Cloud and say nothing about enforcement
+var diffIgnoredFields = []string{"modified", "previousName"}
+
+// diffPolicies compares two runtime policies of the same kind
+func diffPolicies(live, proposed any) (PolicyDiff, error) {
+	var diff PolicyDiff
+
+	liveRules, err := policyRules(live)
+	if err != nil {
+		return diff, err
+	}
+	proposedRules, err := policyRules(proposed)
+	if err != nil {
+		return diff, err
+	}
+
+	for _, name := range ruleNames(liveRules) {
+		before := liveRules[name]
+		after, ok := proposedRules[name]
+		if !ok {
+			diff.RulesRemoved = append(diff.RulesRemoved, name)
+			continue
+		}
+		if rule := diffRule(name, before, after); rule != nil {
+			diff.Rules = append(diff.Rules, *rule)
+		}
+	}
+
+	for _, name := range ruleNames(proposedRules) {
+		if _, ok := liveRules[name]; ok {
+			continue
+		}
+		diff.RulesAdded = append(diff.RulesAdded, name)
+		if rule := diffRule(name, nil, proposedRules[name]); rule != nil {
+			diff.Rules = append(diff.Rules, *rule)
+		}
+	}
+
+	return diff, nil
+}
+
+// policyRules flattens the rules of a policy by name. When several rules share
+// a name only the first one counts, like in the Prisma Cloud console.
+func policyRules(policy any) (map[string]map[string]any, error) {
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return nil, err
+	}
+
+	var decoded struct {
+		Rules []map[string]any `json:"rules"`
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return nil, fmt.Errorf("failed to decode policy: %v", err)
+	}
+
+	rules := make(map[string]map[string]any)
+	for _, rule := range decoded.Rules {
+		name, _ := rule["name"].(string)
+		if _, ok := rules[name]; ok {
+			continue
+		}
+		fields := make(map[string]any)
+		flatten("", rule, fields)
+		rules[name] = fields
+	}
+	return rules, nil
+}
+
+func ruleNames(rules map[string]map[string]any) []string {
+	names := make([]string, 0, len(rules))
+	for name := range rules {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// flatten turns nested objects into dotted field paths. Lists become sorted
+// string sets, so entries can be compared regardless of their order.
+func flatten(path string, value any, out map[string]any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			if slices.Contains(diffIgnoredFields, key) {
+				continue
+			}
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			flatten(childPath, child, out)
+		}
+	case []any:
+		entries := make([]string, 0, len(v))
+		for _, entry := range v {
+			entries = append(entries, renderEntry(entry))
+		}
+		slices.Sort(entries)
+		out[path] = entries
+	case nil:
+		out[path] = nil
+	default:
+		out[path] = fmt.Sprint(v)
+	}
+}
+
+// renderEntry formats a list entry; port ranges read as 80 or 80-82 and
+// collections by their name
+func renderEntry(entry any) string {
+	if obj, ok := entry.(map[string]any); ok {
+		if _, ok := obj["namespaces"]; ok {
+			if name, ok := obj["name"].(string); ok {
+				return name
+			}
+		}
+		if start, ok := obj["start"].(float64); ok {
+			end, _ := obj["end"].(float64)
+			if end == 0 || end == start {
+				return fmt.Sprintf("%d", int(start))
+			}
+			return fmt.Sprintf("%d-%d", int(start), int(end))
+		}
+	}
+	if text, ok := entry.(string); ok {
+		return text
+	}
+	data, _ := json.Marshal(entry)
+	return string(data)
+}
+
+// diffRule compares the flattened fields of a rule, nil when nothing changed.
+// A missing or null list counts as an empty one.
+func diffRule(name string, before, after map[string]any) *RuleDiff {
+	paths := make(map[string]bool)
+	for path := range before {
+		paths[path] = true
+	}
+	for path := range after {
+		paths[path] = true
+	}
+
+	sorted := make([]string, 0, len(paths))
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	slices.Sort(sorted)
+
+	rule := RuleDiff{Name: name, Added: map[string][]string{}, Removed: map[string][]string{}}
+	for _, path := range sorted {
+		oldList, oldIsList := before[path].([]string)
+		newList, newIsList := after[path].([]string)
+
+		if oldIsList || newIsList {
+			for _, entry := range newList {
+				if !slices.Contains(oldList, entry) {
+					rule.Added[path] = append(rule.Added[path], entry)
+				}
+			}
+			for _, entry := range oldList {
+				if !slices.Contains(newList, entry) {
+					rule.Removed[path] = append(rule.Removed[path], entry)
+				}
+			}
+			continue
+		}
+
+		oldValue, _ := before[path].(string)
+		newValue, _ := after[path].(string)
+		if oldValue != newValue {
+			rule.Changed = append(rule.Changed, FieldChange{Field: path, From: oldValue, To: newValue})
+		}
+	}
+
+	if len(rule.Added) == 0 && len(rule.Removed) == 0 && len(rule.Changed) == 0 {
+		return nil
+	}
+	return &rule
+}
+
+var previewTemplate = template.Must(template.New("preview").Funcs(template.FuncMap{
+	"join": strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <title>Verdict preview - {{.Kind}} - {{.Tenant}}</title>
+</head>
+<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333; max-width: 960px; margin: 0 auto; padding: 20px;">
+    <h1 style="color: #2c3e50;">Verdict preview - {{.Kind}} runtime policy</h1>
+    <p>Tenant <b>{{.Tenant}}</b>: {{.Applied}} of {{.TotalRecords}} reviewed entries change a rule. Nothing has been saved or pushed yet.</p>
+    <p>To apply exactly this change, POST <code>/verdict/update?tenant={{.Tenant}}&amp;confirm={{.Token}}</code> before {{.ExpiresAt.Format "2006-01-02 15:04:05 MST"}}.</p>
+    {{with .Validation}}{{if .Rejected}}
+    <h2 style="color: #c62828;">Rejected rows</h2>
+    <p>{{.Rejected}} rows of the file are left out of this change.</p>
+    <table style="width: 100%; border-collapse: collapse;">
+        <tr style="background-color: #f8f9fa;"><th style="text-align: left; padding: 4px;">Line</th><th style="text-align: left; padding: 4px;">ID</th><th style="text-align: left; padding: 4px;">Reason</th></tr>
+        {{range .Rows}}{{if eq .Status "rejected"}}<tr><td style="padding: 4px;">{{.Line}}</td><td style="padding: 4px;">{{.ID}}</td><td style="padding: 4px; color: #c62828;">{{.Reason}}</td></tr>{{end}}{{end}}
+    </table>
+    {{end}}{{end}}
+    {{if .Diff.Empty}}<p>The live policy would not change.</p>{{end}}
+    {{with .Diff.RulesAdded}}<p style="color: #2e7d32;">Rules added: {{join . ", "}}</p>{{end}}
+    {{range .Diff.Shadowed}}<p>Rule <b>{{.Rule}}</b> is placed ahead of <b>{{.Shadows}}</b>, which no longer applies to collection {{.Collection}}; it starts as a copy of it.</p>{{end}}
+    {{with .Diff.RulesRemoved}}<p style="color: #c62828;">Rules dropped: {{join . ", "}}</p>{{end}}
+    {{range .Diff.Rules}}
+    <h2 style="color: #34495e;">{{.Name}}</h2>
+    <table style="width: 100%; border-collapse: collapse;">
+        <tr style="background-color: #f8f9fa;"><th style="text-align: left; padding: 4px;">Field</th><th style="text-align: left; padding: 4px;">Change</th></tr>
+        {{range $field, $entries := .Added}}<tr><td style="padding: 4px;">{{$field}}</td><td style="padding: 4px; color: #2e7d32;">+ {{join $entries ", "}}</td></tr>{{end}}
+        {{range $field, $entries := .Removed}}<tr><td style="padding: 4px;">{{$field}}</td><td style="padding: 4px; color: #c62828;">- {{join $entries ", "}}</td></tr>{{end}}
+        {{range .Changed}}<tr><td style="padding: 4px;">{{.Field}}</td><td style="padding: 4px;">{{.From}} &rarr; {{.To}}</td></tr>{{end}}
+    </table>
+    {{end}}
+</body>
+</html>
+`))
+
+// renderPreviewHTML writes a verdict preview as an HTML page
+func renderPreviewHTML(w io.Writer, preview VerdictPreview) error {
+	return previewTemplate.Execute(w, preview)
+}
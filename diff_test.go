@@ -0,0 +1,103 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffPolicies(t *testing.T) {
+	rule := func(name string, allowed ...string) ContainerRule {
+		r := newContainerRule(name)
+		r.Processes.AllowedList = allowed
+		return r
+	}
+	policy := func(rules ...ContainerRule) ContainerPolicy {
+		return ContainerPolicy{Rules: rules}
+	}
+
+	modified := rule("r1", "/bin/a")
+	modified.Modified = "2026-10-17T10:00:00Z"
+	effect := rule("r1", "/bin/a")
+	effect.Processes.DeniedList = DeniedList{Effect: "prevent", Paths: []string{"/bin/x"}}
+	ports := rule("r1", "/bin/a")
+	ports.Network.ListeningPorts.Allowed = []ContainerPortObject{{Start: 80, End: 82}, {Start: 443}}
+
+	tests := []struct {
+		name     string
+		live     ContainerPolicy
+		proposed ContainerPolicy
+		want     PolicyDiff
+	}{
+		{"same", policy(rule("r1", "/bin/a")), policy(rule("r1", "/bin/a")), PolicyDiff{}},
+		{"order of entries", policy(rule("r1", "/bin/a", "/bin/b")), policy(rule("r1", "/bin/b", "/bin/a")), PolicyDiff{}},
+		{"modified time ignored", policy(rule("r1", "/bin/a")), policy(modified), PolicyDiff{}},
+		{
+			"entries added and removed",
+			policy(rule("r1", "/bin/a", "/bin/b")),
+			policy(rule("r1", "/bin/b", "/bin/c")),
+			PolicyDiff{Rules: []RuleDiff{{
+				Name:    "r1",
+				Added:   map[string][]string{"processes.allowedList": {"/bin/c"}},
+				Removed: map[string][]string{"processes.allowedList": {"/bin/a"}},
+			}}},
+		},
+		{
+			"effect changed",
+			policy(rule("r1", "/bin/a")),
+			policy(effect),
+			PolicyDiff{Rules: []RuleDiff{{
+				Name:    "r1",
+				Added:   map[string][]string{"processes.deniedList.paths": {"/bin/x"}},
+				Removed: map[string][]string{},
+				Changed: []FieldChange{{Field: "processes.deniedList.effect", From: "", To: "prevent"}},
+			}}},
+		},
+		{
+			"port ranges",
+			policy(rule("r1", "/bin/a")),
+			policy(ports),
+			PolicyDiff{Rules: []RuleDiff{{
+				Name:    "r1",
+				Added:   map[string][]string{"network.listeningPorts.allowed": {"443", "80-82"}},
+				Removed: map[string][]string{},
+			}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := diffPolicies(tt.live, tt.proposed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffPolicies = %+v\nwant            %+v", got, tt.want)
+			}
+			if got.Empty() != reflect.DeepEqual(tt.want, PolicyDiff{}) {
+				t.Errorf("Empty = %v", got.Empty())
+			}
+		})
+	}
+}
+
+func TestDiffPoliciesAddedRule(t *testing.T) {
+	added := newContainerRule("r3")
+	added.Processes.AllowedList = []string{"/bin/a"}
+	live := ContainerPolicy{Rules: []ContainerRule{newContainerRule("r1"), newContainerRule("r2")}}
+	proposed := ContainerPolicy{Rules: []ContainerRule{added, newContainerRule("r1")}}
+
+	got, err := diffPolicies(live, proposed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.RulesAdded, []string{"r3"}) || !reflect.DeepEqual(got.RulesRemoved, []string{"r2"}) {
+		t.Errorf("added %q, removed %q", got.RulesAdded, got.RulesRemoved)
+	}
+	// An added rule lists every field it sets
+	if len(got.Rules) != 1 || got.Rules[0].Name != "r3" {
+		t.Fatalf("rules = %+v", got.Rules)
+	}
+	want := map[string][]string{"collections": {"r3"}, "processes.allowedList": {"/bin/a"}}
+	if !reflect.DeepEqual(got.Rules[0].Added, want) {
+		t.Errorf("added entries = %v, want %v", got.Rules[0].Added, want)
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// How a profile entry changed between two syncs
+const (
+	DriftNew         = "new"
+	DriftDisappeared = "disappeared"
+	DriftReappeared  = "reappeared"
+)
+
+var errProfileSyncNotFound = errors.New("profile sync not found")
+
+// ProfileSync is one run of a profile sync and how much it drifted from the
+// previous complete one
+type ProfileSync struct {
+	ID               int64      `json:"id"`
+	Tenant           string     `json:"tenant"`
+	Kind             string     `json:"kind"`
+	SyncedAt         time.Time  `json:"synced_at"`
+	PreviousSyncedAt *time.Time `json:"previous_synced_at,omitempty"`
+	Complete         bool       `json:"complete"`
+	New              int        `json:"new"`
+	Disappeared      int        `json:"disappeared"`
+	Reappeared       int        `json:"reappeared"`
+}
+
+// DriftEntry is a profile entry that changed in a sync, with its verdict now
+type DriftEntry struct {
+	Collection string     `json:"collection"`
+	Key        string     `json:"key"`
+	Value      string     `json:"value"`
+	Change     string     `json:"change"`
+	Verdict    string     `json:"verdict"`
+	FirstSeen  *time.Time `json:"first_seen,omitempty"`
+	LastSeen   *time.Time `json:"last_seen,omitempty"`
+}
+
+// CollectionDrift groups the drift of a sync by collection
+type CollectionDrift struct {
+	Collection  string       `json:"collection"`
+	New         []DriftEntry `json:"new,omitempty"`
+	Disappeared []DriftEntry `json:"disappeared,omitempty"`
+	Reappeared  []DriftEntry `json:"reappeared,omitempty"`
+}
+
+// DriftReport is the drift of one profile sync
+type DriftReport struct {
+	Sync        ProfileSync       `json:"sync"`
+	Collections []CollectionDrift `json:"collections"`
+}
+
+// groupDrift groups drift entries, sorted by collection, per collection
+func groupDrift(entries []DriftEntry) []CollectionDrift {
+	collections := []CollectionDrift{}
+	for _, entry := range entries {
+		if len(collections) == 0 || collections[len(collections)-1].Collection != entry.Collection {
+			collections = append(collections, CollectionDrift{Collection: entry.Collection})
+		}
+		c := &collections[len(collections)-1]
+		switch entry.Change {
+		case DriftNew:
+			c.New = append(c.New, entry)
+		case DriftDisappeared:
+			c.Disappeared = append(c.Disappeared, entry)
+		case DriftReappeared:
+			c.Reappeared = append(c.Reappeared, entry)
+		}
+	}
+	return collections
+}
+
+// recordDrift records a profile sync on its result. A partial sync cannot
+// tell which entries disappeared, so it only records new and reappeared ones.
+func (s *Service) recordDrift(result *SyncResult, kind string, seenAt time.Time) error {
+	sync, err := s.Repo.RecordProfileSync(result.Tenant, kind, seenAt, !result.Partial)
+	if err != nil {
+		return fmt.Errorf("failed to record %s profile drift: %v", kind, err)
+	}
+	result.Drift = &sync
+
+	logger.Printf("Profile drift for %s: %d new, %d disappeared, %d reappeared entries\n", kind, sync.New, sync.Disappeared, sync.Reappeared)
+	return nil
+}
+
+// GetDrift returns the drift of a profile sync of a kind, the latest one when
+// syncID is 0, for one collection or all when collection is empty
+func (s *Service) GetDrift(tenant, kind string, syncID int64, collection string) (DriftReport, error) {
+	var report DriftReport
+
+	sync, err := s.Repo.GetProfileSync(tenant, kind, syncID)
+	if err != nil {
+		return report, err
+	}
+	report.Sync = sync
+
+	entries, err := s.Repo.ListDrift(sync, collection)
+	if err != nil {
+		return report, fmt.Errorf("failed to list drift: %v", err)
+	}
+	report.Collections = groupDrift(entries)
+	return report, nil
+}
+
+// DriftSummary is what a drift summary email covered
+type DriftSummary struct {
+	Tenant  string `json:"tenant"`
+	Syncs   int    `json:"syncs"`
+	Entries int    `json:"entries"`
+	Sent    bool   `json:"sent"`
+}
+
+// SendDriftSummary emails the entries that were newly learned or reappeared in
+// the profile syncs since the previous summary and still await a verdict.
+// Nothing is sent when there are none, but the syncs still count as covered.
+func (s *Service) SendDriftSummary(tenant string) (DriftSummary, error) {
+	summary := DriftSummary{Tenant: tenant}
+
+	syncs, err := s.Repo.ListUnemailedSyncs(tenant)
+	if err != nil {
+		return summary, fmt.Errorf("failed to list profile syncs: %v", err)
+	}
+	summary.Syncs = len(syncs)
+
+	// Entries are grouped by kind, and within a kind by collection
+	pending := map[string][]DriftEntry{}
+	seen := map[string]bool{}
+	ids := make([]int64, 0, len(syncs))
+	for _, sync := range syncs {
+		ids = append(ids, sync.ID)
+		if sync.New+sync.Reappeared == 0 {
+			continue
+		}
+
+		entries, err := s.Repo.ListDrift(sync, "")
+		if err != nil {
+			return summary, fmt.Errorf("failed to list drift: %v", err)
+		}
+		for _, entry := range entries {
+			key := sync.Kind + "\x00" + entry.Collection + "\x00" + entry.Key + "\x00" + entry.Value
+			if entry.Change == DriftDisappeared || entry.Verdict != "not_yet" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			pending[sync.Kind] = append(pending[sync.Kind], entry)
+			summary.Entries++
+		}
+	}
+
+	if summary.Entries > 0 {
+		if err := sendDriftEmail(s.Cfg, tenant, pending); err != nil {
+			return summary, err
+		}
+		summary.Sent = true
+	} else {
+		logger.Printf("No newly learned profile entries awaiting a verdict for tenant %s\n", tenant)
+	}
+
+	if err := s.Repo.MarkSyncsEmailed(ids, time.Now().UTC()); err != nil {
+		return summary, fmt.Errorf("failed to mark profile syncs as emailed: %v", err)
+	}
+	return summary, nil
+}
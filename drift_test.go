@@ -0,0 +1,117 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecordProfileSync(t *testing.T) {
+	repo := newTestRepo(t)
+	start := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	// sync saves a container profile learning the given domains and records the sync
+	sync := func(hour int, complete bool, domains ...string) ProfileSync {
+		t.Helper()
+		seenAt := start.Add(time.Duration(hour) * time.Hour)
+		profile := ContainerProfile{Collections: []string{"All", "payments"}}
+		for _, domain := range domains {
+			profile.Network.Behavioral.DNSQueries = append(profile.Network.Behavioral.DNSQueries, DNSQuery{DomainName: domain})
+		}
+		if _, err := repo.SaveProfiles(defaultTenant, []ContainerProfile{profile}, seenAt); err != nil {
+			t.Fatal(err)
+		}
+		recorded, err := repo.RecordProfileSync(defaultTenant, KindContainer, seenAt, complete)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return recorded
+	}
+	// drift lists the changes of a sync as "change value"
+	drift := func(sync ProfileSync) []string {
+		t.Helper()
+		entries, err := repo.ListDrift(sync, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		changes := []string{}
+		for _, entry := range entries {
+			changes = append(changes, entry.Change+" "+entry.Value)
+		}
+		return changes
+	}
+
+	tests := []struct {
+		name     string
+		complete bool
+		domains  []string
+		want     []string
+		previous int // hour of the complete sync drift is measured against, -1 for none
+	}{
+		{
+			name: "first sync learns everything", complete: true, domains: []string{"a.com", "b.com", "c.com"},
+			want: []string{"new a.com", "new b.com", "new c.com"}, previous: -1,
+		},
+		{
+			name: "entries added and removed", complete: true, domains: []string{"a.com", "b.com", "d.com"},
+			want: []string{"disappeared c.com", "new d.com"}, previous: 0,
+		},
+		{
+			name: "removed entry reappears", complete: true, domains: []string{"a.com", "c.com"},
+			want: []string{"disappeared b.com", "disappeared d.com", "reappeared c.com"}, previous: 1,
+		},
+		{
+			name: "partial sync cannot tell what disappeared", complete: false, domains: []string{"a.com", "e.com"},
+			want: []string{"new e.com"}, previous: 2,
+		},
+		{
+			name: "drift is measured against the last complete sync", complete: true, domains: []string{"a.com", "b.com", "c.com", "d.com"},
+			want: []string{"disappeared e.com", "reappeared b.com", "reappeared d.com"}, previous: 2,
+		},
+		{
+			name: "the same entries again drift nothing", complete: true, domains: []string{"a.com", "b.com", "c.com", "d.com"},
+			want: []string{}, previous: 4,
+		},
+	}
+	for hour, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorded := sync(hour, tt.complete, tt.domains...)
+
+			if got := drift(recorded); !slices.Equal(got, tt.want) {
+				t.Errorf("drift = %q, want %q", got, tt.want)
+			}
+
+			counts := map[string]int{}
+			for _, change := range tt.want {
+				kind, _, _ := strings.Cut(change, " ")
+				counts[kind]++
+			}
+			if recorded.New != counts[DriftNew] || recorded.Disappeared != counts[DriftDisappeared] || recorded.Reappeared != counts[DriftReappeared] {
+				t.Errorf("counts = %d new, %d disappeared, %d reappeared, want %v", recorded.New, recorded.Disappeared, recorded.Reappeared, counts)
+			}
+
+			switch {
+			case tt.previous < 0 && recorded.PreviousSyncedAt != nil:
+				t.Errorf("previous sync = %v, want none", recorded.PreviousSyncedAt)
+			case tt.previous >= 0 && (recorded.PreviousSyncedAt == nil || !recorded.PreviousSyncedAt.Equal(start.Add(time.Duration(tt.previous)*time.Hour))):
+				t.Errorf("previous sync = %v, want hour %d", recorded.PreviousSyncedAt, tt.previous)
+			}
+
+			// The counts are stored with the sync
+			stored, err := repo.GetProfileSync(defaultTenant, KindContainer, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stored.ID != recorded.ID || stored.Complete != tt.complete || stored.New != recorded.New ||
+				stored.Disappeared != recorded.Disappeared || stored.Reappeared != recorded.Reappeared {
+				t.Errorf("stored sync = %+v, want %+v", stored, recorded)
+			}
+		})
+	}
+
+	// Another tenant has no syncs of its own
+	if _, err := repo.GetProfileSync("other", KindContainer, 0); err != errProfileSyncNotFound {
+		t.Errorf("sync of another tenant = %v, want errProfileSyncNotFound", err)
+	}
+}
@@ -8,7 +8,7 @@ import (
 	"gopkg.in/gomail.v2"
 )
 
-func sendEmailWithCSV(cfg Config, csvFilename string) error {
+func sendEmailWithCSV(cfg Config, tenant, kind, csvFilename string) error {
 	// Parse recipient emails
 	recipients := strings.Split(cfg.EmailTo, ",")
 	for i, email := range recipients {
@@ -21,19 +21,21 @@ func sendEmailWithCSV(cfg Config, csvFilename string) error {
 	m.SetHeader("To", recipients...)
 
 	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	m.SetHeader("Subject", fmt.Sprintf("Container Profiles Review - %s", timestamp))
+	title := strings.ToUpper(kind[:1]) + kind[1:]
+	m.SetHeader("Subject", fmt.Sprintf("%s Profiles Review - %s - %s", title, tenant, timestamp))
 
 	body := fmt.Sprintf(`Hello,
 
-Please find attached the container profiles that require review.
+Please find attached the %s profiles that require review.
 
 This CSV file contains all entries with verdict status "not_yet".
 
+Tenant: %s
 Timestamp: %s
 File: %s
 
 Best regards,
-Adam`, timestamp, csvFilename)
+Adam`, kind, tenant, timestamp, csvFilename)
 
 	m.SetBody("text/plain", body)
 	m.Attach(csvFilename)
@@ -45,12 +47,12 @@ Adam`, timestamp, csvFilename)
 		return fmt.Errorf("failed to send email: %v", err)
 	}
 
-	fmt.Printf("Email sent successfully to: %s\n", strings.Join(recipients, ", "))
+	logger.Printf("Email sent successfully to: %s\n", strings.Join(recipients, ", "))
 	return nil
 }
 
 // sendAlertEmailWithCSVs sends separate emails for AWS and GCP alerts
-func sendAlertEmailWithCSVs(cfg Config, awsCSV, gcpCSV, complianceStandard string, awsCount, gcpCount int) error {
+func sendAlertEmailWithCSVs(cfg Config, tenant, awsCSV, gcpCSV, complianceStandard string, awsCount, gcpCount int) error {
 	// Parse recipient emails from WeeklyReportTo
 	recipients := strings.Split(cfg.WeeklyReportTo, ",")
 	for i, email := range recipients {
@@ -66,7 +68,7 @@ func sendAlertEmailWithCSVs(cfg Config, awsCSV, gcpCSV, complianceStandard strin
 		m.SetHeader("To", recipients...)
 
 		timestamp := time.Now().Format("2006-01-02")
-		subject := fmt.Sprintf("Weekly CSPM Alert Report - AWS - %s - %s", complianceStandard, timestamp)
+		subject := fmt.Sprintf("Weekly CSPM Alert Report - AWS - %s - %s - %s", tenant, complianceStandard, timestamp)
 		m.SetHeader("Subject", subject)
 
 		// Generate HTML body for AWS
@@ -77,7 +79,7 @@ func sendAlertEmailWithCSVs(cfg Config, awsCSV, gcpCSV, complianceStandard strin
 		if err := d.DialAndSend(m); err != nil {
 			return fmt.Errorf("failed to send AWS email: %v", err)
 		}
-		fmt.Printf("AWS alert report email sent successfully to: %s\n", strings.Join(recipients, ", "))
+		logger.Printf("AWS alert report email sent successfully to: %s\n", strings.Join(recipients, ", "))
 	}
 
 	// Send GCP email if there are GCP alerts
@@ -87,7 +89,7 @@ func sendAlertEmailWithCSVs(cfg Config, awsCSV, gcpCSV, complianceStandard strin
 		m.SetHeader("To", recipients...)
 
 		timestamp := time.Now().Format("2006-01-02")
-		subject := fmt.Sprintf("Weekly CSPM Alert Report - GCP - %s - %s", complianceStandard, timestamp)
+		subject := fmt.Sprintf("Weekly CSPM Alert Report - GCP - %s - %s - %s", tenant, complianceStandard, timestamp)
 		m.SetHeader("Subject", subject)
 
 		// Generate HTML body for GCP
@@ -98,8 +100,32 @@ func sendAlertEmailWithCSVs(cfg Config, awsCSV, gcpCSV, complianceStandard strin
 		if err := d.DialAndSend(m); err != nil {
 			return fmt.Errorf("failed to send GCP email: %v", err)
 		}
-		fmt.Printf("GCP alert report email sent successfully to: %s\n", strings.Join(recipients, ", "))
+		logger.Printf("GCP alert report email sent successfully to: %s\n", strings.Join(recipients, ", "))
 	}
 
 	return nil
 }
+
+// sendDriftEmail sends the summary of newly learned profile entries to EMAIL_TO
+func sendDriftEmail(cfg Config, tenant string, pending map[string][]DriftEntry) error {
+	recipients := strings.Split(cfg.EmailTo, ",")
+	for i, email := range recipients {
+		recipients[i] = strings.TrimSpace(email)
+	}
+
+	m := gomail.NewMessage()
+	m.SetHeader("From", cfg.EmailFrom)
+	m.SetHeader("To", recipients...)
+
+	timestamp := time.Now().Format("2006-01-02 15:04:05")
+	m.SetHeader("Subject", fmt.Sprintf("Newly Learned Runtime Behavior - %s - %s", tenant, timestamp))
+	m.SetBody("text/html", generateDriftEmailBody(tenant, pending))
+
+	d := gomail.NewDialer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword)
+	if err := d.DialAndSend(m); err != nil {
+		return fmt.Errorf("failed to send email: %v", err)
+	}
+
+	logger.Printf("Drift email sent successfully to: %s\n", strings.Join(recipients, ", "))
+	return nil
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"html"
+	"strings"
 	"time"
 )
 
@@ -86,3 +88,69 @@ func generateAlertEmailBody(complianceStandard, cloudType string, alertCount int
 
 	return html
 }
+
+// generateDriftEmailBody lists newly learned profile entries by kind and collection.
+// Entries come from observed workloads, so every value is escaped.
+func generateDriftEmailBody(tenant string, pending map[string][]DriftEntry) string {
+	timestamp := time.Now().Format("2006-01-02 15:04:05")
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<!DOCTYPE html>
+<html>
+<head>
+    <meta charset="utf-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>Newly Learned Runtime Behavior - %s</title>
+</head>
+<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333; max-width: 800px; margin: 0 auto; padding: 20px;">
+    <div style="background-color: #f8f9fa; padding: 20px; border-radius: 8px;">
+        <h1 style="color: #2c3e50; margin-top: 0;">Newly Learned Runtime Behavior</h1>
+
+        <p style="color: #666;">Dear Team,</p>
+
+        <p>The latest profile syncs of tenant <strong>%s</strong> observed the entries below for the first time, or again after they had disappeared. They are awaiting a verdict.</p>
+`, html.EscapeString(tenant), html.EscapeString(tenant))
+
+	for _, kind := range verdictKinds {
+		entries := pending[kind]
+		if len(entries) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&b, `
+        <div style="background-color: #fff; padding: 15px; border-radius: 5px; margin: 20px 0;">
+            <h2 style="margin-top: 0; color: #34495e;">%s profiles (%d)</h2>
+            <table style="width: 100%%; border-collapse: collapse;">
+                <tr style="background-color: #f8f9fa;">
+                    <th style="text-align: left; padding: 6px;">Collection</th>
+                    <th style="text-align: left; padding: 6px;">Key</th>
+                    <th style="text-align: left; padding: 6px;">Value</th>
+                    <th style="text-align: left; padding: 6px;">Change</th>
+                </tr>
+`, html.EscapeString(kind), len(entries))
+		for _, entry := range entries {
+			fmt.Fprintf(&b, `                <tr>
+                    <td style="padding: 6px; border-bottom: 1px solid #eee;">%s</td>
+                    <td style="padding: 6px; border-bottom: 1px solid #eee;">%s</td>
+                    <td style="padding: 6px; border-bottom: 1px solid #eee;">%s</td>
+                    <td style="padding: 6px; border-bottom: 1px solid #eee;">%s</td>
+                </tr>
+`, html.EscapeString(entry.Collection), html.EscapeString(entry.Key), html.EscapeString(entry.Value), entry.Change)
+		}
+		b.WriteString(`            </table>
+        </div>
+`)
+	}
+
+	fmt.Fprintf(&b, `
+        <p>Export them with <code>adam verdict export --kind &lt;kind&gt;</code> or wait for the next verdict email to review them.</p>
+
+        <p style="color: #999; font-size: 12px; margin-top: 30px;">
+            Generated %s. This is an automated report generated by the Adam system. Please do not reply to this email.
+        </p>
+    </div>
+</body>
+</html>`, timestamp)
+
+	return b.String()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// Where a verdict change came from
+const (
+	VerdictSourceUpload = "csv-upload" // a CSV uploaded to /verdict/update
+	VerdictSourceCLI    = "cli"        // a CSV imported with adam verdict import
+	VerdictSourceReview = "review-ui"  // decisions made in the web review UI
+)
+
+// VerdictProvenance says who changed verdicts, from where and with which
+// file. The reviewer decided the verdicts and the approver applied them; they
+// differ when someone else confirms a preview.
+type VerdictProvenance struct {
+	Reviewer string `json:"reviewer"`
+	Approver string `json:"approver"`
+	Source   string `json:"source"`
+	// FileHash is the SHA-256 of the reviewed CSV file
+	FileHash string `json:"file_hash,omitempty"`
+}
+
+// fileHash returns the hex SHA-256 of an uploaded file
+func fileHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// VerdictChange is one change of the verdict or remarks of a profile entry
+type VerdictChange struct {
+	ID         int64     `json:"id"`
+	Kind       string    `json:"kind"`
+	EntryID    int64     `json:"entry_id"`
+	Collection string    `json:"collection"`
+	Key        string    `json:"key"`
+	Value      string    `json:"value"`
+	OldVerdict string    `json:"old_verdict"`
+	NewVerdict string    `json:"new_verdict"`
+	OldRemarks string    `json:"old_remarks,omitempty"`
+	NewRemarks string    `json:"new_remarks,omitempty"`
+	Reviewer   string    `json:"reviewer"`
+	Approver   string    `json:"approver"`
+	Source     string    `json:"source"`
+	FileHash   string    `json:"file_hash,omitempty"`
+	ChangedAt  time.Time `json:"changed_at"`
+}
+
+// VerdictHistoryFilter selects verdict changes of a kind: those of one entry,
+// or those of a collection, optionally narrowed to a value
+type VerdictHistoryFilter struct {
+	Kind       string
+	EntryID    int64
+	Collection string
+	Value      string
+	Limit      int
+}
+
+// VerdictHistory returns the matching verdict changes of a tenant, newest first
+func (s *Service) VerdictHistory(tenant string, filter VerdictHistoryFilter) ([]VerdictChange, error) {
+	if _, _, err := verdictTable(filter.Kind); err != nil {
+		return nil, err
+	}
+	return s.Repo.ListVerdictHistory(tenant, filter)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxRetryAfter caps a Retry-After header so a bogus value cannot stall a sync for hours
+const maxRetryAfter = 5 * time.Minute
+
+// newHTTPClient builds the http.Client shared by every Prisma Cloud call
+func newHTTPClient(cfg Config) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}).DialContext
+	transport.TLSHandshakeTimeout = 10 * time.Second
+	transport.ResponseHeaderTimeout = cfg.HTTPTimeout
+	transport.MaxIdleConnsPerHost = 10
+
+	return &http.Client{
+		Timeout:   cfg.HTTPTimeout,
+		Transport: transport,
+	}
+}
+
+// RetryClient sends Prisma Cloud requests through a rate limiter and retries
+// network errors, 429 and 5xx responses with exponential backoff, honoring
+// Retry-After when Prisma sends one
+type RetryClient struct {
+	HTTP       *http.Client
+	Limiter    *RateLimiter
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+func NewRetryClient(httpClient *http.Client, cfg Config) *RetryClient {
+	return &RetryClient{
+		HTTP:       httpClient,
+		Limiter:    NewRateLimiter(cfg.RateLimitPerMinute, cfg.RateLimitBurst),
+		MaxRetries: cfg.MaxRetries,
+		BaseDelay:  cfg.RetryBaseDelay,
+		MaxDelay:   cfg.RetryMaxDelay,
+	}
+}
+
+func (c *RetryClient) Do(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		if err := c.Limiter.Wait(req.Context()); err != nil {
+			return nil, err
+		}
+
+		res, err := c.HTTP.Do(req)
+		if attempt >= c.MaxRetries || !shouldRetry(req, res, err) {
+			return res, err
+		}
+
+		delay := c.backoff(attempt)
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+		} else {
+			if retryAfter, ok := parseRetryAfter(res.Header.Get("Retry-After"), time.Now()); ok && retryAfter > delay {
+				delay = retryAfter
+			}
+			reason = res.Status
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+
+		logger.Printf("Retrying %s %s in %s (attempt %d/%d): %s\n", req.Method, req.URL.Path, delay, attempt+1, c.MaxRetries, reason)
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// backoff returns BaseDelay * 2^attempt with up to 50% jitter, capped at MaxDelay
+func (c *RetryClient) backoff(attempt int) time.Duration {
+	delay := c.BaseDelay << attempt
+	if delay <= 0 || delay > c.MaxDelay {
+		delay = c.MaxDelay
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func shouldRetry(req *http.Request, res *http.Response, err error) bool {
+	if err != nil {
+		// Don't retry when the caller gave up
+		return req.Context().Err() == nil && !errors.Is(err, context.Canceled)
+	}
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	var delay time.Duration
+	if seconds, err := strconv.Atoi(value); err == nil {
+		delay = time.Duration(seconds) * time.Second
+	} else if at, err := http.ParseTime(value); err == nil {
+		delay = at.Sub(now)
+	} else {
+		return 0, false
+	}
+
+	if delay < 0 {
+		delay = 0
+	}
+	if delay > maxRetryAfter {
+		delay = maxRetryAfter
+	}
+	return delay, true
+}
+
+// RateLimiter is a token bucket that keeps adam below Prisma's per-minute limits.
+// A nil RateLimiter does not limit.
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter allows perMinute requests on average with bursts of up to burst requests.
+// It returns nil (no limit) when perMinute is not positive.
+func NewRateLimiter(perMinute, burst int) *RateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &RateLimiter{
+		rate:   float64(perMinute) / 60,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a request may be sent or ctx is done
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return nil
+	}
+
+	for {
+		l.mu.Lock()
+		now := time.Now()
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+		l.last = now
+
+		if l.tokens >= 1 {
+			l.tokens--
+			l.mu.Unlock()
+			return nil
+		}
+
+		wait := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+		l.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
@@ -3,8 +3,11 @@ package main
 import (
 	"database/sql"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/caarlos0/env"
 	"github.com/joho/godotenv"
@@ -47,24 +50,47 @@ func initDB() (*sql.DB, error) {
 	return db, nil
 }
 
-func startProgram() do.Injector {
+// startProgram loads the configuration, migrates the database and wires the services
+func startProgram() (do.Injector, error) {
 	err := godotenv.Load()
 
 	var cfg Config
 	err = env.Parse(&cfg)
 	if err != nil {
-		panic(fmt.Errorf("Failed to parse .env file: %+v", err))
+		return nil, fmt.Errorf("Failed to parse .env file: %+v", err)
+	}
+
+	tenants, err := loadTenants(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid configuration: %+v", err)
+	}
+
+	if cfg.HTTPTimeout <= 0 || cfg.MaxRetries < 0 || cfg.RetryBaseDelay <= 0 || cfg.RetryMaxDelay < cfg.RetryBaseDelay {
+		return nil, fmt.Errorf("Invalid configuration: PC_HTTP_TIMEOUT, PC_MAX_RETRIES, PC_RETRY_BASE_DELAY and PC_RETRY_MAX_DELAY must be positive, with PC_RETRY_MAX_DELAY >= PC_RETRY_BASE_DELAY")
+	}
+
+	if cfg.PageWorkers < 1 {
+		return nil, fmt.Errorf("Invalid configuration: PC_PAGE_WORKERS must be at least 1")
+	}
+
+	if cfg.JobWorkers < 1 || cfg.JobQueueSize < 1 {
+		return nil, fmt.Errorf("Invalid configuration: JOB_WORKERS and JOB_QUEUE_SIZE must be at least 1")
+	}
+
+	if cfg.VerdictDenyEffect != "" && !slices.Contains(denyEffects, cfg.VerdictDenyEffect) {
+		return nil, fmt.Errorf("Invalid configuration: VERDICT_DENY_EFFECT must be one of %s", strings.Join(denyEffects, ", "))
 	}
 
 	db, err := initDB()
 	if err != nil {
-		panic(fmt.Errorf("Failed to initialize database: %+v", err))
+		return nil, fmt.Errorf("Failed to initialize database: %+v", err)
 	}
 
 	injector := do.New()
 
 	// Provide config
 	do.ProvideValue(injector, cfg)
+	do.ProvideValue(injector, tenants)
 
 	// Provide database
 	do.ProvideValue(injector, db)
@@ -77,14 +103,49 @@ func startProgram() do.Injector {
 		return repo, nil
 	})
 
+	// Provide the background job runner
+	do.Provide(injector, func(i do.Injector) (*JobManager, error) {
+		cfg := do.MustInvoke[Config](i)
+		return NewJobManager(do.MustInvoke[*Repo](i), cfg.JobWorkers, cfg.JobQueueSize), nil
+	})
+
+	// Provide the HTTP client shared by all Prisma Cloud calls
+	do.Provide(injector, func(i do.Injector) (*http.Client, error) {
+		return newHTTPClient(do.MustInvoke[Config](i)), nil
+	})
+
+	// Provide one Prisma Cloud client per tenant, shared so tokens are cached across calls.
+	// Each tenant gets its own rate limiter since Prisma limits every console separately.
+	do.Provide(injector, func(i do.Injector) (map[string]*PCClient, error) {
+		cfg := do.MustInvoke[Config](i)
+		httpClient := do.MustInvoke[*http.Client](i)
+
+		clients := make(map[string]*PCClient)
+		for _, tenant := range do.MustInvoke[[]Tenant](i) {
+			transport := NewRetryClient(httpClient, cfg)
+			client := NewPCClient(tenant.BaseURL(), transport, tenant.AccessKeyId, tenant.SecretAccessKey)
+			client.PageWorkers = cfg.PageWorkers
+			clients[tenant.Name] = client
+		}
+		return clients, nil
+	})
+
 	// Provide Service
 	do.Provide(injector, func(i do.Injector) (*Service, error) {
 		service := &Service{
-			Repo: do.MustInvoke[*Repo](i),
-			Cfg:  do.MustInvoke[Config](i),
+			Repo:    do.MustInvoke[*Repo](i),
+			Cfg:     do.MustInvoke[Config](i),
+			Tenants: do.MustInvoke[[]Tenant](i),
+			Clients: do.MustInvoke[map[string]*PCClient](i),
+			Jobs:    do.MustInvoke[*JobManager](i),
 		}
 		return service, nil
 	})
 
-	return injector
+	// Provide the scheduler
+	do.Provide(injector, func(i do.Injector) (*Scheduler, error) {
+		return NewScheduler(do.MustInvoke[*Service](i), do.MustInvoke[Config](i))
+	})
+
+	return injector, nil
 }
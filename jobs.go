@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+var (
+	errJobNotFound      = errors.New("job not found")
+	errJobAlreadyActive = errors.New("a job of this type is already queued or running for the tenant")
+	errJobQueueFull     = errors.New("job queue is full")
+)
+
+// Job is a background operation and its progress, persisted in the jobs table
+type Job struct {
+	ID           string          `json:"id"`
+	Tenant       string          `json:"tenant"`
+	Type         string          `json:"type"`
+	Status       string          `json:"status"`
+	PagesFetched int64           `json:"pages_fetched"`
+	ItemsFetched int64           `json:"items_fetched"`
+	RowsSaved    int64           `json:"rows_saved"`
+	Result       json.RawMessage `json:"result,omitempty"`
+	Error        string          `json:"error,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+	StartedAt    *time.Time      `json:"started_at,omitempty"`
+	FinishedAt   *time.Time      `json:"finished_at,omitempty"`
+	DurationMs   int64           `json:"duration_ms,omitempty"`
+}
+
+// JobFunc does the work of a job. Its result is stored as JSON, also when it fails.
+type JobFunc func(ctx context.Context) (any, error)
+
+// JobProgress counts what a running job has done so far. It travels in the
+// job's context so the Prisma client and Service can report without knowing
+// about jobs; outside a job it is nil and every method is a no-op.
+type JobProgress struct {
+	PagesFetched atomic.Int64
+	ItemsFetched atomic.Int64
+	RowsSaved    atomic.Int64
+}
+
+type jobProgressKey struct{}
+
+func withJobProgress(ctx context.Context, progress *JobProgress) context.Context {
+	return context.WithValue(ctx, jobProgressKey{}, progress)
+}
+
+// jobProgress returns the progress counters of the job running in ctx, if any
+func jobProgress(ctx context.Context) *JobProgress {
+	progress, _ := ctx.Value(jobProgressKey{}).(*JobProgress)
+	return progress
+}
+
+func (p *JobProgress) AddPage(items int) {
+	if p == nil {
+		return
+	}
+	p.PagesFetched.Add(1)
+	p.ItemsFetched.Add(int64(items))
+}
+
+func (p *JobProgress) AddRows(rows int) {
+	if p == nil {
+		return
+	}
+	p.RowsSaved.Add(int64(rows))
+}
+
+type queuedJob struct {
+	job Job
+	fn  JobFunc
+}
+
+// JobManager runs jobs on a fixed pool of workers. Only one job per tenant and
+// type may be queued or running at a time, so a slow sync is never started twice.
+type JobManager struct {
+	Repo *Repo
+
+	queue    chan queuedJob
+	workers  int
+	mu       sync.Mutex
+	active   map[string]string // tenant/type -> job id
+	pending  map[string]Job    // reserved jobs whose row is still being written
+	progress map[string]*JobProgress
+	done     map[string]chan struct{} // closed when the job finishes
+}
+
+func NewJobManager(repo *Repo, workers, queueSize int) *JobManager {
+	return &JobManager{
+		Repo:     repo,
+		queue:    make(chan queuedJob, queueSize),
+		workers:  workers,
+		active:   make(map[string]string),
+		pending:  make(map[string]Job),
+		progress: make(map[string]*JobProgress),
+		done:     make(map[string]chan struct{}),
+	}
+}
+
+// Start marks jobs left over from a previous run as failed and starts the workers
+func (m *JobManager) Start() error {
+	interrupted, err := m.Repo.FailUnfinishedJobs("interrupted by a restart")
+	if err != nil {
+		return fmt.Errorf("failed to clean up unfinished jobs: %v", err)
+	}
+	if interrupted > 0 {
+		logger.Printf("Marked %d unfinished jobs from a previous run as failed\n", interrupted)
+	}
+
+	for i := 0; i < m.workers; i++ {
+		go m.work()
+	}
+	return nil
+}
+
+// Submit queues fn as a job. When a job of the same type is already queued or
+// running for the tenant, that job is returned with errJobAlreadyActive.
+func (m *JobManager) Submit(tenant, jobType string, fn JobFunc) (Job, error) {
+	job, err := m.reserve(tenant, jobType)
+	if err != nil {
+		return job, err
+	}
+
+	m.mu.Lock()
+	select {
+	case m.queue <- queuedJob{job: job, fn: fn}:
+		m.progress[job.ID] = &JobProgress{}
+		m.done[job.ID] = make(chan struct{})
+		m.mu.Unlock()
+		return job, nil
+	default:
+	}
+	delete(m.active, job.Tenant+"/"+job.Type)
+	m.mu.Unlock()
+
+	m.Repo.FinishJob(job.ID, JobFailed, nil, errJobQueueFull.Error(), 0, 0, 0, time.Now().UTC())
+	return Job{}, errJobQueueFull
+}
+
+// Run runs fn as a job in the calling goroutine, held to the same one job per
+// tenant and type as Submit. The command-line interface runs its syncs this
+// way, as it has no workers.
+func (m *JobManager) Run(ctx context.Context, tenant, jobType string, fn JobFunc) (Job, error) {
+	job, err := m.reserve(tenant, jobType)
+	if err != nil {
+		return job, err
+	}
+
+	m.mu.Lock()
+	m.progress[job.ID] = &JobProgress{}
+	m.done[job.ID] = make(chan struct{})
+	m.mu.Unlock()
+
+	m.run(ctx, queuedJob{job: job, fn: fn})
+	return m.Get(job.ID)
+}
+
+// reserve takes the tenant/type slot for a new job and writes its row. The slot
+// is reserved under the lock, but the row is written outside it, so submissions
+// never wait on each other's database writes. The database has the final say,
+// as another process sharing it may be running a job of the same type.
+func (m *JobManager) reserve(tenant, jobType string) (Job, error) {
+	id, err := newJobID()
+	if err != nil {
+		return Job{}, err
+	}
+
+	job := Job{
+		ID:        id,
+		Tenant:    tenant,
+		Type:      jobType,
+		Status:    JobQueued,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	key := tenant + "/" + jobType
+	m.mu.Lock()
+	if activeID, ok := m.active[key]; ok {
+		m.mu.Unlock()
+		return m.activeJob(activeID)
+	}
+	m.active[key] = id
+	m.pending[id] = job
+	m.mu.Unlock()
+
+	activeID, err := m.Repo.CreateJob(job)
+
+	m.mu.Lock()
+	delete(m.pending, id)
+	if err != nil || activeID != "" {
+		delete(m.active, key)
+	}
+	m.mu.Unlock()
+
+	if err != nil {
+		return Job{}, fmt.Errorf("failed to create job: %v", err)
+	}
+	if activeID != "" {
+		return m.activeJob(activeID)
+	}
+	return job, nil
+}
+
+// activeJob returns the job holding a tenant/type slot with errJobAlreadyActive
+func (m *JobManager) activeJob(id string) (Job, error) {
+	active, err := m.Get(id)
+	if err != nil {
+		return Job{}, err
+	}
+	return active, errJobAlreadyActive
+}
+
+// Wait blocks until a submitted job finishes or ctx is done and returns the job
+// as it stands then
+func (m *JobManager) Wait(ctx context.Context, id string) (Job, error) {
+	m.mu.Lock()
+	done, ok := m.done[id]
+	m.mu.Unlock()
+
+	if ok {
+		select {
+		case <-done:
+		case <-ctx.Done():
+			job, err := m.Get(id)
+			if err != nil {
+				return job, err
+			}
+			return job, ctx.Err()
+		}
+	}
+
+	return m.Get(id)
+}
+
+// Get returns a job with live progress counters while it is running
+func (m *JobManager) Get(id string) (Job, error) {
+	m.mu.Lock()
+	job, ok := m.pending[id]
+	m.mu.Unlock()
+	if ok {
+		return job, nil
+	}
+
+	job, err := m.Repo.GetJob(id)
+	if err != nil {
+		return job, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if progress, ok := m.progress[id]; ok {
+		job.PagesFetched = progress.PagesFetched.Load()
+		job.ItemsFetched = progress.ItemsFetched.Load()
+		job.RowsSaved = progress.RowsSaved.Load()
+		if job.StartedAt != nil {
+			job.DurationMs = time.Since(*job.StartedAt).Milliseconds()
+		}
+	}
+
+	return job, nil
+}
+
+// List returns the most recent jobs, optionally only those of one tenant
+func (m *JobManager) List(tenant string, limit int) ([]Job, error) {
+	jobs, err := m.Repo.ListJobs(tenant, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range jobs {
+		if progress, ok := m.progress[jobs[i].ID]; ok {
+			jobs[i].PagesFetched = progress.PagesFetched.Load()
+			jobs[i].ItemsFetched = progress.ItemsFetched.Load()
+			jobs[i].RowsSaved = progress.RowsSaved.Load()
+		}
+	}
+
+	return jobs, nil
+}
+
+func (m *JobManager) work() {
+	for queued := range m.queue {
+		m.run(context.Background(), queued)
+	}
+}
+
+func (m *JobManager) run(ctx context.Context, queued queuedJob) {
+	job := queued.job
+
+	m.mu.Lock()
+	progress := m.progress[job.ID]
+	m.mu.Unlock()
+
+	startedAt := time.Now().UTC()
+	if err := m.Repo.StartJob(job.ID, startedAt); err != nil {
+		logger.Printf("Warning: failed to mark job %s as running: %v\n", job.ID, err)
+	}
+	logger.Printf("Job %s (%s, tenant %s) started\n", job.ID, job.Type, job.Tenant)
+
+	result, err := runJobFunc(withJobProgress(ctx, progress), queued.fn)
+
+	status := JobSucceeded
+	errMsg := ""
+	if err != nil {
+		status = JobFailed
+		errMsg = err.Error()
+	}
+
+	var resultJSON []byte
+	if result != nil {
+		if data, marshalErr := json.Marshal(result); marshalErr == nil {
+			resultJSON = data
+		}
+	}
+
+	finishedAt := time.Now().UTC()
+	if err := m.Repo.FinishJob(job.ID, status, resultJSON, errMsg,
+		progress.PagesFetched.Load(), progress.ItemsFetched.Load(), progress.RowsSaved.Load(), finishedAt); err != nil {
+		logger.Printf("Warning: failed to record result of job %s: %v\n", job.ID, err)
+	}
+	logger.Printf("Job %s (%s, tenant %s) %s in %s\n", job.ID, job.Type, job.Tenant, status, finishedAt.Sub(startedAt).Round(time.Millisecond))
+
+	m.mu.Lock()
+	delete(m.active, job.Tenant+"/"+job.Type)
+	delete(m.progress, job.ID)
+	close(m.done[job.ID])
+	delete(m.done, job.ID)
+	m.mu.Unlock()
+}
+
+// runJobFunc turns a panic in a job into a failure instead of killing the worker
+func runJobFunc(ctx context.Context, fn JobFunc) (result any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("job panicked: %v", r)
+		}
+	}()
+	return fn(ctx)
+}
+
+func newJobID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
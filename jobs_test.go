@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestJobManager(t *testing.T) *JobManager {
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "adam.db"))
+	db, err := initDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	jobs := NewJobManager(&Repo{DB: db}, 2, 4)
+	if err := jobs.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return jobs
+}
+
+func TestJobManagerWait(t *testing.T) {
+	jobs := newTestJobManager(t)
+
+	release := make(chan struct{})
+	job, err := jobs.Submit("default", OpContainerProfiles, func(ctx context.Context) (any, error) {
+		<-release
+		return map[string]string{"tenant": "default"}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A second sync of the same tenant and type, also one started by a GET, is refused
+	active, err := jobs.Submit("default", OpContainerProfiles, func(ctx context.Context) (any, error) { return nil, nil })
+	if !errors.Is(err, errJobAlreadyActive) || active.ID != job.ID {
+		t.Fatalf("second Submit = %s, %v, want job %s with errJobAlreadyActive", active.ID, err, job.ID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := jobs.Wait(ctx, job.ID); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait on a running job = %v, want the context's error", err)
+	}
+
+	close(release)
+	done, err := jobs.Wait(context.Background(), job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done.Status != JobSucceeded || string(done.Result) != `{"tenant":"default"}` {
+		t.Errorf("job = %s with %s, want succeeded", done.Status, done.Result)
+	}
+
+	// Waiting on a finished job returns it straight away
+	if again, err := jobs.Wait(context.Background(), job.ID); err != nil || again.Status != JobSucceeded {
+		t.Errorf("Wait on a finished job = %s, %v", again.Status, err)
+	}
+}
+
+func TestJobManagerSubmitReservesSlot(t *testing.T) {
+	jobs := newTestJobManager(t)
+
+	// A job whose row is still being written already holds its slot
+	reserved := Job{ID: "reserved", Tenant: "default", Type: OpHostProfiles, Status: JobQueued}
+	jobs.mu.Lock()
+	jobs.active["default/"+OpHostProfiles] = reserved.ID
+	jobs.pending[reserved.ID] = reserved
+	jobs.mu.Unlock()
+
+	active, err := jobs.Submit("default", OpHostProfiles, func(ctx context.Context) (any, error) { return nil, nil })
+	if !errors.Is(err, errJobAlreadyActive) || active.ID != reserved.ID {
+		t.Errorf("Submit = %+v, %v, want the reserved job with errJobAlreadyActive", active, err)
+	}
+
+	// A failed insert gives the slot back
+	if _, err := jobs.Repo.DB.Exec(`ALTER TABLE jobs RENAME TO jobs_hidden`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := jobs.Submit("default", OpContainerPolicies, func(ctx context.Context) (any, error) { return nil, nil }); err == nil {
+		t.Fatal("Submit succeeded without a jobs table")
+	}
+	if _, err := jobs.Repo.DB.Exec(`ALTER TABLE jobs_hidden RENAME TO jobs`); err != nil {
+		t.Fatal(err)
+	}
+	job, err := jobs.Submit("default", OpContainerPolicies, func(ctx context.Context) (any, error) { return nil, nil })
+	if err != nil {
+		t.Fatalf("Submit after a failed insert = %v, want the slot released", err)
+	}
+	if _, err := jobs.Wait(context.Background(), job.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJobManagerRunSharesGuardAcrossProcesses(t *testing.T) {
+	server := newTestJobManager(t)
+	// The command-line interface has its own JobManager on the same database
+	cli := NewJobManager(server.Repo, 0, 0)
+
+	release := make(chan struct{})
+	job, err := server.Submit("default", OpHostPolicies, func(ctx context.Context) (any, error) {
+		<-release
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	active, err := cli.Run(context.Background(), "default", OpHostPolicies, func(ctx context.Context) (any, error) {
+		t.Error("ran a sync while the server is running one")
+		return nil, nil
+	})
+	if !errors.Is(err, errJobAlreadyActive) || active.ID != job.ID {
+		t.Fatalf("Run = %s, %v, want job %s with errJobAlreadyActive", active.ID, err, job.ID)
+	}
+
+	close(release)
+	if _, err := server.Wait(context.Background(), job.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	done, err := cli.Run(context.Background(), "default", OpHostPolicies, func(ctx context.Context) (any, error) {
+		return nil, errors.New("console unreachable")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done.Status != JobFailed || done.Error != "console unreachable" {
+		t.Errorf("job = %s with %q, want failed with the sync's error", done.Status, done.Error)
+	}
+
+	// Run held the slot only while it ran, in this process and in the database
+	if _, err := server.Submit("default", OpHostPolicies, func(ctx context.Context) (any, error) { return nil, nil }); err != nil {
+		t.Errorf("Submit after Run = %v", err)
+	}
+}
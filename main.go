@@ -1,31 +1,45 @@
 package main
 
 import (
-	"database/sql"
 	"fmt"
+	"log"
 	"net/http"
+	"os"
 
 	"github.com/samber/do/v2"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
-const BASE_URL = "https://asia-southeast2.cloud.twistlock.com/indonesia-751472959/api/v34.03"
+// logger carries the progress logs of adam. The server writes them to stdout;
+// the command-line interface sends them to stderr, so stdout holds only results
+var logger = log.New(os.Stdout, "", 0)
 
 func main() {
-	injector := startProgram()
-	defer func() {
-		// Cleanup database connection
-		db := do.MustInvoke[*sql.DB](injector)
-		db.Close()
-	}()
+	os.Exit(runCLI(os.Args[1:], os.Stdout))
+}
 
+// serve starts the job workers, the scheduler and the HTTP server
+func serve(injector do.Injector) {
 	service := do.MustInvoke[*Service](injector)
 
+	if err := service.Jobs.Start(); err != nil {
+		panic(fmt.Errorf("Failed to start job workers: %v", err))
+	}
+
+	scheduler, err := do.Invoke[*Scheduler](injector)
+	if err != nil {
+		panic(fmt.Errorf("Invalid schedule configuration: %v", err))
+	}
+	if err := scheduler.Start(); err != nil {
+		panic(fmt.Errorf("Failed to start scheduler: %v", err))
+	}
+
 	mux := http.NewServeMux()
 
 	// container endpoints
 	mux.HandleFunc("/profile/container", fetchProfile(service))
+	mux.HandleFunc("/profile/container/{id}/details", getProfileDetails(service))
 	mux.HandleFunc("/policy/container", fetchPolicies(service))
 
 	// host endpoints
@@ -36,12 +50,43 @@ func main() {
 	mux.HandleFunc("/profile/app-embedded", fetchAppEmbeddedProfile(service))
 	mux.HandleFunc("/policy/app-embedded", fetchAppEmbeddedPolicies(service))
 
+	mux.HandleFunc("/profile/drift", getDrift(service))
+	mux.HandleFunc("/profile/drift/send", sendDrift(service))
+	mux.HandleFunc("/profile/retention", applyRetention(service))
+	mux.HandleFunc("/profile/retention/runs", listRetentionRuns(service))
+	mux.HandleFunc("/profile/retention/runs/{id}", getRetentionRun(service))
+
+	// stored data query endpoints
+	mux.HandleFunc("/profile/entries", queryProfiles(service))
+	mux.HandleFunc("/profile/counts", countProfiles(service))
+	mux.HandleFunc("/policy/collections", queryPolicies(service))
+
 	mux.HandleFunc("/verdict/send", sendVerdict(service))
 	mux.HandleFunc("/verdict/update", updateVerdict(service))
+	mux.HandleFunc("/verdict/history", verdictHistory(service))
+	mux.HandleFunc("/verdict/review", reviewVerdicts(service))
+
+	// web review UI
+	mux.Handle("/review/", reviewUI())
+
+	// policy snapshot endpoints
+	mux.HandleFunc("/policy/snapshots", listSnapshots(service))
+	mux.HandleFunc("/policy/snapshots/diff", diffSnapshots(service))
+	mux.HandleFunc("/policy/snapshots/{id}", getSnapshot(service))
+	mux.HandleFunc("/policy/snapshots/{id}/rollback", rollbackPolicy(service))
 
 	// CSPM alert endpoints
 	mux.HandleFunc("/alerts/weekly", weeklyAlertReport(service))
 
+	// API token endpoints
+	mux.HandleFunc("/tokens", tokens(service))
+	mux.HandleFunc("/tokens/{id}/revoke", revokeToken(service))
+
+	// job endpoints
+	mux.HandleFunc("/jobs", listJobs(service))
+	mux.HandleFunc("/jobs/{id}", getJob(service))
+	mux.HandleFunc("/schedules", listSchedules(service, scheduler))
+
 	// Health check endpoint
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -51,15 +96,43 @@ func main() {
 	fmt.Println("Server starting on :8080")
 	fmt.Println("Endpoints:")
 	fmt.Println("  GET  /profile/container - Fetch and save container profiles")
+	fmt.Println("  GET  /profile/container/{id}/details - Images, namespaces, clusters and process context behind an entry")
 	fmt.Println("  GET  /profile/host - Fetch and save runtime host profiles")
 	fmt.Println("  GET  /profile/app-embedded - Fetch and save app-embedded profiles")
 	fmt.Println("  GET  /policy/container - Fetch and save runtime container policies")
 	fmt.Println("  GET  /policy/host - Fetch and save runtime host policies")
 	fmt.Println("  GET  /policy/app-embedded - Fetch and save app-embedded policies")
-	fmt.Println("  GET  /verdict/send - Send verdict email with CSV")
-	fmt.Println("  POST /verdict/update - Update verdicts from CSV file")
+	fmt.Println("  GET  /profile/drift - New, disappeared and reappeared entries of a profile sync (?kind=, ?sync_id=, ?collection=)")
+	fmt.Println("  GET  /profile/drift/send - Email newly learned entries awaiting a verdict")
+	fmt.Println("  GET  /profile/retention - Dry run of the retention policy: entries that would be purged or archived")
+	fmt.Println("  POST /profile/retention - Remove them as a background job")
+	fmt.Println("  GET  /profile/retention/runs - Retention runs, newest first (?limit=)")
+	fmt.Println("  GET  /profile/retention/runs/{id} - A retention run with the entries it removed")
+	fmt.Println("  GET  /profile/entries - Stored profile entries (?kind=, ?collection=, ?key=, ?verdict=, ?value=, ?first_seen_after=, ?last_seen_before=, ...)")
+	fmt.Println("  GET  /profile/counts - Stored entries per collection and verdict (?kind=, ?collection=)")
+	fmt.Println("  GET  /policy/collections - Stored policy rules per collection (?kind=, ?collection=)")
+	fmt.Println("  GET  /verdict/send - Send verdict email with CSV (?kind=container|host|app-embedded, default all)")
+	fmt.Println("  POST /verdict/update - Update verdicts from CSV file (?kind=container|host|app-embedded, default container)")
+	fmt.Println("  GET  /verdict/history - Verdict changes with reviewer, approver, source and file hash (?kind=, ?id= or ?collection=, ?value=, ?limit=)")
+	fmt.Println("  POST /verdict/review - Preview verdicts given by entry id as JSON, confirm with /verdict/update?confirm=")
+	fmt.Println("  GET  /review/ - Web UI to review entries awaiting a verdict, preview the policy diff and push")
+	fmt.Println("  GET  /policy/snapshots - Stored policy versions (?kind=, ?limit=)")
+	fmt.Println("  GET  /policy/snapshots/{id} - A policy version with its policy")
+	fmt.Println("  GET  /policy/snapshots/diff - Diff two versions (?from=<id|live>&to=<id|live>, to defaults to live)")
+	fmt.Println("  POST /policy/snapshots/{id}/rollback - Put a version back into Prisma Cloud (?dry_run=true to only diff)")
 	fmt.Println("  GET  /alerts/weekly - Generate and send weekly CSPM alert report")
+	fmt.Println("  GET  /tokens - API tokens; POST issues one (?name=, ?scopes=sync,review,push,report,admin, ?expires_in=)")
+	fmt.Println("  POST /tokens/{id}/revoke - Revoke an API token")
+	fmt.Println("  GET  /jobs - List recent jobs (?tenant=, ?limit=)")
+	fmt.Println("  GET  /jobs/{id} - Job status, progress and result")
+	fmt.Println("  GET  /schedules - Configured schedules with last and next run")
 	fmt.Println("  GET  /health - Health check")
+	fmt.Println("Profile, policy, /verdict/send, /profile/drift/send and /alerts/weekly run as a background job; GET waits for it, POST answers 202 with the job")
+	fmt.Println("All Prisma Cloud endpoints accept ?tenant=<name>, defaulting to the first configured tenant")
+	fmt.Println("/verdict/update reports every CSV row as accepted, unchanged or rejected; any rejected row refuses the file unless ?lenient=true")
+	fmt.Println("/verdict/update?dry_run=true previews the policy diff (HTML with ?format=html) and returns a token; POST ?confirm=<token> applies it")
+	fmt.Println("/profile/entries, /profile/counts and /policy/collections return pages of ?limit= (default 100); pass next_cursor back as ?cursor=")
+	fmt.Println("Profile endpoints refuse to save a partial fetch unless ?allow_partial=true")
 
 	if err := http.ListenAndServe(":8080", mux); err != nil {
 		panic(fmt.Errorf("Failed to start server: %v", err))
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// runtimeRule is a rule of a container, host or app-embedded runtime policy
+type runtimeRule interface {
+	ContainerRule | HostRule | AppEmbeddedRule
+}
+
+// ruleIdentity is what a merge needs to know of a rule: its name, when it
+// was last saved in Prisma Cloud and the collections it applies to
+type ruleIdentity struct {
+	Name        string
+	Modified    string
+	Collections []Collection
+}
+
+func identify[R runtimeRule](rule R) ruleIdentity {
+	switch r := any(rule).(type) {
+	case ContainerRule:
+		return ruleIdentity{r.Name, r.Modified, r.Collections}
+	case HostRule:
+		return ruleIdentity{r.Name, r.Modified, r.Collections}
+	case AppEmbeddedRule:
+		return ruleIdentity{r.Name, r.Modified, r.Collections}
+	}
+	return ruleIdentity{}
+}
+
+// RuleConflict is a rule changed in the Prisma Cloud console since the last
+// policy sync that a verdict push would have to touch
+type RuleConflict struct {
+	Rule           string `json:"rule"`
+	Collection     string `json:"collection"`
+	Reason         string `json:"reason"`
+	SyncedModified string `json:"synced_modified,omitempty"`
+	LiveModified   string `json:"live_modified,omitempty"`
+}
+
+// PolicyConflictError aborts a verdict push whose rules changed underneath it
+type PolicyConflictError struct {
+	Kind      string
+	Conflicts []RuleConflict
+}
+
+func (e *PolicyConflictError) Error() string {
+	rules := make([]string, 0, len(e.Conflicts))
+	for _, c := range e.Conflicts {
+		rules = append(rules, fmt.Sprintf("%s (%s)", c.Rule, c.Reason))
+	}
+	return fmt.Sprintf("the %s runtime policy changed in Prisma Cloud since the last sync: %s; sync the policy, review and import again",
+		e.Kind, strings.Join(rules, ", "))
+}
+
+// firstRuleByCollection maps each collection to the first rule applying to
+// it, the one Prisma Cloud enforces. Rules without collections match nothing.
+func firstRuleByCollection[R runtimeRule](rules []R) map[string]int {
+	index := make(map[string]int)
+	for i, rule := range rules {
+		for _, c := range identify(rule).Collections {
+			if _, ok := index[c.Name]; !ok {
+				index[c.Name] = i
+			}
+		}
+	}
+	return index
+}
+
+// catchAllCollection is the collection covering every workload. A rule for
+// it is what a collection without a rule of its own falls under.
+const catchAllCollection = "All"
+
+// ruleMerge is the outcome of merging verdicts into the live rules of a policy
+type ruleMerge[R runtimeRule] struct {
+	Rules     []R
+	Applied   int            // verdict entries written into a rule
+	Conflicts []RuleConflict // set instead of Rules when the merge is refused
+	Shadowed  []ShadowedRule // live rules the new rules are placed ahead of
+}
+
+// mergeRules applies verdicts to the live rules of a policy. synced are the
+// rules as of the last sync: a verdict may only change a live rule that still
+// has the name, modified timestamp and collection it had then, so nothing
+// edited in the console since is overwritten. Every other live rule is kept
+// as is. A collection without a rule, live or synced, gets a new rule ahead of
+// the live ones so its verdicts are enforced. That rule starts as a copy of
+// the catch-all rule it now shadows, if there is one, so the collection keeps
+// the effects it had. It is named after the collection, with a number added
+// when a rule of that name already exists.
+func mergeRules[R runtimeRule](synced, live []R, verdicts []CapabilitiesCSVHeader, newRule func(collection string) R, apply func(rule *R, v CapabilitiesCSVHeader) (bool, error)) (ruleMerge[R], error) {
+	syncedIndex := firstRuleByCollection(synced)
+	liveIndex := firstRuleByCollection(live)
+
+	// Verdicts are written into a deep copy: the live rules are also the
+	// before side of the diff and of the push_before snapshot
+	rules, err := cloneRules(live)
+	if err != nil {
+		return ruleMerge[R]{}, err
+	}
+	var created []R
+	var written []bool // whether a verdict was written into each new rule
+	createdIndex := make(map[string]int)
+	names := make(map[string]bool) // rule names taken, new rules must not reuse one
+	for _, rule := range live {
+		names[identify(rule).Name] = true
+	}
+	checked := make(map[string]bool)
+	var merge ruleMerge[R]
+
+	for _, v := range verdicts {
+		var rule *R
+		k := -1
+		i, isLive := liveIndex[v.CollectionName]
+		j, isSynced := syncedIndex[v.CollectionName]
+
+		switch {
+		case isLive:
+			if !checked[v.CollectionName] {
+				if conflict := checkRule(synced, syncedIndex, v.CollectionName, identify(live[i])); conflict != nil {
+					merge.Conflicts = append(merge.Conflicts, *conflict)
+				}
+			}
+			rule = &rules[i]
+		case isSynced:
+			if !checked[v.CollectionName] {
+				previous := identify(synced[j])
+				merge.Conflicts = append(merge.Conflicts, RuleConflict{
+					Rule:           previous.Name,
+					Collection:     v.CollectionName,
+					Reason:         "rule was removed or no longer covers the collection",
+					SyncedModified: previous.Modified,
+				})
+				checked[v.CollectionName] = true
+			}
+			continue
+		default:
+			var ok bool
+			if k, ok = createdIndex[v.CollectionName]; !ok {
+				fresh := newRule(v.CollectionName)
+				if c, ok := liveIndex[catchAllCollection]; ok {
+					if fresh, err = copyRule(live[c], v.CollectionName); err != nil {
+						return ruleMerge[R]{}, err
+					}
+				}
+				name := uniqueRuleName(v.CollectionName, names)
+				names[name] = true
+				setRuleName(&fresh, name)
+				created = append(created, fresh)
+				written = append(written, false)
+				k = len(created) - 1
+				createdIndex[v.CollectionName] = k
+			}
+			rule = &created[k]
+		}
+		checked[v.CollectionName] = true
+
+		changed, err := apply(rule, v)
+		if err != nil {
+			return ruleMerge[R]{}, fmt.Errorf("failed to update rule for collection %s: %v", v.CollectionName, err)
+		}
+		if changed {
+			merge.Applied++
+			if k >= 0 {
+				written[k] = true
+			}
+		}
+	}
+
+	if len(merge.Conflicts) > 0 {
+		return ruleMerge[R]{Conflicts: merge.Conflicts}, nil
+	}
+
+	for k, rule := range created {
+		if !written[k] {
+			continue
+		}
+		merge.Rules = append(merge.Rules, rule)
+		if c, ok := liveIndex[catchAllCollection]; ok {
+			id := identify(rule)
+			merge.Shadowed = append(merge.Shadowed, ShadowedRule{Rule: id.Name, Collection: id.Collections[0].Name, Shadows: identify(live[c]).Name})
+		}
+	}
+	merge.Rules = append(merge.Rules, rules...)
+	return merge, nil
+}
+
+// checkRule compares the live rule enforced for a collection with the synced one
+func checkRule[R runtimeRule](synced []R, syncedIndex map[string]int, collection string, live ruleIdentity) *RuleConflict {
+	conflict := RuleConflict{Rule: live.Name, Collection: collection, LiveModified: live.Modified}
+
+	j, ok := syncedIndex[collection]
+	if !ok {
+		conflict.Reason = "rule was added or now covers the collection"
+		return &conflict
+	}
+
+	previous := identify(synced[j])
+	conflict.SyncedModified = previous.Modified
+	switch {
+	case previous.Name != live.Name:
+		conflict.Reason = fmt.Sprintf("collection moved from rule %s", previous.Name)
+	case previous.Modified != live.Modified:
+		conflict.Reason = "rule was modified"
+	default:
+		return nil
+	}
+	return &conflict
+}
+
+// cloneRules deep-copies rules, so none of their lists is shared with the copy
+func cloneRules[R runtimeRule](rules []R) ([]R, error) {
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy rules: %v", err)
+	}
+	var clone []R
+	if err := json.Unmarshal(data, &clone); err != nil {
+		return nil, fmt.Errorf("failed to copy rules: %v", err)
+	}
+	return clone, nil
+}
+
+// copyRule copies a rule for a collection, named after and scoped to it like
+// a rule made by newRule
+func copyRule[R runtimeRule](rule R, collection string) (R, error) {
+	copies, err := cloneRules([]R{rule})
+	if err != nil {
+		return rule, err
+	}
+	copied := copies[0]
+
+	switch r := any(&copied).(type) {
+	case *ContainerRule:
+		r.Name, r.Collections = collection, []Collection{{Name: collection}}
+		r.Modified, r.Owner, r.PreviousName = "", "", ""
+	case *HostRule:
+		r.Name, r.Collections = collection, []Collection{{Name: collection}}
+		r.Modified, r.Owner, r.PreviousName = "", "", ""
+	case *AppEmbeddedRule:
+		r.Name, r.Collections = collection, []Collection{{Name: collection}}
+		r.Modified, r.Owner, r.PreviousName = "", "", ""
+	}
+	return copied, nil
+}
+
+// uniqueRuleName returns name, or name with the lowest number from 2 on
+// appended that no rule in taken has. Rules are told apart by name, in the
+// diff as in Prisma Cloud.
+func uniqueRuleName(name string, taken map[string]bool) string {
+	unique := name
+	for n := 2; taken[unique]; n++ {
+		unique = fmt.Sprintf("%s-%d", name, n)
+	}
+	return unique
+}
+
+func setRuleName[R runtimeRule](rule *R, name string) {
+	switch r := any(rule).(type) {
+	case *ContainerRule:
+		r.Name = name
+	case *HostRule:
+		r.Name = name
+	case *AppEmbeddedRule:
+		r.Name = name
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func containerVerdict(collection, key, value, verdict string) CapabilitiesCSVHeader {
+	return CapabilitiesCSVHeader{CollectionName: collection, Key: key, Value: value, Verdict: verdict}
+}
+
+func applyContainer(rule *ContainerRule, v CapabilitiesCSVHeader) (bool, error) {
+	return applyContainerVerdict(rule, v.Key, v.Value, v.Verdict, "prevent")
+}
+
+func TestMergeRulesLeavesLiveUnchanged(t *testing.T) {
+	rule := newContainerRule("payments")
+	rule.Modified = "2024-01-01"
+	rule.Processes.AllowedList = []string{"/bin/a", "/bin/b", "/bin/c"}
+	rule.Network.ListeningPorts.Allowed = []ContainerPortObject{{Start: 80, End: 90}}
+	live := []ContainerRule{rule}
+	synced := []ContainerRule{rule}
+
+	before, err := json.Marshal(live)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verdicts := []CapabilitiesCSVHeader{
+		containerVerdict("payments", "process", "/bin/a", "not_legitimate"),
+		containerVerdict("payments", "process", "/bin/d", "legitimate"),
+		containerVerdict("payments", "listening_port", "85", "not_legitimate"),
+	}
+	merge, err := mergeRules(synced, live, verdicts, newContainerRule, applyContainer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merge.Conflicts) > 0 {
+		t.Fatalf("unexpected conflicts: %+v", merge.Conflicts)
+	}
+	if merge.Applied != 3 {
+		t.Errorf("applied = %d, want 3", merge.Applied)
+	}
+	merged := merge.Rules
+
+	after, err := json.Marshal(live)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(before) != string(after) {
+		t.Errorf("live rules changed:\nbefore %s\nafter  %s", before, after)
+	}
+
+	got := merged[0].Processes
+	if want := []string{"/bin/b", "/bin/c", "/bin/d"}; !slices.Equal(got.AllowedList, want) {
+		t.Errorf("allowed = %q, want %q", got.AllowedList, want)
+	}
+	if want := []string{"/bin/a"}; !slices.Equal(got.DeniedList.Paths, want) {
+		t.Errorf("denied = %q, want %q", got.DeniedList.Paths, want)
+	}
+	if got.DeniedList.Effect != "prevent" {
+		t.Errorf("deny effect = %q, want prevent", got.DeniedList.Effect)
+	}
+	wantPorts := []ContainerPortObject{{Start: 80, End: 84}, {Start: 86, End: 90}}
+	if ports := merged[0].Network.ListeningPorts.Allowed; !slices.Equal(ports, wantPorts) {
+		t.Errorf("allowed ports = %+v, want %+v", ports, wantPorts)
+	}
+}
+
+func TestMergeRulesCopiesShadowedCatchAll(t *testing.T) {
+	catchAll := newContainerRule("All")
+	catchAll.Name = "Default - alert on all"
+	catchAll.Modified = "2024-01-01"
+	catchAll.Processes.DefaultEffect = "alert"
+	catchAll.Processes.AllowedList = []string{"/bin/sh"}
+	live := []ContainerRule{catchAll}
+
+	verdicts := []CapabilitiesCSVHeader{containerVerdict("payments", "process", "/bin/curl", "not_legitimate")}
+	merge, err := mergeRules(live, live, verdicts, newContainerRule, applyContainer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(merge.Rules) != 2 {
+		t.Fatalf("rules = %+v, want the new rule ahead of the catch-all", merge.Rules)
+	}
+
+	added := merge.Rules[0]
+	if added.Name != "payments" || len(added.Collections) != 1 || added.Collections[0].Name != "payments" || added.Modified != "" {
+		t.Errorf("new rule is not scoped to its collection: %+v", added)
+	}
+	if added.Processes.DefaultEffect != "alert" || !slices.Equal(added.Processes.AllowedList, []string{"/bin/sh"}) {
+		t.Errorf("new rule does not keep the catch-all settings: %+v", added.Processes)
+	}
+	if !slices.Equal(added.Processes.DeniedList.Paths, []string{"/bin/curl"}) {
+		t.Errorf("denied = %q, want /bin/curl", added.Processes.DeniedList.Paths)
+	}
+	if merge.Rules[1].Name != catchAll.Name {
+		t.Errorf("catch-all moved: %+v", merge.Rules[1])
+	}
+
+	want := []ShadowedRule{{Rule: "payments", Collection: "payments", Shadows: "Default - alert on all"}}
+	if !slices.Equal(merge.Shadowed, want) {
+		t.Errorf("shadowed = %+v, want %+v", merge.Shadowed, want)
+	}
+}
+
+func TestRemoveStringCopies(t *testing.T) {
+	list := []string{"a", "b", "c"}
+	if got := removeString(list, "a"); !slices.Equal(got, []string{"b", "c"}) {
+		t.Errorf("removeString = %q", got)
+	}
+	if !slices.Equal(list, []string{"a", "b", "c"}) {
+		t.Errorf("input changed to %q", list)
+	}
+
+	backing := make([]string, 2, 4)
+	backing[0], backing[1] = "a", "b"
+	first := addString(backing, "c")
+	second := addString(backing, "d")
+	if first[2] != "c" || second[2] != "d" {
+		t.Errorf("addString shares its input: %q %q", first, second)
+	}
+}
+
+func TestMergeRulesConflicts(t *testing.T) {
+	rule := func(name, modified string, collections ...string) ContainerRule {
+		r := newContainerRule(name)
+		r.Modified = modified
+		r.Collections = nil
+		for _, c := range collections {
+			r.Collections = append(r.Collections, Collection{Name: c})
+		}
+		return r
+	}
+
+	tests := []struct {
+		name         string
+		synced, live []ContainerRule
+		want         []RuleConflict
+		wantRules    []string
+	}{
+		{
+			name:      "unchanged",
+			synced:    []ContainerRule{rule("r1", "t1", "payments")},
+			live:      []ContainerRule{rule("r1", "t1", "payments")},
+			wantRules: []string{"r1"},
+		},
+		{
+			name:   "modified in the console",
+			synced: []ContainerRule{rule("r1", "t1", "payments")},
+			live:   []ContainerRule{rule("r1", "t2", "payments")},
+			want:   []RuleConflict{{Rule: "r1", Collection: "payments", Reason: "rule was modified", SyncedModified: "t1", LiveModified: "t2"}},
+		},
+		{
+			name:   "collection moved to another rule",
+			synced: []ContainerRule{rule("r1", "t1", "payments"), rule("r2", "t1", "other")},
+			live:   []ContainerRule{rule("r2", "t1", "payments", "other")},
+			want:   []RuleConflict{{Rule: "r2", Collection: "payments", Reason: "collection moved from rule r1", SyncedModified: "t1", LiveModified: "t1"}},
+		},
+		{
+			name:   "rule added for the collection",
+			synced: []ContainerRule{},
+			live:   []ContainerRule{rule("r1", "t1", "payments")},
+			want:   []RuleConflict{{Rule: "r1", Collection: "payments", Reason: "rule was added or now covers the collection", LiveModified: "t1"}},
+		},
+		{
+			name:   "rule removed",
+			synced: []ContainerRule{rule("r1", "t1", "payments")},
+			live:   []ContainerRule{},
+			want:   []RuleConflict{{Rule: "r1", Collection: "payments", Reason: "rule was removed or no longer covers the collection", SyncedModified: "t1"}},
+		},
+		{
+			name:      "other rules changed",
+			synced:    []ContainerRule{rule("r1", "t1", "payments"), rule("r2", "t1", "other")},
+			live:      []ContainerRule{rule("r1", "t1", "payments"), rule("r2", "t2", "other")},
+			wantRules: []string{"r1", "r2"},
+		},
+		{
+			name:      "new collection",
+			synced:    []ContainerRule{rule("r1", "t1", "other")},
+			live:      []ContainerRule{rule("r1", "t1", "other")},
+			wantRules: []string{"payments", "r1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdicts := []CapabilitiesCSVHeader{
+				containerVerdict("payments", "process", "/bin/a", "legitimate"),
+				containerVerdict("payments", "process", "/bin/b", "legitimate"),
+			}
+			merge, err := mergeRules(tt.synced, tt.live, verdicts, newContainerRule, applyContainer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(merge.Conflicts, tt.want) {
+				t.Errorf("conflicts = %+v, want %+v", merge.Conflicts, tt.want)
+			}
+			var names []string
+			for _, r := range merge.Rules {
+				names = append(names, r.Name)
+			}
+			if !slices.Equal(names, tt.wantRules) {
+				t.Errorf("rules = %q, want %q", names, tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestMergeRulesNewRuleNameTaken(t *testing.T) {
+	// A live rule is already named after the collection that needs a new rule
+	taken := newContainerRule("payments")
+	taken.Collections = []Collection{{Name: "other"}}
+	numbered := newContainerRule("payments-2")
+	numbered.Collections = []Collection{{Name: "legacy"}}
+	live := []ContainerRule{taken, numbered}
+
+	verdicts := []CapabilitiesCSVHeader{
+		containerVerdict("payments", "processes", "/bin/a", "legitimate"),
+		containerVerdict("payments", "processes", "/bin/b", "legitimate"),
+	}
+	merge, err := mergeRules(live, live, verdicts, newContainerRule, applyContainer)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for _, r := range merge.Rules {
+		names = append(names, r.Name)
+	}
+	if !slices.Equal(names, []string{"payments-3", "payments", "payments-2"}) {
+		t.Fatalf("rules = %q, want the new rule under a name of its own", names)
+	}
+	if got := merge.Rules[0]; len(got.Collections) != 1 || got.Collections[0].Name != "payments" || !slices.Equal(got.Processes.AllowedList, []string{"/bin/a", "/bin/b"}) {
+		t.Errorf("new rule = %+v", got)
+	}
+
+	diff, err := diffPolicies(ContainerPolicy{Rules: live}, ContainerPolicy{Rules: merge.Rules})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(diff.RulesAdded, []string{"payments-3"}) || len(diff.Rules) != 1 || diff.Rules[0].Name != "payments-3" {
+		t.Errorf("diff = %+v, want only payments-3 added", diff)
+	}
+}
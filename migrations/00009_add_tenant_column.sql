@@ -0,0 +1,253 @@
+-- +goose Up
+-- +goose StatementBegin
+-- SQLite cannot change UNIQUE constraints in place, so every table is rebuilt
+-- with a tenant column that is part of its uniqueness key. Existing rows
+-- belong to the "default" tenant.
+
+CREATE TABLE container_profiles_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant TEXT NOT NULL DEFAULT 'default',
+    collection_name TEXT NOT NULL,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME,
+    verdict TEXT,
+    remarks TEXT,
+    UNIQUE(tenant, collection_name, key, value)
+);
+
+INSERT INTO container_profiles_new (id, tenant, collection_name, key, value, created_at, updated_at, verdict, remarks)
+SELECT id, 'default', collection_name, key, value, created_at, updated_at, verdict, remarks FROM container_profiles;
+
+DROP TABLE container_profiles;
+ALTER TABLE container_profiles_new RENAME TO container_profiles;
+
+CREATE INDEX idx_tenant ON container_profiles(tenant);
+CREATE INDEX idx_collection_name ON container_profiles(collection_name);
+CREATE INDEX idx_key ON container_profiles(key);
+CREATE INDEX idx_collection_key ON container_profiles(collection_name, key);
+CREATE INDEX idx_verdict ON container_profiles(verdict);
+
+CREATE TABLE host_profiles_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant TEXT NOT NULL DEFAULT 'default',
+    host_id TEXT NOT NULL,
+    collection_name TEXT NOT NULL,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(tenant, host_id, collection_name, key, value)
+);
+
+INSERT INTO host_profiles_new (id, tenant, host_id, collection_name, key, value, created_at)
+SELECT id, 'default', host_id, collection_name, key, value, created_at FROM host_profiles;
+
+DROP TABLE host_profiles;
+ALTER TABLE host_profiles_new RENAME TO host_profiles;
+
+CREATE INDEX idx_host_tenant ON host_profiles(tenant);
+CREATE INDEX idx_host_id ON host_profiles(host_id);
+CREATE INDEX idx_host_collection_name ON host_profiles(collection_name);
+CREATE INDEX idx_host_key ON host_profiles(key);
+CREATE INDEX idx_host_collection_key ON host_profiles(collection_name, key);
+
+CREATE TABLE app_embedded_profiles_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant TEXT NOT NULL DEFAULT 'default',
+    profile_id TEXT NOT NULL,
+    app_id TEXT,
+    collection_name TEXT NOT NULL,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(tenant, profile_id, collection_name, key, value)
+);
+
+INSERT INTO app_embedded_profiles_new (id, tenant, profile_id, app_id, collection_name, key, value, created_at)
+SELECT id, 'default', profile_id, app_id, collection_name, key, value, created_at FROM app_embedded_profiles;
+
+DROP TABLE app_embedded_profiles;
+ALTER TABLE app_embedded_profiles_new RENAME TO app_embedded_profiles;
+
+CREATE INDEX idx_app_embedded_tenant ON app_embedded_profiles(tenant);
+CREATE INDEX idx_app_embedded_profile_id ON app_embedded_profiles(profile_id);
+CREATE INDEX idx_app_embedded_collection ON app_embedded_profiles(collection_name);
+CREATE INDEX idx_app_embedded_key ON app_embedded_profiles(key);
+
+CREATE TABLE app_embedded_policies_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant TEXT NOT NULL DEFAULT 'default',
+    policy_id TEXT NOT NULL,
+    collection_name TEXT NOT NULL,
+    rule TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(tenant, policy_id, collection_name)
+);
+
+INSERT INTO app_embedded_policies_new (id, tenant, policy_id, collection_name, rule, created_at)
+SELECT id, 'default', policy_id, collection_name, rule, created_at FROM app_embedded_policies;
+
+DROP TABLE app_embedded_policies;
+ALTER TABLE app_embedded_policies_new RENAME TO app_embedded_policies;
+
+CREATE INDEX idx_app_embedded_policy_tenant ON app_embedded_policies(tenant);
+CREATE INDEX idx_app_embedded_policy_id ON app_embedded_policies(policy_id);
+CREATE INDEX idx_app_embedded_policy_collection ON app_embedded_policies(collection_name);
+
+CREATE TABLE container_policies_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant TEXT NOT NULL DEFAULT 'default',
+    collection_name TEXT NOT NULL,
+    rule TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(tenant, collection_name)
+);
+
+-- container_policies is not copied: on databases created from scratch the
+-- table from 00003 (without a rule column) shadows the one from 00008, so its
+-- shape is unreliable. It is only a cache, rebuilt by the next /policy/container.
+DROP TABLE container_policies;
+ALTER TABLE container_policies_new RENAME TO container_policies;
+
+CREATE INDEX idx_tenant_container_policies ON container_policies(tenant);
+CREATE INDEX idx_collection_name_container_policies ON container_policies(collection_name);
+
+CREATE TABLE host_policies_new (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant TEXT NOT NULL DEFAULT 'default',
+    collection_name TEXT NOT NULL,
+    rule TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(tenant, collection_name)
+);
+
+INSERT INTO host_policies_new (id, tenant, collection_name, rule, created_at)
+SELECT id, 'default', collection_name, rule, created_at FROM host_policies;
+
+DROP TABLE host_policies;
+ALTER TABLE host_policies_new RENAME TO host_policies;
+
+CREATE INDEX idx_tenant_host_policies ON host_policies(tenant);
+CREATE INDEX idx_collection_name_host_policies ON host_policies(collection_name);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+-- Only rows of the "default" tenant survive a downgrade
+
+CREATE TABLE host_policies_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    collection_name TEXT NOT NULL,
+    rule TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(collection_name)
+);
+
+INSERT INTO host_policies_old (id, collection_name, rule, created_at)
+SELECT id, collection_name, rule, created_at FROM host_policies WHERE tenant = 'default';
+
+DROP TABLE host_policies;
+ALTER TABLE host_policies_old RENAME TO host_policies;
+
+CREATE INDEX idx_collection_name_host_policies ON host_policies(collection_name);
+
+CREATE TABLE container_policies_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    collection_name TEXT NOT NULL,
+    rule TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(collection_name)
+);
+
+INSERT INTO container_policies_old (id, collection_name, rule, created_at)
+SELECT id, collection_name, rule, created_at FROM container_policies WHERE tenant = 'default';
+
+DROP TABLE container_policies;
+ALTER TABLE container_policies_old RENAME TO container_policies;
+
+CREATE INDEX idx_collection_name_container_policies ON container_policies(collection_name);
+
+CREATE TABLE app_embedded_policies_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    policy_id TEXT NOT NULL,
+    collection_name TEXT NOT NULL,
+    rule TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(policy_id, collection_name)
+);
+
+INSERT INTO app_embedded_policies_old (id, policy_id, collection_name, rule, created_at)
+SELECT id, policy_id, collection_name, rule, created_at FROM app_embedded_policies WHERE tenant = 'default';
+
+DROP TABLE app_embedded_policies;
+ALTER TABLE app_embedded_policies_old RENAME TO app_embedded_policies;
+
+CREATE INDEX idx_app_embedded_policy_id ON app_embedded_policies(policy_id);
+CREATE INDEX idx_app_embedded_policy_collection ON app_embedded_policies(collection_name);
+
+CREATE TABLE app_embedded_profiles_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    profile_id TEXT NOT NULL,
+    app_id TEXT,
+    collection_name TEXT NOT NULL,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(profile_id, collection_name, key, value)
+);
+
+INSERT INTO app_embedded_profiles_old (id, profile_id, app_id, collection_name, key, value, created_at)
+SELECT id, profile_id, app_id, collection_name, key, value, created_at FROM app_embedded_profiles WHERE tenant = 'default';
+
+DROP TABLE app_embedded_profiles;
+ALTER TABLE app_embedded_profiles_old RENAME TO app_embedded_profiles;
+
+CREATE INDEX idx_app_embedded_profile_id ON app_embedded_profiles(profile_id);
+CREATE INDEX idx_app_embedded_collection ON app_embedded_profiles(collection_name);
+CREATE INDEX idx_app_embedded_key ON app_embedded_profiles(key);
+
+CREATE TABLE host_profiles_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    host_id TEXT NOT NULL,
+    collection_name TEXT NOT NULL,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE(host_id, collection_name, key, value)
+);
+
+INSERT INTO host_profiles_old (id, host_id, collection_name, key, value, created_at)
+SELECT id, host_id, collection_name, key, value, created_at FROM host_profiles WHERE tenant = 'default';
+
+DROP TABLE host_profiles;
+ALTER TABLE host_profiles_old RENAME TO host_profiles;
+
+CREATE INDEX idx_host_id ON host_profiles(host_id);
+CREATE INDEX idx_host_collection_name ON host_profiles(collection_name);
+CREATE INDEX idx_host_key ON host_profiles(key);
+CREATE INDEX idx_host_collection_key ON host_profiles(collection_name, key);
+
+CREATE TABLE container_profiles_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    collection_name TEXT NOT NULL,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    updated_at DATETIME,
+    verdict TEXT,
+    remarks TEXT,
+    UNIQUE(collection_name, key, value)
+);
+
+INSERT INTO container_profiles_old (id, collection_name, key, value, created_at, updated_at, verdict, remarks)
+SELECT id, collection_name, key, value, created_at, updated_at, verdict, remarks FROM container_profiles WHERE tenant = 'default';
+
+DROP TABLE container_profiles;
+ALTER TABLE container_profiles_old RENAME TO container_profiles;
+
+CREATE INDEX idx_collection_name ON container_profiles(collection_name);
+CREATE INDEX idx_key ON container_profiles(key);
+CREATE INDEX idx_collection_key ON container_profiles(collection_name, key);
+CREATE INDEX idx_verdict ON container_profiles(verdict);
+-- +goose StatementEnd
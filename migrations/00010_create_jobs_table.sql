@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS jobs (
+    id TEXT PRIMARY KEY,
+    tenant TEXT NOT NULL,
+    type TEXT NOT NULL,
+    status TEXT NOT NULL,
+    pages_fetched INTEGER NOT NULL DEFAULT 0,
+    items_fetched INTEGER NOT NULL DEFAULT 0,
+    rows_saved INTEGER NOT NULL DEFAULT 0,
+    result TEXT,
+    error TEXT,
+    created_at DATETIME NOT NULL,
+    started_at DATETIME,
+    finished_at DATETIME
+);
+
+CREATE INDEX idx_jobs_status ON jobs(status);
+CREATE INDEX idx_jobs_tenant_type ON jobs(tenant, type);
+CREATE INDEX idx_jobs_created_at ON jobs(created_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_jobs_created_at;
+DROP INDEX IF EXISTS idx_jobs_tenant_type;
+DROP INDEX IF EXISTS idx_jobs_status;
+DROP TABLE IF EXISTS jobs;
+-- +goose StatementEnd
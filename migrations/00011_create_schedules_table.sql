@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS schedules (
+    tenant TEXT NOT NULL,
+    operation TEXT NOT NULL,
+    expression TEXT NOT NULL,
+    last_run_at DATETIME,
+    last_job_id TEXT,
+    updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (tenant, operation)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS schedules;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE host_profiles ADD COLUMN updated_at DATETIME;
+ALTER TABLE host_profiles ADD COLUMN verdict TEXT;
+ALTER TABLE host_profiles ADD COLUMN remarks TEXT;
+
+-- Everything synced so far has not been reviewed yet
+UPDATE host_profiles SET verdict = 'not_yet', updated_at = CURRENT_TIMESTAMP;
+
+CREATE INDEX idx_host_verdict ON host_profiles(verdict);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_host_verdict;
+ALTER TABLE host_profiles DROP COLUMN remarks;
+ALTER TABLE host_profiles DROP COLUMN verdict;
+ALTER TABLE host_profiles DROP COLUMN updated_at;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE app_embedded_profiles ADD COLUMN updated_at DATETIME;
+ALTER TABLE app_embedded_profiles ADD COLUMN verdict TEXT;
+ALTER TABLE app_embedded_profiles ADD COLUMN remarks TEXT;
+
+-- Everything synced so far has not been reviewed yet
+UPDATE app_embedded_profiles SET verdict = 'not_yet', updated_at = CURRENT_TIMESTAMP;
+
+CREATE INDEX idx_app_embedded_verdict ON app_embedded_profiles(verdict);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_app_embedded_verdict;
+ALTER TABLE app_embedded_profiles DROP COLUMN remarks;
+ALTER TABLE app_embedded_profiles DROP COLUMN verdict;
+ALTER TABLE app_embedded_profiles DROP COLUMN updated_at;
+-- +goose StatementEnd
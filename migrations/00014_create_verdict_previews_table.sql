@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS verdict_previews (
+    token TEXT PRIMARY KEY,
+    tenant TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    records TEXT NOT NULL,
+    diff TEXT NOT NULL,
+    applied INTEGER NOT NULL DEFAULT 0,
+    fingerprint TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    applied_at DATETIME
+);
+
+CREATE INDEX idx_verdict_previews_tenant ON verdict_previews(tenant);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_verdict_previews_tenant;
+DROP TABLE IF EXISTS verdict_previews;
+-- +goose StatementEnd
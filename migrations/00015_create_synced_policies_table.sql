@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+-- The full runtime policy of each kind as last synced from or pushed to Prisma
+-- Cloud. Verdict pushes merge against it to notice changes made in the console.
+CREATE TABLE IF NOT EXISTS synced_policies (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    policy TEXT NOT NULL,
+    synced_at DATETIME NOT NULL,
+    UNIQUE(tenant, kind)
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS synced_policies;
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Every version of the runtime policies adam has seen: at each sync that finds
+-- a change, and around each verdict push or rollback
+CREATE TABLE IF NOT EXISTS policy_snapshots (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    source TEXT NOT NULL,
+    policy TEXT NOT NULL,
+    fingerprint TEXT NOT NULL,
+    rules INTEGER NOT NULL,
+    created_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_policy_snapshots_tenant_kind ON policy_snapshots(tenant, kind);
+
+-- The policies synced so far are the first versions. SQLite cannot hash them,
+-- so the next sync stores its version even when nothing changed.
+INSERT INTO policy_snapshots (tenant, kind, source, policy, fingerprint, rules, created_at)
+SELECT tenant, kind, 'sync', policy, '', COALESCE(json_array_length(policy, '$.rules'), 0), synced_at
+FROM synced_policies;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_policy_snapshots_tenant_kind;
+DROP TABLE IF EXISTS policy_snapshots;
+-- +goose StatementEnd
@@ -0,0 +1,75 @@
+-- +goose Up
+-- +goose StatementBegin
+-- first_seen and last_seen are the syncs an entry was first and last observed
+-- in; previous_seen is the sync before last_seen, to tell reappearing entries
+ALTER TABLE container_profiles ADD COLUMN first_seen DATETIME;
+ALTER TABLE container_profiles ADD COLUMN last_seen DATETIME;
+ALTER TABLE container_profiles ADD COLUMN previous_seen DATETIME;
+UPDATE container_profiles SET first_seen = created_at, last_seen = created_at;
+CREATE INDEX idx_last_seen ON container_profiles(tenant, last_seen);
+
+ALTER TABLE host_profiles ADD COLUMN first_seen DATETIME;
+ALTER TABLE host_profiles ADD COLUMN last_seen DATETIME;
+ALTER TABLE host_profiles ADD COLUMN previous_seen DATETIME;
+UPDATE host_profiles SET first_seen = created_at, last_seen = created_at;
+CREATE INDEX idx_host_last_seen ON host_profiles(tenant, last_seen);
+
+ALTER TABLE app_embedded_profiles ADD COLUMN first_seen DATETIME;
+ALTER TABLE app_embedded_profiles ADD COLUMN last_seen DATETIME;
+ALTER TABLE app_embedded_profiles ADD COLUMN previous_seen DATETIME;
+UPDATE app_embedded_profiles SET first_seen = created_at, last_seen = created_at;
+CREATE INDEX idx_app_embedded_last_seen ON app_embedded_profiles(tenant, last_seen);
+
+-- One row per profile sync. Only complete syncs can tell disappeared entries.
+CREATE TABLE IF NOT EXISTS profile_syncs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    synced_at DATETIME NOT NULL,
+    complete INTEGER NOT NULL,
+    new_count INTEGER NOT NULL DEFAULT 0,
+    disappeared_count INTEGER NOT NULL DEFAULT 0,
+    reappeared_count INTEGER NOT NULL DEFAULT 0,
+    emailed_at DATETIME
+);
+
+CREATE INDEX idx_profile_syncs_tenant_kind ON profile_syncs(tenant, kind);
+
+-- What changed in a sync compared to the previous complete one
+CREATE TABLE IF NOT EXISTS profile_drift (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    sync_id INTEGER NOT NULL REFERENCES profile_syncs(id),
+    tenant TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    entry_id INTEGER NOT NULL,
+    collection_name TEXT NOT NULL,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    change TEXT NOT NULL
+);
+
+CREATE INDEX idx_profile_drift_sync ON profile_drift(sync_id, collection_name);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_profile_drift_sync;
+DROP TABLE IF EXISTS profile_drift;
+DROP INDEX IF EXISTS idx_profile_syncs_tenant_kind;
+DROP TABLE IF EXISTS profile_syncs;
+
+DROP INDEX IF EXISTS idx_app_embedded_last_seen;
+ALTER TABLE app_embedded_profiles DROP COLUMN previous_seen;
+ALTER TABLE app_embedded_profiles DROP COLUMN last_seen;
+ALTER TABLE app_embedded_profiles DROP COLUMN first_seen;
+
+DROP INDEX IF EXISTS idx_host_last_seen;
+ALTER TABLE host_profiles DROP COLUMN previous_seen;
+ALTER TABLE host_profiles DROP COLUMN last_seen;
+ALTER TABLE host_profiles DROP COLUMN first_seen;
+
+DROP INDEX IF EXISTS idx_last_seen;
+ALTER TABLE container_profiles DROP COLUMN previous_seen;
+ALTER TABLE container_profiles DROP COLUMN last_seen;
+ALTER TABLE container_profiles DROP COLUMN first_seen;
+-- +goose StatementEnd
@@ -0,0 +1,44 @@
+-- +goose Up
+-- +goose StatementBegin
+-- One row per retention run that removed profile entries
+CREATE TABLE IF NOT EXISTS retention_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant TEXT NOT NULL,
+    ran_at DATETIME NOT NULL,
+    unseen_days INTEGER NOT NULL,
+    archive_orphaned INTEGER NOT NULL,
+    purged_count INTEGER NOT NULL DEFAULT 0,
+    archived_count INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX idx_retention_runs_tenant ON retention_runs(tenant);
+
+-- Every entry a run removed from a profile table. Archived entries keep their
+-- verdict and remarks; purged ones never had a verdict.
+CREATE TABLE IF NOT EXISTS retired_profile_entries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_id INTEGER NOT NULL REFERENCES retention_runs(id),
+    tenant TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    action TEXT NOT NULL,
+    entry_id INTEGER NOT NULL,
+    collection_name TEXT NOT NULL,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    owner TEXT NOT NULL DEFAULT '',
+    verdict TEXT,
+    remarks TEXT,
+    first_seen DATETIME,
+    last_seen DATETIME
+);
+
+CREATE INDEX idx_retired_profile_entries_run ON retired_profile_entries(run_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_retired_profile_entries_run;
+DROP TABLE IF EXISTS retired_profile_entries;
+DROP INDEX IF EXISTS idx_retention_runs_tenant;
+DROP TABLE IF EXISTS retention_runs;
+-- +goose StatementEnd
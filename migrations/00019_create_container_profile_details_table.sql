@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Every distinct observation behind a container profile entry: the workload
+-- it came from and, for processes, how the process ran
+CREATE TABLE IF NOT EXISTS container_profile_details (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant TEXT NOT NULL,
+    entry_id INTEGER NOT NULL,
+    image TEXT NOT NULL DEFAULT '',
+    namespace TEXT NOT NULL DEFAULT '',
+    cluster TEXT NOT NULL DEFAULT '',
+    user TEXT NOT NULL DEFAULT '',
+    ppath TEXT NOT NULL DEFAULT '',
+    command TEXT NOT NULL DEFAULT '',
+    md5 TEXT NOT NULL DEFAULT '',
+    modified INTEGER NOT NULL DEFAULT 0,
+    interactive INTEGER NOT NULL DEFAULT 0,
+    first_seen DATETIME,
+    last_seen DATETIME,
+    UNIQUE(entry_id, image, namespace, cluster, user, ppath, command, md5, modified, interactive)
+);
+
+CREATE INDEX idx_container_profile_details_tenant ON container_profile_details(tenant);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_container_profile_details_tenant;
+DROP TABLE IF EXISTS container_profile_details;
+-- +goose StatementEnd
@@ -0,0 +1,37 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Every change of a verdict or its remarks, with who made it and from where
+CREATE TABLE IF NOT EXISTS verdict_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    tenant TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    entry_id INTEGER NOT NULL,
+    collection_name TEXT NOT NULL,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    old_verdict TEXT,
+    new_verdict TEXT NOT NULL,
+    old_remarks TEXT,
+    new_remarks TEXT,
+    reviewer TEXT NOT NULL,
+    source TEXT NOT NULL,
+    file_hash TEXT NOT NULL DEFAULT '',
+    changed_at DATETIME NOT NULL
+);
+
+CREATE INDEX idx_verdict_history_entry ON verdict_history(tenant, kind, entry_id);
+CREATE INDEX idx_verdict_history_collection ON verdict_history(tenant, collection_name);
+
+-- A confirmed preview is attributed to the file it was previewed from
+ALTER TABLE verdict_previews ADD COLUMN source TEXT NOT NULL DEFAULT '';
+ALTER TABLE verdict_previews ADD COLUMN file_hash TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE verdict_previews DROP COLUMN file_hash;
+ALTER TABLE verdict_previews DROP COLUMN source;
+DROP INDEX IF EXISTS idx_verdict_history_collection;
+DROP INDEX IF EXISTS idx_verdict_history_entry;
+DROP TABLE IF EXISTS verdict_history;
+-- +goose StatementEnd
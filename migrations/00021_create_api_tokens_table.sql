@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Named API tokens. Only a SHA-256 of the secret is stored; the token itself
+-- is shown once when issued.
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    secret_hash TEXT NOT NULL,
+    scopes TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME,
+    revoked_at DATETIME,
+    last_used_at DATETIME
+);
+
+-- A name is reusable once its token is revoked
+CREATE UNIQUE INDEX idx_api_tokens_active_name ON api_tokens(name) WHERE revoked_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_api_tokens_active_name;
+DROP TABLE IF EXISTS api_tokens;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+-- A preview remembers who reviewed it, so confirming it records who reviewed
+-- the verdicts and who approved the push separately
+ALTER TABLE verdict_previews ADD COLUMN reviewer TEXT NOT NULL DEFAULT '';
+ALTER TABLE verdict_history ADD COLUMN approver TEXT NOT NULL DEFAULT '';
+
+-- Earlier changes only recorded who applied them
+UPDATE verdict_history SET approver = reviewer;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE verdict_history DROP COLUMN approver;
+ALTER TABLE verdict_previews DROP COLUMN reviewer;
+-- +goose StatementEnd
@@ -1,17 +1,47 @@
 package main
 
+import "time"
+
 type Config struct {
-	AccessKeyId       string `env:"ACCESS_KEY_ID,required"`
-	SecretAccessKey   string `env:"SECRET_ACCESS_KEY,required"`
-	SMTPHost          string `env:"SMTP_HOST"`
-	SMTPPort          int    `env:"SMTP_PORT"`
-	SMTPUsername      string `env:"SMTP_USERNAME"`
-	SMTPPassword      string `env:"SMTP_PASSWORD"`
-	EmailFrom         string `env:"EMAIL_FROM"`
-	EmailTo           string `env:"EMAIL_TO"` // Comma-separated email addresses
-	Token             string `env:"TOKEN"`
-	ComplianceStandard string `env:"COMPLIANCE_STANDARD"`
-	WeeklyReportTo   string `env:"WEEKLY_REPORT_TO"`
+	Tenants            string        `env:"TENANTS"` // Comma-separated tenant names, empty for a single "default" tenant
+	AccessKeyId        string        `env:"ACCESS_KEY_ID"`
+	SecretAccessKey    string        `env:"SECRET_ACCESS_KEY"`
+	ConsoleURL         string        `env:"PRISMA_CONSOLE_URL" envDefault:"https://asia-southeast2.cloud.twistlock.com/indonesia-751472959"`
+	APIVersion         string        `env:"PRISMA_API_VERSION" envDefault:"v34.03"`
+	HTTPTimeout        time.Duration `env:"PC_HTTP_TIMEOUT" envDefault:"2m"`
+	MaxRetries         int           `env:"PC_MAX_RETRIES" envDefault:"4"`
+	RetryBaseDelay     time.Duration `env:"PC_RETRY_BASE_DELAY" envDefault:"1s"`
+	RetryMaxDelay      time.Duration `env:"PC_RETRY_MAX_DELAY" envDefault:"1m"`
+	RateLimitPerMinute int           `env:"PC_RATE_LIMIT_PER_MINUTE" envDefault:"60"` // 0 disables the limiter
+	RateLimitBurst     int           `env:"PC_RATE_LIMIT_BURST" envDefault:"10"`
+	PageWorkers        int           `env:"PC_PAGE_WORKERS" envDefault:"4"` // Pages fetched concurrently per sync
+	JobWorkers         int           `env:"JOB_WORKERS" envDefault:"2"`
+	JobQueueSize       int           `env:"JOB_QUEUE_SIZE" envDefault:"100"`
+	// Cron expressions per operation, run for every tenant; empty disables the schedule
+	ScheduleContainerProfiles   string        `env:"SCHEDULE_CONTAINER_PROFILES"`
+	ScheduleHostProfiles        string        `env:"SCHEDULE_HOST_PROFILES"`
+	ScheduleAppEmbeddedProfiles string        `env:"SCHEDULE_APP_EMBEDDED_PROFILES"`
+	ScheduleContainerPolicies   string        `env:"SCHEDULE_CONTAINER_POLICIES"`
+	ScheduleHostPolicies        string        `env:"SCHEDULE_HOST_POLICIES"`
+	ScheduleAppEmbeddedPolicies string        `env:"SCHEDULE_APP_EMBEDDED_POLICIES"`
+	ScheduleVerdictEmail        string        `env:"SCHEDULE_VERDICT_EMAIL"`
+	ScheduleDriftEmail          string        `env:"SCHEDULE_DRIFT_EMAIL"`
+	ScheduleRetention           string        `env:"SCHEDULE_RETENTION"`
+	ScheduleWeeklyReport        string        `env:"SCHEDULE_WEEKLY_REPORT" envDefault:"0 9 * * 1"`
+	ScheduleTimezone            string        `env:"SCHEDULE_TIMEZONE" envDefault:"UTC"`
+	ScheduleCatchUp             time.Duration `env:"SCHEDULE_CATCH_UP" envDefault:"24h"`    // Missed runs older than this are skipped, 0 disables catch-up
+	VerdictDenyEffect           string        `env:"VERDICT_DENY_EFFECT"`                   // alert, prevent or block; empty keeps the effects of the rule
+	RetentionUnseenDays         int           `env:"RETENTION_UNSEEN_DAYS" envDefault:"90"` // Purge not_yet entries unseen this long, 0 keeps them
+	RetentionArchiveOrphaned    bool          `env:"RETENTION_ARCHIVE_ORPHANED" envDefault:"true"`
+	SMTPHost                    string        `env:"SMTP_HOST"`
+	SMTPPort                    int           `env:"SMTP_PORT"`
+	SMTPUsername                string        `env:"SMTP_USERNAME"`
+	SMTPPassword                string        `env:"SMTP_PASSWORD"`
+	EmailFrom                   string        `env:"EMAIL_FROM"`
+	EmailTo                     string        `env:"EMAIL_TO"` // Comma-separated email addresses
+	Token                       string        `env:"TOKEN"`    // Shared token with every scope, empty to only accept issued tokens
+	ComplianceStandard          string        `env:"COMPLIANCE_STANDARD"`
+	WeeklyReportTo              string        `env:"WEEKLY_REPORT_TO"`
 }
 
 type AuthenticateRequest struct {
@@ -548,16 +578,32 @@ type AppEmbeddedProfileRecord struct {
 
 // AppEmbeddedProfile represents an app-embedded runtime profile from Prisma Cloud
 type AppEmbeddedProfile struct {
-	ID            string        `json:"_id"`
-	AppID         string        `json:"appID"`
-	CloudMetadata CloudMetadata `json:"cloudMetadata,omitempty"`
-	Cluster       string        `json:"cluster,omitempty"`
-	ClusterType   string        `json:"clusterType,omitempty"`
-	Collections   []string      `json:"collections"`
-	Container     string        `json:"container,omitempty"`
-	Image         string        `json:"image,omitempty"`
-	ImageID       string        `json:"imageID,omitempty"`
-	StartTime     string        `json:"startTime,omitempty"`
+	ID            string                    `json:"_id"`
+	AppID         string                    `json:"appID"`
+	CloudMetadata CloudMetadata             `json:"cloudMetadata,omitempty"`
+	Cluster       string                    `json:"cluster,omitempty"`
+	ClusterType   string                    `json:"clusterType,omitempty"`
+	Collections   []string                  `json:"collections"`
+	Container     string                    `json:"container,omitempty"`
+	DNSQueries    []DNSQuery                `json:"dnsQueries"`
+	Image         string                    `json:"image,omitempty"`
+	ImageID       string                    `json:"imageID,omitempty"`
+	Network       AppEmbeddedProfileNetwork `json:"network,omitempty"`
+	Processes     []ProcessEntry            `json:"processes"`
+	StartTime     string                    `json:"startTime,omitempty"`
+}
+
+// AppEmbeddedProfileNetwork is the network activity learned for an app-embedded app
+type AppEmbeddedProfileNetwork struct {
+	ListeningPorts []Port                  `json:"listeningPorts"`
+	Outbound       []AppEmbeddedConnection `json:"outbound"`
+}
+
+// AppEmbeddedConnection is an outbound connection made by an app-embedded app
+type AppEmbeddedConnection struct {
+	IP   string `json:"ip,omitempty"`
+	Port int    `json:"port,omitempty"`
+	Time string `json:"time,omitempty"`
 }
 
 // CloudMetadata represents cloud provider metadata
@@ -601,12 +647,12 @@ type AppEmbeddedRule struct {
 }
 
 type AppEmbeddedProcessRule struct {
-	Blacklist           []string `json:"blacklist,omitempty"`
-	BlockAllBinaries    bool     `json:"blockAllBinaries,omitempty"`
-	CheckCryptoMiners   bool     `json:"checkCryptoMiners,omitempty"`
-	CheckLateralMovement bool    `json:"checkLateralMovement,omitempty"`
-	CheckNewBinaries    bool     `json:"checkNewBinaries,omitempty"`
-	Effect              string   `json:"effect,omitempty"`
-	SkipModified        bool     `json:"skipModified,omitempty"`
-	Whitelist           []string `json:"whitelist,omitempty"`
+	Blacklist            []string `json:"blacklist,omitempty"`
+	BlockAllBinaries     bool     `json:"blockAllBinaries,omitempty"`
+	CheckCryptoMiners    bool     `json:"checkCryptoMiners,omitempty"`
+	CheckLateralMovement bool     `json:"checkLateralMovement,omitempty"`
+	CheckNewBinaries     bool     `json:"checkNewBinaries,omitempty"`
+	Effect               string   `json:"effect,omitempty"`
+	SkipModified         bool     `json:"skipModified,omitempty"`
+	Whitelist            []string `json:"whitelist,omitempty"`
 }
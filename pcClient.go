@@ -2,482 +2,546 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
-func login(accessKeyId, secretAccessKey string) (token string, err error) {
-	url := fmt.Sprintf("%s/authenticate", BASE_URL)
+// pageLimit is the page size used for every paginated Prisma Cloud endpoint
+const pageLimit = 100
+
+// fetchBodyExcerptLimit caps how much of an error response is kept in a FetchError
+const fetchBodyExcerptLimit = 256
+
+// FetchError describes where and why a paginated Prisma Cloud fetch stopped.
+// The fetcher still returns what it collected before the failure.
+type FetchError struct {
+	Endpoint    string `json:"endpoint"`
+	Offset      int    `json:"offset"`
+	StatusCode  int    `json:"status_code,omitempty"`
+	BodyExcerpt string `json:"body_excerpt,omitempty"`
+	Fetched     int    `json:"fetched"`
+	Err         error  `json:"-"`
+}
+
+func (e *FetchError) Error() string {
+	msg := fmt.Sprintf("fetching %s stopped at offset %d after %d items", e.Endpoint, e.Offset, e.Fetched)
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf(": HTTP %d", e.StatusCode)
+	}
+	if e.Err != nil {
+		msg += fmt.Sprintf(": %v", e.Err)
+	}
+	if e.BodyExcerpt != "" {
+		msg += fmt.Sprintf(": %s", e.BodyExcerpt)
+	}
+	return msg
+}
+
+func (e *FetchError) Unwrap() error {
+	return e.Err
+}
+
+// excerpt trims a response body to something that fits in an error message
+func excerpt(body []byte) string {
+	text := strings.TrimSpace(string(body))
+	if len(text) > fetchBodyExcerptLimit {
+		return text[:fetchBodyExcerptLimit] + "..."
+	}
+	return text
+}
+
+// Doer sends HTTP requests. Production uses RetryClient; any *http.Client,
+// e.g. the one of an httptest server, can be plugged in instead.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// endpoint describes a Prisma Cloud API path, its fixed query parameters and
+// the permission sent in the x-prisma-cloud-target-env header, if any
+type endpoint struct {
+	Name       string
+	Path       string
+	Permission string
+	Query      url.Values
+}
+
+var (
+	containerProfilesEndpoint = endpoint{
+		Name:  "container profiles",
+		Path:  "/profiles/container",
+		Query: url.Values{"state": {"active"}},
+	}
+	hostProfilesEndpoint = endpoint{
+		Name:  "host profiles",
+		Path:  "/profiles/host",
+		Query: url.Values{"state": {"active"}},
+	}
+	appEmbeddedProfilesEndpoint = endpoint{
+		Name:       "app-embedded profiles",
+		Path:       "/profiles/app-embedded",
+		Permission: "monitorRuntimeServerless",
+	}
+	containerPolicyEndpoint = endpoint{
+		Name:       "runtime container policy",
+		Path:       "/policies/runtime/container",
+		Permission: "policyRuntimeContainer",
+	}
+	hostPolicyEndpoint = endpoint{
+		Name:       "runtime host policy",
+		Path:       "/policies/runtime/host",
+		Permission: "policyRuntimeHosts",
+	}
+	appEmbeddedPolicyEndpoint = endpoint{
+		Name:       "app-embedded policy",
+		Path:       "/policies/runtime/app-embedded",
+		Permission: "policyRuntimeServerless",
+	}
+	alertsEndpoint = endpoint{
+		Name: "alerts",
+		Path: "/v2/alerts",
+	}
+)
+
+// PCClient talks to a single Prisma Cloud Compute console
+type PCClient struct {
+	BaseURL     string
+	HTTP        Doer
+	Session     *PCSession
+	PageWorkers int // pages fetched concurrently by paginate, 1 fetches them one by one
+
+	accessKeyId     string
+	secretAccessKey string
+}
+
+func NewPCClient(baseURL string, httpClient Doer, accessKeyId, secretAccessKey string) *PCClient {
+	client := &PCClient{
+		BaseURL:         strings.TrimRight(baseURL, "/"),
+		HTTP:            httpClient,
+		PageWorkers:     1,
+		accessKeyId:     accessKeyId,
+		secretAccessKey: secretAccessKey,
+	}
+	client.Session = NewPCSession(client.login)
+	return client
+}
+
+func (c *PCClient) login(ctx context.Context) (string, error) {
 	body := &AuthenticateRequest{
-		AccessKeyId:     accessKeyId,
-		SecretAccessKey: secretAccessKey,
+		AccessKeyId:     c.accessKeyId,
+		SecretAccessKey: c.secretAccessKey,
 	}
 
 	jsonBody, err := json.Marshal(body)
 	if err != nil {
-		return token, err
+		return "", err
 	}
 
-	client := &http.Client{}
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonBody))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+"/authenticate", bytes.NewReader(jsonBody))
 	if err != nil {
-		fmt.Println(err)
-		return token, err
+		return "", err
 	}
 
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("Accept", "application/json")
 
-	res, err := client.Do(req)
+	res, err := c.HTTP.Do(req)
 	if err != nil {
-		fmt.Println(err)
-		return token, err
+		return "", err
 	}
 	defer res.Body.Close()
 
 	resp, err := io.ReadAll(res.Body)
 	if err != nil {
-		fmt.Println(err)
-		return token, err
+		return "", err
 	}
 
-	var auth AuthenticateResponse
+	if res.StatusCode >= 400 {
+		return "", fmt.Errorf("HTTP %d: %s", res.StatusCode, excerpt(resp))
+	}
 
-	err = json.Unmarshal(resp, &auth)
-	if err != nil {
-		fmt.Println(err)
-		return token, err
+	var auth AuthenticateResponse
+	if err := json.Unmarshal(resp, &auth); err != nil {
+		return "", err
 	}
 
 	return auth.Token, nil
 }
 
-func getRuntimeContainerProfile(token string) (profiles []ContainerProfile, err error) {
-	const limit = 100
-	offset := 0
-	allProfiles := []ContainerProfile{}
-
-	for {
-		url := fmt.Sprintf("%s/profiles/container", BASE_URL)
-
-		client := &http.Client{}
-		req, err := http.NewRequest("GET", url, nil)
+// newRequest builds a request for ep with its permission header and query parameters
+func (c *PCClient) newRequest(ctx context.Context, method string, ep endpoint, query url.Values, body any) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		jsonBody, err := json.Marshal(body)
 		if err != nil {
-			fmt.Printf("Error creating request at offset %d: %v\n", offset, err)
-			return allProfiles, nil
+			return nil, err
 		}
+		reader = bytes.NewReader(jsonBody)
+	}
 
-		q := req.URL.Query()
-		q.Add("state", "active")
-		q.Add("limit", fmt.Sprintf("%d", limit))
-		q.Add("offset", fmt.Sprintf("%d", offset))
-		req.URL.RawQuery = q.Encode()
-
-		req.Header.Add("Content-Type", "application/json")
-		req.Header.Add("Accept", "application/json")
-		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
-
-		res, err := client.Do(req)
-		if err != nil {
-			fmt.Printf("Error fetching profiles at offset %d: %v\n", offset, err)
-			return allProfiles, nil
-		}
-
-		resp, err := io.ReadAll(res.Body)
-		res.Body.Close()
-		if err != nil {
-			fmt.Printf("Error reading response at offset %d: %v\n", offset, err)
-			return allProfiles, nil
-		}
-
-		var batchProfiles []ContainerProfile
-		err = json.Unmarshal(resp, &batchProfiles)
-		if err != nil {
-			fmt.Printf("Error unmarshaling response at offset %d: %v\n", offset, err)
-			return allProfiles, nil
-		}
-
-		// Add to all profiles
-		allProfiles = append(allProfiles, batchProfiles...)
-
-		fmt.Printf("Fetched %d profiles (total: %d)\n", len(batchProfiles), len(allProfiles))
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+ep.Path, reader)
+	if err != nil {
+		return nil, err
+	}
 
-		// Stop if we got fewer items than the limit
-		if len(batchProfiles) < limit {
-			fmt.Println("Reached end of profiles")
-			break
+	q := req.URL.Query()
+	for _, values := range []url.Values{ep.Query, query} {
+		for key, vs := range values {
+			for _, v := range vs {
+				q.Add(key, v)
+			}
 		}
+	}
+	req.URL.RawQuery = q.Encode()
 
-		// Move to next batch
-		offset += limit
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Accept", "application/json")
+	if ep.Permission != "" {
+		req.Header.Add("x-prisma-cloud-target-env", fmt.Sprintf(`{"permission":"%s"}`, ep.Permission))
 	}
 
-	return allProfiles, nil
+	return req, nil
 }
 
-func getRuntimeHostProfile(token string) (profiles []HostProfile, err error) {
-	const limit = 100
-	offset := 0
-	allProfiles := []HostProfile{}
-
-	for {
-		url := fmt.Sprintf("%s/profiles/host", BASE_URL)
-
-		client := &http.Client{}
-		req, err := http.NewRequest("GET", url, nil)
+// doAuthorized sends req with the session token. When Prisma Cloud answers 401
+// (e.g. the token expired mid-pagination) it re-authenticates and retries once.
+func (c *PCClient) doAuthorized(req *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		token, err := c.Session.Token(req.Context())
 		if err != nil {
-			fmt.Printf("Error creating request at offset %d: %v\n", offset, err)
-			return allProfiles, nil
+			return nil, err
 		}
 
-		q := req.URL.Query()
-		q.Add("state", "active")
-		q.Add("limit", fmt.Sprintf("%d", limit))
-		q.Add("offset", fmt.Sprintf("%d", offset))
-		req.URL.RawQuery = q.Encode()
-
-		req.Header.Add("Content-Type", "application/json")
-		req.Header.Add("Accept", "application/json")
-		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
-
-		res, err := client.Do(req)
-		if err != nil {
-			fmt.Printf("Error fetching host profiles at offset %d: %v\n", offset, err)
-			return allProfiles, nil
-		}
-
-		resp, err := io.ReadAll(res.Body)
-		res.Body.Close()
-		if err != nil {
-			fmt.Printf("Error reading response at offset %d: %v\n", offset, err)
-			return allProfiles, nil
+		if attempt > 0 {
+			req = req.Clone(req.Context())
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				req.Body = body
+			}
 		}
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
 
-		var batchProfiles []HostProfile
-		err = json.Unmarshal(resp, &batchProfiles)
+		res, err := c.HTTP.Do(req)
 		if err != nil {
-			fmt.Printf("Error unmarshaling response at offset %d: %v\n", offset, err)
-			return allProfiles, nil
+			return nil, err
 		}
 
-		// Add to all profiles
-		allProfiles = append(allProfiles, batchProfiles...)
-
-		fmt.Printf("Fetched %d host profiles (total: %d)\n", len(batchProfiles), len(allProfiles))
-
-		// Stop if we got fewer items than the limit
-		if len(batchProfiles) < limit {
-			fmt.Println("Reached end of host profiles")
-			break
+		if res.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			res.Body.Close()
+			c.Session.Invalidate(token)
+			logger.Println("Prisma Cloud token rejected, re-authenticating")
+			continue
 		}
 
-		// Move to next batch
-		offset += limit
+		return res, nil
 	}
-
-	return allProfiles, nil
 }
 
-func updateRuntimeContainerPolicy(token string, policy ContainerPolicy) error {
-	url := fmt.Sprintf("%s/policies/runtime/container", BASE_URL)
-
-	jsonBody, err := json.Marshal(policy)
+// send performs an authorized request and returns the response body, failing on HTTP errors
+func (c *PCClient) send(ctx context.Context, method string, ep endpoint, query url.Values, body any) ([]byte, error) {
+	req, err := c.newRequest(ctx, method, ep, query, body)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	client := &http.Client{}
-	req, err := http.NewRequest("PUT", url, bytes.NewBuffer(jsonBody))
+	res, err := c.doAuthorized(req)
 	if err != nil {
-		fmt.Printf("Error creating request: %v\n", err)
-		return err
-	}
-
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
-	req.Header.Add("x-prisma-cloud-target-env", `{"permission":"policyRuntimeContainer"}`)
-
-	res, err := client.Do(req)
-	if err != nil {
-		fmt.Printf("Error updating runtime container policy: %v\n", err)
-		return err
+		return nil, err
 	}
 	defer res.Body.Close()
 
 	resp, err := io.ReadAll(res.Body)
 	if err != nil {
-		fmt.Printf("Error reading response: %v\n", err)
-		return err
+		return nil, err
 	}
 
 	if res.StatusCode >= 400 {
-		return fmt.Errorf("failed to update policy: %s", string(resp))
+		return resp, fmt.Errorf("%s %s: HTTP %d: %s", method, ep.Path, res.StatusCode, excerpt(resp))
 	}
 
-	fmt.Printf("Successfully updated runtime container policy\n")
-	return nil
+	return resp, nil
 }
 
-func getAllRuntimeContainerPolicies(token string) (ContainerPolicy, error) {
-	var policy ContainerPolicy
-
-	url := fmt.Sprintf("%s/policies/runtime/container", BASE_URL)
-
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		fmt.Printf("Error creating request: %v\n", err)
-		return policy, err
-	}
-
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
-	req.Header.Add("x-prisma-cloud-target-env", `{"permission":"policyRuntimeContainer"}`)
-
-	res, err := client.Do(req)
-	if err != nil {
-		fmt.Printf("Error fetching runtime container policies: %v\n", err)
-		return policy, err
-	}
-	defer res.Body.Close()
-
-	resp, err := io.ReadAll(res.Body)
+// getJSON fetches ep and decodes the response into out
+func (c *PCClient) getJSON(ctx context.Context, ep endpoint, out any) error {
+	resp, err := c.send(ctx, http.MethodGet, ep, nil, nil)
 	if err != nil {
-		fmt.Printf("Error reading response: %v\n", err)
-		return policy, err
+		return err
 	}
 
-	err = json.Unmarshal(resp, &policy)
-	if err != nil {
-		fmt.Printf("Error unmarshaling response: %v\n", err)
-		return policy, err
+	if err := json.Unmarshal(resp, out); err != nil {
+		return fmt.Errorf("failed to decode %s: %v", ep.Name, err)
 	}
 
-	fmt.Printf("Successfully fetched runtime container policy with %d rules\n", len(policy.Rules))
-	return policy, nil
+	return nil
 }
 
-func getAllRuntimeHostPolicies(token string) (HostPolicy, error) {
-	var policy HostPolicy
+// pageResult is one fetched page, or the FetchError that stopped it
+type pageResult[T any] struct {
+	Items []T
+	Total int // Total-Count header, -1 when Prisma did not send it
+	Err   *FetchError
+}
 
-	url := fmt.Sprintf("%s/policies/runtime/host", BASE_URL)
+// fetchPage fetches the page of ep starting at offset
+func fetchPage[T any](ctx context.Context, c *PCClient, ep endpoint, query url.Values, offset int, decode func([]byte) ([]T, error)) pageResult[T] {
+	q := url.Values{}
+	for key, values := range query {
+		q[key] = values
+	}
+	q.Set("limit", fmt.Sprintf("%d", pageLimit))
+	q.Set("offset", fmt.Sprintf("%d", offset))
 
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := c.newRequest(ctx, http.MethodGet, ep, q, nil)
 	if err != nil {
-		fmt.Printf("Error creating request: %v\n", err)
-		return policy, err
+		return pageResult[T]{Err: &FetchError{Endpoint: ep.Path, Offset: offset, Err: err}}
 	}
 
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
-	req.Header.Add("x-prisma-cloud-target-env", `{"permission":"policyRuntimeHosts"}`)
-
-	res, err := client.Do(req)
+	res, err := c.doAuthorized(req)
 	if err != nil {
-		fmt.Printf("Error fetching runtime host policies: %v\n", err)
-		return policy, err
+		return pageResult[T]{Err: &FetchError{Endpoint: ep.Path, Offset: offset, Err: err}}
 	}
-	defer res.Body.Close()
 
 	resp, err := io.ReadAll(res.Body)
+	res.Body.Close()
 	if err != nil {
-		fmt.Printf("Error reading response: %v\n", err)
-		return policy, err
+		return pageResult[T]{Err: &FetchError{Endpoint: ep.Path, Offset: offset, StatusCode: res.StatusCode, Err: err}}
 	}
 
-	err = json.Unmarshal(resp, &policy)
-	if err != nil {
-		fmt.Printf("Error unmarshaling response: %v\n", err)
-		return policy, err
+	if res.StatusCode >= 400 {
+		return pageResult[T]{Err: &FetchError{Endpoint: ep.Path, Offset: offset, StatusCode: res.StatusCode, BodyExcerpt: excerpt(resp)}}
 	}
 
-	fmt.Printf("Successfully fetched runtime host policy with %d rules\n", len(policy.Rules))
-	return policy, nil
-}
-
-// getCSPMAlerts fetches CSPM alerts from Prisma Cloud filtered by compliance standard and cloud type
-func getCSPMAlerts(token, complianceStandard, cloudType string, detailed bool) ([]CSPMAlert, error) {
-	const limit = 100
-	offset := 0
-	allAlerts := []CSPMAlert{}
+	items, err := decode(resp)
+	if err != nil {
+		return pageResult[T]{Err: &FetchError{Endpoint: ep.Path, Offset: offset, StatusCode: res.StatusCode, BodyExcerpt: excerpt(resp), Err: err}}
+	}
 
-	for {
-		url := fmt.Sprintf("%s/v2/alerts", BASE_URL)
+	total := -1
+	if value, err := strconv.Atoi(res.Header.Get("Total-Count")); err == nil && value >= 0 {
+		total = value
+	}
 
-		client := &http.Client{}
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			fmt.Printf("Error creating request at offset %d: %v\n", offset, err)
-			return allAlerts, err
-		}
+	jobProgress(ctx).AddPage(len(items))
+	return pageResult[T]{Items: items, Total: total}
+}
 
-		q := req.URL.Query()
-		q.Add("complianceStandard", complianceStandard)
-		q.Add("cloud.type", cloudType)
-		if detailed {
-			q.Add("detailed", "true")
-		}
-		q.Add("timeType", "relative")
-		q.Add("timeAmount", "7")
-		q.Add("timeUnit", "day")
-		q.Add("limit", fmt.Sprintf("%d", limit))
-		q.Add("offset", fmt.Sprintf("%d", offset))
-		req.URL.RawQuery = q.Encode()
-
-		req.Header.Add("Content-Type", "application/json")
-		req.Header.Add("Accept", "application/json")
-		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
-
-		res, err := client.Do(req)
-		if err != nil {
-			fmt.Printf("Error fetching alerts at offset %d: %v\n", offset, err)
-			return allAlerts, err
-		}
+// paginate fetches every page of an offset/limit endpoint. The first page is
+// fetched alone; when Prisma reports a Total-Count the remaining pages are
+// fetched by up to PageWorkers concurrent workers, otherwise one after the
+// other until a page comes back shorter than pageLimit. Items are always
+// returned in offset order. On failure the pages before the failed one are
+// returned together with a *FetchError.
+func paginate[T any](ctx context.Context, c *PCClient, ep endpoint, query url.Values, decode func([]byte) ([]T, error)) ([]T, error) {
+	all := []T{}
+
+	first := fetchPage(ctx, c, ep, query, 0, decode)
+	if first.Err != nil {
+		return all, first.Err
+	}
+	all = append(all, first.Items...)
+	logger.Printf("Fetched %d %s (total: %d)\n", len(first.Items), ep.Name, len(all))
+
+	offset := pageLimit
+	if len(first.Items) == pageLimit && first.Total > pageLimit && c.PageWorkers > 1 {
+		pages := fetchPagesConcurrently(ctx, c, ep, query, first.Total, decode)
+		for i, page := range pages {
+			if page.Err != nil {
+				page.Err.Fetched = len(all)
+				return all, page.Err
+			}
+			all = append(all, page.Items...)
+			logger.Printf("Fetched %d %s (total: %d)\n", len(page.Items), ep.Name, len(all))
 
-		resp, err := io.ReadAll(res.Body)
-		res.Body.Close()
-		if err != nil {
-			fmt.Printf("Error reading alert response at offset %d: %v\n", offset, err)
-			return allAlerts, err
+			offset = pageLimit * (i + 2)
+			if len(page.Items) < pageLimit {
+				logger.Printf("Reached end of %s\n", ep.Name)
+				return all, nil
+			}
 		}
+		// Every page was full: more items appeared since the first page, so
+		// the rest is picked up sequentially below
+	} else if len(first.Items) < pageLimit {
+		logger.Printf("Reached end of %s\n", ep.Name)
+		return all, nil
+	}
 
-		// Try to parse as array first
-		var batchAlerts []CSPMAlert
-		err = json.Unmarshal(resp, &batchAlerts)
-		if err != nil {
-			// Try parsing as struct with items field (Prisma Cloud often returns {items: [...]})
-			var alertResponse struct {
-				Items []CSPMAlert `json:"items"`
-			}
-			err = json.Unmarshal(resp, &alertResponse)
-			if err != nil {
-				fmt.Printf("Error unmarshaling alert response at offset %d: %v\n", offset, err)
-				return allAlerts, err
-			}
-			batchAlerts = alertResponse.Items
+	for {
+		page := fetchPage(ctx, c, ep, query, offset, decode)
+		if page.Err != nil {
+			page.Err.Fetched = len(all)
+			return all, page.Err
 		}
 
-		// Add to all alerts
-		allAlerts = append(allAlerts, batchAlerts...)
+		all = append(all, page.Items...)
 
-		fmt.Printf("Fetched %d alerts (total: %d)\n", len(batchAlerts), len(allAlerts))
+		logger.Printf("Fetched %d %s (total: %d)\n", len(page.Items), ep.Name, len(all))
 
 		// Stop if we got fewer items than the limit
-		if len(batchAlerts) < limit {
-			fmt.Println("Reached end of alerts")
+		if len(page.Items) < pageLimit {
+			logger.Printf("Reached end of %s\n", ep.Name)
 			break
 		}
 
-		// Move to next batch
-		offset += limit
+		offset += pageLimit
 	}
 
-	return allAlerts, nil
+	return all, nil
 }
 
-func getAppEmbeddedProfile(token string) (profiles []AppEmbeddedProfile, err error) {
-	const limit = 100
-	offset := 0
-	allProfiles := []AppEmbeddedProfile{}
-
-	for {
-		url := fmt.Sprintf("%s/profiles/app-embedded", BASE_URL)
+// fetchPagesConcurrently fetches the pages after the first one up to total
+// items, indexed by page so the caller can reassemble them in order. Pages are
+// handed out in order and none are started after a failure, so every page
+// before the first failed one has been fetched. Requests already in flight
+// are not cancelled, so that earlier pages are not lost to a later failure.
+func fetchPagesConcurrently[T any](ctx context.Context, c *PCClient, ep endpoint, query url.Values, total int, decode func([]byte) ([]T, error)) []pageResult[T] {
+	count := (total - 1) / pageLimit // pages left after the first one
+	pages := make([]pageResult[T], count)
+
+	workers := c.PageWorkers
+	if workers > count {
+		workers = count
+	}
 
-		client := &http.Client{}
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			fmt.Printf("Error creating request at offset %d: %v\n", offset, err)
-			return allProfiles, nil
-		}
+	var failed atomic.Bool
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				pages[i] = fetchPage(ctx, c, ep, query, pageLimit*(i+1), decode)
+				if pages[i].Err != nil {
+					failed.Store(true)
+				}
+			}
+		}()
+	}
 
-		q := req.URL.Query()
-		q.Add("limit", fmt.Sprintf("%d", limit))
-		q.Add("offset", fmt.Sprintf("%d", offset))
-		req.URL.RawQuery = q.Encode()
+	for i := 0; i < count && !failed.Load(); i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
 
-		req.Header.Add("Content-Type", "application/json")
-		req.Header.Add("Accept", "application/json")
-		req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
-		req.Header.Add("x-prisma-cloud-target-env", `{"permission":"monitorRuntimeServerless"}`)
+	return pages
+}
 
-		res, err := client.Do(req)
-		if err != nil {
-			fmt.Printf("Error fetching app-embedded profiles at offset %d: %v\n", offset, err)
-			return allProfiles, nil
-		}
+// decodeJSONArray decodes pages of endpoints that return a plain JSON array
+func decodeJSONArray[T any](data []byte) ([]T, error) {
+	var items []T
+	err := json.Unmarshal(data, &items)
+	return items, err
+}
 
-		resp, err := io.ReadAll(res.Body)
-		res.Body.Close()
-		if err != nil {
-			fmt.Printf("Error reading response at offset %d: %v\n", offset, err)
-			return allProfiles, nil
-		}
+// decodeAlerts accepts a plain array as well as the {items: [...]} envelope Prisma Cloud often returns
+func decodeAlerts(data []byte) ([]CSPMAlert, error) {
+	var alerts []CSPMAlert
+	if err := json.Unmarshal(data, &alerts); err == nil {
+		return alerts, nil
+	}
 
-		var batchProfiles []AppEmbeddedProfile
-		err = json.Unmarshal(resp, &batchProfiles)
-		if err != nil {
-			fmt.Printf("Error unmarshaling response at offset %d: %v\n", offset, err)
-			return allProfiles, nil
-		}
+	var alertResponse struct {
+		Items []CSPMAlert `json:"items"`
+	}
+	if err := json.Unmarshal(data, &alertResponse); err != nil {
+		return nil, err
+	}
+	return alertResponse.Items, nil
+}
 
-		allProfiles = append(allProfiles, batchProfiles...)
+func (c *PCClient) GetContainerProfiles(ctx context.Context) ([]ContainerProfile, error) {
+	return paginate(ctx, c, containerProfilesEndpoint, nil, decodeJSONArray[ContainerProfile])
+}
 
-		fmt.Printf("Fetched %d app-embedded profiles (total: %d)\n", len(batchProfiles), len(allProfiles))
+func (c *PCClient) GetHostProfiles(ctx context.Context) ([]HostProfile, error) {
+	return paginate(ctx, c, hostProfilesEndpoint, nil, decodeJSONArray[HostProfile])
+}
 
-		if len(batchProfiles) < limit {
-			fmt.Println("Reached end of app-embedded profiles")
-			break
-		}
+func (c *PCClient) GetAppEmbeddedProfiles(ctx context.Context) ([]AppEmbeddedProfile, error) {
+	return paginate(ctx, c, appEmbeddedProfilesEndpoint, nil, decodeJSONArray[AppEmbeddedProfile])
+}
 
-		offset += limit
+// GetCSPMAlerts fetches the last 7 days of CSPM alerts filtered by compliance standard and cloud type
+func (c *PCClient) GetCSPMAlerts(ctx context.Context, complianceStandard, cloudType string, detailed bool) ([]CSPMAlert, error) {
+	query := url.Values{
+		"complianceStandard": {complianceStandard},
+		"cloud.type":         {cloudType},
+		"timeType":           {"relative"},
+		"timeAmount":         {"7"},
+		"timeUnit":           {"day"},
+	}
+	if detailed {
+		query.Set("detailed", "true")
 	}
 
-	return allProfiles, nil
+	return paginate(ctx, c, alertsEndpoint, query, decodeAlerts)
 }
 
-func getAppEmbeddedPolicy(token string) (AppEmbeddedPolicy, error) {
-	var policy AppEmbeddedPolicy
+func (c *PCClient) GetContainerPolicy(ctx context.Context) (ContainerPolicy, error) {
+	var policy ContainerPolicy
+	if err := c.getJSON(ctx, containerPolicyEndpoint, &policy); err != nil {
+		return policy, err
+	}
 
-	url := fmt.Sprintf("%s/policies/runtime/app-embedded", BASE_URL)
+	logger.Printf("Successfully fetched runtime container policy with %d rules\n", len(policy.Rules))
+	return policy, nil
+}
 
-	client := &http.Client{}
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		fmt.Printf("Error creating request: %v\n", err)
-		return policy, err
+func (c *PCClient) PutContainerPolicy(ctx context.Context, policy ContainerPolicy) error {
+	if _, err := c.send(ctx, http.MethodPut, containerPolicyEndpoint, nil, policy); err != nil {
+		return fmt.Errorf("failed to update policy: %v", err)
 	}
 
-	req.Header.Add("Content-Type", "application/json")
-	req.Header.Add("Accept", "application/json")
-	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", token))
-	req.Header.Add("x-prisma-cloud-target-env", `{"permission":"policyRuntimeServerless"}`)
+	logger.Printf("Successfully updated runtime container policy\n")
+	return nil
+}
 
-	res, err := client.Do(req)
-	if err != nil {
-		fmt.Printf("Error fetching app-embedded policy: %v\n", err)
+func (c *PCClient) GetHostPolicy(ctx context.Context) (HostPolicy, error) {
+	var policy HostPolicy
+	if err := c.getJSON(ctx, hostPolicyEndpoint, &policy); err != nil {
 		return policy, err
 	}
-	defer res.Body.Close()
 
-	resp, err := io.ReadAll(res.Body)
-	if err != nil {
-		fmt.Printf("Error reading response: %v\n", err)
-		return policy, err
+	logger.Printf("Successfully fetched runtime host policy with %d rules\n", len(policy.Rules))
+	return policy, nil
+}
+
+func (c *PCClient) PutHostPolicy(ctx context.Context, policy HostPolicy) error {
+	if _, err := c.send(ctx, http.MethodPut, hostPolicyEndpoint, nil, policy); err != nil {
+		return fmt.Errorf("failed to update policy: %v", err)
 	}
 
-	err = json.Unmarshal(resp, &policy)
-	if err != nil {
-		fmt.Printf("Error unmarshaling response: %v\n", err)
+	logger.Printf("Successfully updated runtime host policy\n")
+	return nil
+}
+
+func (c *PCClient) GetAppEmbeddedPolicy(ctx context.Context) (AppEmbeddedPolicy, error) {
+	var policy AppEmbeddedPolicy
+	if err := c.getJSON(ctx, appEmbeddedPolicyEndpoint, &policy); err != nil {
 		return policy, err
 	}
 
-	fmt.Printf("Successfully fetched app-embedded policy with %d rules\n", len(policy.Rules))
-
+	logger.Printf("Successfully fetched app-embedded policy with %d rules\n", len(policy.Rules))
 	return policy, nil
 }
+
+func (c *PCClient) PutAppEmbeddedPolicy(ctx context.Context, policy AppEmbeddedPolicy) error {
+	if _, err := c.send(ctx, http.MethodPut, appEmbeddedPolicyEndpoint, nil, policy); err != nil {
+		return fmt.Errorf("failed to update policy: %v", err)
+	}
+
+	logger.Printf("Successfully updated app-embedded policy\n")
+	return nil
+}
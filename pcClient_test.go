@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var itemsEndpoint = endpoint{Name: "items", Path: "/items"}
+
+// pagedServer serves count integers from /items by offset and limit. total
+// is sent as Total-Count unless negative; failAt answers the page at that
+// offset with a 500. Later pages answer faster, so concurrently fetched
+// pages complete out of order.
+func pagedServer(t *testing.T, count, total, failAt int) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/authenticate", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(AuthenticateResponse{Token: "token"})
+	})
+	mux.HandleFunc("/items", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+		limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+		time.Sleep(time.Duration(max(0, count-offset)/pageLimit) * time.Millisecond)
+
+		if offset == failAt {
+			http.Error(w, "console overloaded", http.StatusInternalServerError)
+			return
+		}
+		items := []int{}
+		for i := offset; i < min(offset+limit, count); i++ {
+			items = append(items, i)
+		}
+		if total >= 0 {
+			w.Header().Set("Total-Count", strconv.Itoa(total))
+		}
+		json.NewEncoder(w).Encode(items)
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func sequence(n int) []int {
+	items := make([]int, n)
+	for i := range items {
+		items[i] = i
+	}
+	return items
+}
+
+func TestPaginate(t *testing.T) {
+	tests := []struct {
+		name         string
+		count, total int
+		workers      int
+		wantRequests int32
+	}{
+		{"single page", 42, 42, 4, 1},
+		{"sequential without Total-Count", 250, -1, 4, 3},
+		{"concurrent in offset order", 950, 950, 4, 10},
+		{"one worker", 250, 250, 1, 3},
+		{"full pages ending on a page boundary", 300, -1, 4, 4},
+		{"more items than Total-Count", 450, 200, 4, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, requests := pagedServer(t, tt.count, tt.total, -1)
+			c := NewPCClient(server.URL, server.Client(), "id", "secret")
+			c.PageWorkers = tt.workers
+
+			items, err := paginate(context.Background(), c, itemsEndpoint, nil, decodeJSONArray[int])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(items, sequence(tt.count)) {
+				t.Errorf("got %d items out of order or missing: %v", len(items), items)
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestPaginateFailedPage(t *testing.T) {
+	for _, workers := range []int{1, 4} {
+		t.Run("workers "+strconv.Itoa(workers), func(t *testing.T) {
+			server, _ := pagedServer(t, 950, 950, 300)
+			c := NewPCClient(server.URL, server.Client(), "id", "secret")
+			c.PageWorkers = workers
+
+			items, err := paginate(context.Background(), c, itemsEndpoint, nil, decodeJSONArray[int])
+			var fetchErr *FetchError
+			if !errors.As(err, &fetchErr) {
+				t.Fatalf("err = %v, want a *FetchError", err)
+			}
+			want := FetchError{Endpoint: "/items", Offset: 300, StatusCode: http.StatusInternalServerError, BodyExcerpt: "console overloaded", Fetched: 300}
+			if *fetchErr != want {
+				t.Errorf("err = %+v, want %+v", *fetchErr, want)
+			}
+			if !slices.Equal(items, sequence(300)) {
+				t.Errorf("got %d items, want the 300 before the failed page", len(items))
+			}
+		})
+	}
+}
+
+func TestDoAuthorizedRenewsRejectedToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		rejected   int // tokens the console rejects before accepting one
+		wantStatus int
+		wantLogins int32
+	}{
+		{"valid token", 0, http.StatusOK, 1},
+		{"expired token", 1, http.StatusOK, 2},
+		{"retried only once", 2, http.StatusUnauthorized, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logins atomic.Int32
+			mux := http.NewServeMux()
+			mux.HandleFunc("/authenticate", func(w http.ResponseWriter, r *http.Request) {
+				n := logins.Add(1)
+				json.NewEncoder(w).Encode(AuthenticateResponse{Token: "token-" + strconv.Itoa(int(n))})
+			})
+			mux.HandleFunc("/items", func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer token-"+strconv.Itoa(tt.rejected+1) {
+					http.Error(w, "token expired", http.StatusUnauthorized)
+					return
+				}
+				w.Write([]byte("[]"))
+			})
+			server := httptest.NewServer(mux)
+			defer server.Close()
+
+			c := NewPCClient(server.URL, server.Client(), "id", "secret")
+			req, err := c.newRequest(context.Background(), http.MethodGet, itemsEndpoint, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := c.doAuthorized(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res.Body.Close()
+
+			if res.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", res.StatusCode, tt.wantStatus)
+			}
+			if got := logins.Load(); got != tt.wantLogins {
+				t.Errorf("logins = %d, want %d", got, tt.wantLogins)
+			}
+		})
+	}
+}
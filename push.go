@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// previewTTL is how long a dry-run preview can be confirmed
+const previewTTL = time.Hour
+
+var (
+	errPreviewNotFound = errors.New("preview not found")
+	errPreviewExpired  = errors.New("preview expired, run a new dry run")
+	errPreviewApplied  = errors.New("preview was already applied")
+	errPreviewStale    = errors.New("the live policy or the cached rules changed since the preview, run a new dry run")
+)
+
+// verdictPlan is a runtime policy change prepared from reviewed verdicts.
+// Planning writes nothing: the synced policy and Prisma Cloud only change when
+// the plan is applied.
+type verdictPlan struct {
+	Tenant    string
+	Kind      string
+	Applied   int            // verdict entries written into a rule
+	Live      any            // the policy in Prisma Cloud when planning
+	Policy    any            // the full policy to PUT, nil when no verdict applies
+	Conflicts []RuleConflict // rules changed in the console since the last sync
+	Shadowed  []ShadowedRule // live rules the new rules are placed ahead of
+}
+
+// planPolicy merges verdicts into the live rules of a policy, checked against
+// the rules of the last synced one
+func planPolicy[R runtimeRule](repo *Repo, plan *verdictPlan, live []R, verdicts []CapabilitiesCSVHeader, newRule func(collection string) R, apply func(rule *R, v CapabilitiesCSVHeader) (bool, error)) ([]R, error) {
+	var policy struct {
+		Rules []R `json:"rules"`
+	}
+	found, err := repo.GetSyncedPolicy(plan.Tenant, plan.Kind, &policy)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("no synced %s runtime policy for tenant %s, sync the policy before pushing verdicts", plan.Kind, plan.Tenant)
+	}
+
+	merge, err := mergeRules(policy.Rules, live, verdicts, newRule, apply)
+	if err != nil {
+		return nil, err
+	}
+	plan.Applied = merge.Applied
+	plan.Conflicts = merge.Conflicts
+	plan.Shadowed = merge.Shadowed
+	return merge.Rules, nil
+}
+
+// planVerdictPush fetches the live runtime policy of a profile kind and
+// prepares the change for its reviewed verdicts. Conflicting rules are
+// reported in the plan, which then has no policy to push.
+func (s *Service) planVerdictPush(ctx context.Context, tenant, kind string, verdicts []CapabilitiesCSVHeader) (verdictPlan, error) {
+	plan := verdictPlan{Tenant: tenant, Kind: kind}
+
+	if _, _, err := verdictTable(kind); err != nil {
+		return plan, err
+	}
+
+	client, err := s.client(tenant)
+	if err != nil {
+		return plan, err
+	}
+
+	switch kind {
+	case KindContainer:
+		live, err := client.GetContainerPolicy(ctx)
+		if err != nil {
+			return plan, fmt.Errorf("failed to get live %s policy: %v", kind, err)
+		}
+		rules, err := planPolicy(s.Repo, &plan, live.Rules, verdicts, newContainerRule, func(rule *ContainerRule, v CapabilitiesCSVHeader) (bool, error) {
+			return applyContainerVerdict(rule, v.Key, v.Value, v.Verdict, s.Cfg.VerdictDenyEffect)
+		})
+		if err != nil {
+			return plan, err
+		}
+		plan.Live = live
+		live.Rules = rules
+		plan.Policy = live
+	case KindHost:
+		live, err := client.GetHostPolicy(ctx)
+		if err != nil {
+			return plan, fmt.Errorf("failed to get live %s policy: %v", kind, err)
+		}
+		rules, err := planPolicy(s.Repo, &plan, live.Rules, verdicts, newHostRule, func(rule *HostRule, v CapabilitiesCSVHeader) (bool, error) {
+			return applyHostVerdict(rule, v.Key, v.Value, v.Verdict, s.Cfg.VerdictDenyEffect)
+		})
+		if err != nil {
+			return plan, err
+		}
+		plan.Live = live
+		live.Rules = rules
+		plan.Policy = live
+	case KindAppEmbedded:
+		live, err := client.GetAppEmbeddedPolicy(ctx)
+		if err != nil {
+			return plan, fmt.Errorf("failed to get live %s policy: %v", kind, err)
+		}
+		rules, err := planPolicy(s.Repo, &plan, live.Rules, verdicts, newAppEmbeddedRule, func(rule *AppEmbeddedRule, v CapabilitiesCSVHeader) (bool, error) {
+			return applyAppEmbeddedVerdict(rule, v.Key, v.Value, v.Verdict, s.Cfg.VerdictDenyEffect)
+		})
+		if err != nil {
+			return plan, err
+		}
+		plan.Live = live
+		live.Rules = rules
+		plan.Policy = live
+	}
+
+	if plan.Applied == 0 || len(plan.Conflicts) > 0 {
+		plan.Policy = nil
+	}
+	return plan, nil
+}
+
+// applyVerdictPlan pushes a planned policy to Prisma Cloud and, once it is
+// accepted, syncs the policy again so the next push merges against it. The
+// policy is kept in the snapshot history before and after the push.
+func (s *Service) applyVerdictPlan(ctx context.Context, plan verdictPlan) error {
+	if len(plan.Conflicts) > 0 {
+		return &PolicyConflictError{Kind: plan.Kind, Conflicts: plan.Conflicts}
+	}
+	if plan.Policy == nil {
+		logger.Printf("No reviewed %s verdicts to push to Prisma Cloud\n", plan.Kind)
+		return nil
+	}
+
+	if _, err := s.recordSnapshot(plan.Tenant, plan.Kind, SnapshotPushBefore, plan.Live); err != nil {
+		return err
+	}
+
+	if err := s.putPolicy(ctx, plan.Tenant, plan.Policy); err != nil {
+		return fmt.Errorf("failed to update %s runtime policy: %v", plan.Kind, err)
+	}
+
+	// Prisma Cloud stamps the changed rules with a new modified time, which
+	// the next push has to compare against
+	pushed, err := s.livePolicy(ctx, plan.Tenant, plan.Kind)
+	if err == nil {
+		_, err = s.storePolicy(plan.Tenant, plan.Kind, SnapshotPushAfter, pushed)
+	}
+	if err != nil {
+		return fmt.Errorf("policy was pushed but syncing it again failed, sync it before the next push: %v", err)
+	}
+
+	logger.Printf("Successfully pushed %d %s verdicts to Prisma Cloud\n", plan.Applied, plan.Kind)
+	return nil
+}
+
+// PushVerdicts merges reviewed verdicts of a profile kind into the live
+// runtime policy and pushes it to Prisma Cloud. It returns how many verdicts
+// changed a rule, or a *PolicyConflictError when rules they touch were
+// changed in the console since the last policy sync.
+func (s *Service) PushVerdicts(ctx context.Context, tenant, kind string, verdicts []CapabilitiesCSVHeader) (int, error) {
+	plan, err := s.planVerdictPush(ctx, tenant, kind, verdicts)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.applyVerdictPlan(ctx, plan); err != nil {
+		return 0, err
+	}
+	return plan.Applied, nil
+}
+
+// VerdictPreview is the outcome of a verdict import dry run: what pushing the
+// reviewed CSV would change in the live policy. Nothing is saved or pushed
+// until the preview is confirmed with its token.
+type VerdictPreview struct {
+	Token        string     `json:"token"`
+	Tenant       string     `json:"tenant"`
+	Kind         string     `json:"kind"`
+	TotalRecords int        `json:"total_records"`
+	Applied      int        `json:"applied"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	Diff         PolicyDiff `json:"diff"`
+	// Reviewer, Source and FileHash attribute the verdicts once the preview
+	// is confirmed
+	Reviewer string `json:"reviewer"`
+	Source   string `json:"source"`
+	FileHash string `json:"file_hash,omitempty"`
+	// Validation reports the rows of the previewed file
+	Validation *VerdictValidation `json:"validation,omitempty"`
+}
+
+// preparePreview plans the push of reviewed verdicts against the live policy
+// and fingerprints both, so a confirmation can tell whether either changed
+func (s *Service) preparePreview(ctx context.Context, tenant, kind string, records []CapabilitiesCSVHeader) (verdictPlan, PolicyDiff, string, error) {
+	for _, record := range records {
+		if err := checkVerdict(record); err != nil {
+			return verdictPlan{}, PolicyDiff{}, "", err
+		}
+	}
+
+	plan, err := s.planVerdictPush(ctx, tenant, kind, records)
+	if err != nil {
+		return plan, PolicyDiff{}, "", err
+	}
+	if len(plan.Conflicts) > 0 {
+		return plan, PolicyDiff{}, "", &PolicyConflictError{Kind: kind, Conflicts: plan.Conflicts}
+	}
+
+	live := plan.Live
+	proposed := plan.Policy
+	if proposed == nil {
+		proposed = live
+	}
+	diff, err := diffPolicies(live, proposed)
+	if err != nil {
+		return plan, diff, "", err
+	}
+	if plan.Policy != nil {
+		diff.Shadowed = plan.Shadowed
+	}
+
+	fingerprint, err := json.Marshal([]any{live, proposed})
+	if err != nil {
+		return plan, diff, "", err
+	}
+	sum := sha256.Sum256(fingerprint)
+	return plan, diff, hex.EncodeToString(sum[:]), nil
+}
+
+// PreviewVerdicts runs a verdict import as a dry run and stores it under a
+// confirm token. The verdicts, the rules cache and Prisma Cloud are left untouched.
+func (s *Service) PreviewVerdicts(ctx context.Context, tenant, kind string, records []CapabilitiesCSVHeader, provenance VerdictProvenance) (VerdictPreview, error) {
+	preview := VerdictPreview{Tenant: tenant, Kind: kind, TotalRecords: len(records), Reviewer: provenance.Reviewer, Source: provenance.Source, FileHash: provenance.FileHash}
+
+	plan, diff, fingerprint, err := s.preparePreview(ctx, tenant, kind, records)
+	if err != nil {
+		return preview, err
+	}
+	preview.Applied = plan.Applied
+	preview.Diff = diff
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return preview, err
+	}
+	preview.Token = hex.EncodeToString(token)
+
+	now := time.Now().UTC()
+	preview.ExpiresAt = now.Add(previewTTL)
+	if err := s.Repo.SavePreview(preview, records, fingerprint, now); err != nil {
+		return preview, fmt.Errorf("failed to save preview: %v", err)
+	}
+
+	logger.Printf("Previewed %d %s verdicts for tenant %s, confirm with token %s\n", plan.Applied, kind, tenant, preview.Token)
+	return preview, nil
+}
+
+// ConfirmVerdicts applies a previewed verdict import. It refuses when the live
+// policy or the cached rules changed since the preview, since the push would
+// then differ from the diff that was reviewed. The verdicts are attributed to
+// the reviewer and file of the preview, and approved by whoever confirms it.
+func (s *Service) ConfirmVerdicts(ctx context.Context, tenant, token, approver string) (VerdictImportResult, error) {
+	preview, records, fingerprint, appliedAt, err := s.Repo.GetPreview(token)
+	if err != nil {
+		return VerdictImportResult{Tenant: tenant}, err
+	}
+	if preview.Tenant != tenant {
+		return VerdictImportResult{Tenant: tenant}, errPreviewNotFound
+	}
+	result := VerdictImportResult{Tenant: tenant, Kind: preview.Kind, TotalRecords: len(records)}
+
+	if appliedAt != nil {
+		return result, errPreviewApplied
+	}
+	if time.Now().After(preview.ExpiresAt) {
+		return result, errPreviewExpired
+	}
+
+	_, _, current, err := s.preparePreview(ctx, tenant, preview.Kind, records)
+	if err != nil {
+		return result, err
+	}
+	if current != fingerprint {
+		return result, errPreviewStale
+	}
+
+	// Previews saved before reviewers were stored have none
+	reviewer := preview.Reviewer
+	if reviewer == "" {
+		reviewer = approver
+	}
+	provenance := VerdictProvenance{Reviewer: reviewer, Approver: approver, Source: preview.Source, FileHash: preview.FileHash}
+	result, err = s.ImportVerdicts(ctx, tenant, preview.Kind, records, true, provenance)
+	if err != nil || result.PCPushError != "" {
+		// Keep the preview confirmable so a failed push can be retried
+		return result, err
+	}
+
+	if err := s.Repo.MarkPreviewApplied(token, time.Now().UTC()); err != nil {
+		logger.Printf("Warning: failed to mark preview %s as applied: %v\n", token, err)
+	}
+	return result, nil
+}
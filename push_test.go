@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestRepo migrates a fresh in-memory database for one test
+func newTestRepo(t *testing.T) *Repo {
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	t.Setenv("DB_PATH", "file:"+name+"?mode=memory&cache=shared")
+	db, err := initDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return &Repo{DB: db}
+}
+
+// consoleStub answers the Prisma Cloud endpoints a test registers on its mux
+// and logs in anyone
+func consoleStub(t *testing.T, mux *http.ServeMux) *Service {
+	mux.HandleFunc("/authenticate", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(AuthenticateResponse{Token: "token"})
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return &Service{
+		Repo:    newTestRepo(t),
+		Tenants: []Tenant{{Name: defaultTenant}},
+		Clients: map[string]*PCClient{defaultTenant: NewPCClient(server.URL, server.Client(), "id", "secret")},
+	}
+}
+
+func TestFetchAndSaveAppEmbeddedProfiles(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/profiles/app-embedded", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]AppEmbeddedProfile{{
+			ID:          "p1",
+			AppID:       "checkout",
+			Collections: []string{"All", "payments"},
+			Image:       "checkout:1",
+			DNSQueries:  []DNSQuery{{DomainName: "api.example.com"}},
+			Processes:   []ProcessEntry{{Path: "/app/server"}, {Path: ""}},
+			Network: AppEmbeddedProfileNetwork{
+				ListeningPorts: []Port{{Port: 8080}},
+				Outbound:       []AppEmbeddedConnection{{IP: "10.0.0.5", Port: 5432}},
+			},
+		}})
+	})
+	service := consoleStub(t, mux)
+
+	if _, err := service.FetchAndSaveAppEmbeddedProfiles(context.Background(), defaultTenant, false); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := service.Repo.DB.Query(`SELECT collection_name, key, value FROM app_embedded_profiles ORDER BY key, value`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var collection, key, value string
+		if err := rows.Scan(&collection, &key, &value); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, collection+" "+key+"="+value)
+	}
+
+	want := []string{
+		"payments app_id=checkout",
+		"payments dns_queries=api.example.com",
+		"payments image=checkout:1",
+		"payments listening_port=8080",
+		"payments outbound_ip=10.0.0.5",
+		"payments outbound_port=5432",
+		"payments processes=/app/server",
+		"payments profile_id=p1",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("stored entries = %q\nwant %q", got, want)
+	}
+}
+
+func TestApplyAppEmbeddedVerdict(t *testing.T) {
+	tests := []struct {
+		name        string
+		key, value  string
+		verdict     string
+		want        func(rule *AppEmbeddedRule)
+		wantChanged bool
+	}{
+		{
+			name: "approved process", key: "processes", value: "/app/server", verdict: "legitimate",
+			want: func(rule *AppEmbeddedRule) { rule.Processes.Whitelist = []string{"/app/server"} }, wantChanged: true,
+		},
+		{
+			name: "approved domain", key: "dns_queries", value: "api.example.com", verdict: "legitimate",
+			want: func(rule *AppEmbeddedRule) { rule.DNS.DomainList.Allowed = []string{"api.example.com"} }, wantChanged: true,
+		},
+		{
+			name: "approved outbound ip", key: "outbound_ip", value: "10.0.0.5", verdict: "legitimate",
+			want: func(rule *AppEmbeddedRule) { rule.Network.AllowedIPs = []string{"10.0.0.5"} }, wantChanged: true,
+		},
+		{
+			name: "approved listening port", key: "listening_port", value: "8080", verdict: "legitimate",
+			want: func(rule *AppEmbeddedRule) {
+				rule.Network.ListeningPorts.Allowed = []ContainerPortObject{{Start: 8080, End: 8080}}
+			},
+			wantChanged: true,
+		},
+		{
+			name: "denied outbound port", key: "outbound_port", value: "25", verdict: "not_legitimate",
+			want: func(rule *AppEmbeddedRule) {
+				rule.Network.OutboundPorts.Denied = []ContainerPortObject{{Deny: true, Start: 25, End: 25}}
+				rule.Network.OutboundPorts.Effect = "prevent"
+			},
+			wantChanged: true,
+		},
+		{
+			name: "metadata is reviewed but not enforced", key: "image", value: "checkout:1", verdict: "legitimate",
+			want: func(rule *AppEmbeddedRule) {},
+		},
+		{
+			name: "not yet reviewed", key: "processes", value: "/app/server", verdict: "not_yet",
+			want: func(rule *AppEmbeddedRule) {},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := newAppEmbeddedRule("payments")
+			changed, err := applyAppEmbeddedVerdict(&rule, tt.key, tt.value, tt.verdict, "prevent")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changed != tt.wantChanged {
+				t.Errorf("changed = %v, want %v", changed, tt.wantChanged)
+			}
+			want := newAppEmbeddedRule("payments")
+			tt.want(&want)
+			if !reflect.DeepEqual(rule, want) {
+				t.Errorf("rule = %+v\nwant   %+v", rule, want)
+			}
+
+			// Applying it again changes nothing
+			if again, _ := applyAppEmbeddedVerdict(&rule, tt.key, tt.value, tt.verdict, "prevent"); again {
+				t.Error("applying the same verdict twice reported a change")
+			}
+		})
+	}
+
+	rule := newAppEmbeddedRule("payments")
+	if _, err := applyAppEmbeddedVerdict(&rule, "syscalls", "open", "legitimate", ""); err == nil {
+		t.Error("want an error for an unknown key")
+	}
+}
+
+func TestPushVerdictsAppEmbedded(t *testing.T) {
+	existing := newAppEmbeddedRule("payments-rule")
+	existing.Collections = []Collection{{Name: "payments"}}
+	existing.Modified = "2026-10-01T00:00:00Z"
+	existing.Processes.Whitelist = []string{"/bin/sh"}
+	catchAll := newAppEmbeddedRule("default-rule")
+	catchAll.Collections = []Collection{{Name: catchAllCollection}}
+	catchAll.Modified = "2026-10-01T00:00:00Z"
+	catchAll.Processes.Effect = "alert"
+
+	var mu sync.Mutex
+	live := AppEmbeddedPolicy{ID: appEmbeddedPolicyID, Rules: []AppEmbeddedRule{existing, catchAll}}
+	var pushed []AppEmbeddedPolicy
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/policies/runtime/app-embedded", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodPut {
+			var policy AppEmbeddedPolicy
+			if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			pushed = append(pushed, policy)
+			live = policy
+			return
+		}
+		json.NewEncoder(w).Encode(live)
+	})
+	service := consoleStub(t, mux)
+	if err := service.Repo.SaveSyncedPolicy(defaultTenant, KindAppEmbedded, live, time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+
+	verdicts := []CapabilitiesCSVHeader{
+		containerVerdict("payments", "processes", "/app/server", "legitimate"),
+		containerVerdict("payments", "processes", "/bin/sh", "legitimate"),
+		containerVerdict("payments", "app_id", "checkout", "legitimate"),
+		containerVerdict("billing", "dns_queries", "billing.example.com", "legitimate"),
+	}
+	applied, err := service.PushVerdicts(context.Background(), defaultTenant, KindAppEmbedded, verdicts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if applied != 2 {
+		t.Errorf("applied = %d, want 2", applied)
+	}
+	if len(pushed) != 1 {
+		t.Fatalf("pushed %d policies, want 1", len(pushed))
+	}
+
+	rules := pushed[0].Rules
+	var names []string
+	for _, rule := range rules {
+		names = append(names, rule.Name)
+	}
+	if !slices.Equal(names, []string{"billing", "payments-rule", "default-rule"}) {
+		t.Fatalf("rules = %q", names)
+	}
+	if !slices.Equal(rules[0].DNS.DomainList.Allowed, []string{"billing.example.com"}) || rules[0].Processes.Effect != "alert" {
+		t.Errorf("new rule = %+v, want the catch-all rule allowing billing.example.com", rules[0])
+	}
+	if !slices.Equal(rules[1].Processes.Whitelist, []string{"/bin/sh", "/app/server"}) {
+		t.Errorf("payments-rule whitelist = %q", rules[1].Processes.Whitelist)
+	}
+
+	// Everything is in place now, so the same verdicts push nothing
+	if applied, err := service.PushVerdicts(context.Background(), defaultTenant, KindAppEmbedded, verdicts); err != nil || applied != 0 {
+		t.Errorf("second push applied %d, %v", applied, err)
+	}
+	if len(pushed) != 1 {
+		t.Errorf("pushed %d policies, want no second push", len(pushed))
+	}
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPageSize bounds the limit of a query page
+const maxPageSize = 1000
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// ProfileQuery filters the stored entries of a profile kind. Empty fields
+// match everything; Value matches a substring of the entry value.
+type ProfileQuery struct {
+	Kind            string
+	Collection      string
+	Key             string
+	Verdict         string
+	Value           string
+	FirstSeenAfter  *time.Time
+	FirstSeenBefore *time.Time
+	LastSeenAfter   *time.Time
+	LastSeenBefore  *time.Time
+	Cursor          string
+	Limit           int
+}
+
+// ProfileEntry is a stored profile entry with its verdict. Host and
+// app-embedded entries carry their host_id or app_id as Source.
+type ProfileEntry struct {
+	ID         int64      `json:"id"`
+	Collection string     `json:"collection"`
+	Source     string     `json:"source,omitempty"`
+	Key        string     `json:"key"`
+	Value      string     `json:"value"`
+	Verdict    string     `json:"verdict"`
+	Remarks    string     `json:"remarks,omitempty"`
+	FirstSeen  *time.Time `json:"first_seen,omitempty"`
+	LastSeen   *time.Time `json:"last_seen,omitempty"`
+}
+
+// ProfileEntryPage is one page of profile entries. NextCursor is empty on the last page.
+type ProfileEntryPage struct {
+	Entries    []ProfileEntry `json:"entries"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// StoredPolicy is the rule stored for a collection by the last policy sync
+type StoredPolicy struct {
+	ID         int64           `json:"id"`
+	Collection string          `json:"collection"`
+	PolicyID   string          `json:"policy_id,omitempty"`
+	Rule       json.RawMessage `json:"rule"`
+	CreatedAt  *time.Time      `json:"created_at,omitempty"`
+}
+
+// StoredPolicyPage is one page of stored policies. NextCursor is empty on the last page.
+type StoredPolicyPage struct {
+	Policies   []StoredPolicy `json:"policies"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
+// CollectionCounts counts the entries of a collection by verdict
+type CollectionCounts struct {
+	Collection    string `json:"collection"`
+	Total         int    `json:"total"`
+	NotYet        int    `json:"not_yet"`
+	Legitimate    int    `json:"legitimate"`
+	NotLegitimate int    `json:"not_legitimate"`
+}
+
+// CollectionCountsPage is one page of collection counts, sorted by
+// collection. NextCursor is empty on the last page.
+type CollectionCountsPage struct {
+	Collections []CollectionCounts `json:"collections"`
+	NextCursor  string             `json:"next_cursor,omitempty"`
+}
+
+// encodeCursor makes an opaque cursor of the sort key of the last row of a
+// page. Pages are keyed by that value rather than an offset, so rows added or
+// removed while paging never shift or repeat the rows that follow.
+func encodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(key) == 0 {
+		return "", errInvalidCursor
+	}
+	return string(key), nil
+}
+
+// decodeIDCursor decodes the cursor of a page keyed by row id, 0 without a cursor
+func decodeIDCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	key, err := decodeCursor(cursor)
+	if err != nil {
+		return 0, err
+	}
+	id, err := strconv.ParseInt(key, 10, 64)
+	if err != nil || id < 1 {
+		return 0, errInvalidCursor
+	}
+	return id, nil
+}
+
+// QueryProfiles returns a page of the stored entries of a tenant matching the query, by id
+func (s *Service) QueryProfiles(tenant string, query ProfileQuery) (ProfileEntryPage, error) {
+	afterID, err := decodeIDCursor(query.Cursor)
+	if err != nil {
+		return ProfileEntryPage{}, err
+	}
+
+	// One extra row tells whether there is a next page
+	entries, err := s.Repo.QueryProfileEntries(tenant, query, afterID, query.Limit+1)
+	if err != nil {
+		return ProfileEntryPage{}, err
+	}
+
+	page := ProfileEntryPage{Entries: entries}
+	if len(entries) > query.Limit {
+		page.Entries = entries[:query.Limit]
+		page.NextCursor = encodeCursor(strconv.FormatInt(page.Entries[query.Limit-1].ID, 10))
+	}
+	return page, nil
+}
+
+// QueryPolicies returns a page of the rules stored per collection for a
+// profile kind, by id, optionally for one collection
+func (s *Service) QueryPolicies(tenant, kind, collection, cursor string, limit int) (StoredPolicyPage, error) {
+	afterID, err := decodeIDCursor(cursor)
+	if err != nil {
+		return StoredPolicyPage{}, err
+	}
+
+	policies, err := s.Repo.QueryStoredPolicies(tenant, kind, collection, afterID, limit+1)
+	if err != nil {
+		return StoredPolicyPage{}, err
+	}
+
+	page := StoredPolicyPage{Policies: policies}
+	if len(policies) > limit {
+		page.Policies = policies[:limit]
+		page.NextCursor = encodeCursor(strconv.FormatInt(page.Policies[limit-1].ID, 10))
+	}
+	return page, nil
+}
+
+// CountProfiles returns a page of the entry counts per collection of a
+// profile kind, optionally for one collection
+func (s *Service) CountProfiles(tenant, kind, collection, cursor string, limit int) (CollectionCountsPage, error) {
+	after := ""
+	if cursor != "" {
+		var err error
+		after, err = decodeCursor(cursor)
+		if err != nil {
+			return CollectionCountsPage{}, err
+		}
+	}
+
+	counts, err := s.Repo.CountProfileEntries(tenant, kind, collection, after, limit+1)
+	if err != nil {
+		return CollectionCountsPage{}, err
+	}
+
+	page := CollectionCountsPage{Collections: counts}
+	if len(counts) > limit {
+		page.Collections = counts[:limit]
+		page.NextCursor = encodeCursor(page.Collections[limit-1].Collection)
+	}
+	return page, nil
+}
+
+// parseQueryTime parses an RFC 3339 time or a date, read as midnight UTC
+func parseQueryTime(name, value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339Nano, time.DateOnly} {
+		if t, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			t = t.UTC()
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid %s: %q (use RFC 3339 or YYYY-MM-DD)", name, value)
+}
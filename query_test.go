@@ -0,0 +1,173 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// insertContainerEntry stores a container profile entry and returns its id
+func insertContainerEntry(t *testing.T, repo *Repo, tenant, collection, value, verdict string) int64 {
+	t.Helper()
+	result, err := repo.DB.Exec(`
+		INSERT INTO container_profiles (tenant, collection_name, key, value, verdict, updated_at)
+		VALUES (?, ?, 'processes', ?, ?, CURRENT_TIMESTAMP)
+	`, tenant, collection, value, verdict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// invalidCursors are cursors no page hands out
+var invalidCursors = map[string]string{
+	"not base64":  "!!!",
+	"not an id":   encodeCursor("payments"),
+	"zero id":     encodeCursor("0"),
+	"negative id": encodeCursor("-3"),
+}
+
+func TestQueryProfilesPages(t *testing.T) {
+	service := &Service{Repo: newTestRepo(t)}
+	for i := 1; i <= 5; i++ {
+		insertContainerEntry(t, service.Repo, defaultTenant, "payments", fmt.Sprintf("/bin/p%d", i), "not_yet")
+	}
+	insertContainerEntry(t, service.Repo, "other", "payments", "/bin/other", "not_yet")
+
+	query := ProfileQuery{Kind: KindContainer, Limit: 2}
+	var values []string
+	var pages int
+	for {
+		page, err := service.QueryProfiles(defaultTenant, query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages++
+		for _, entry := range page.Entries {
+			values = append(values, entry.Value)
+		}
+		if len(page.Entries) > query.Limit {
+			t.Fatalf("page of %d entries, limit %d", len(page.Entries), query.Limit)
+		}
+
+		// An entry learned while paging comes after the cursor, never repeating earlier ones
+		if pages == 1 {
+			insertContainerEntry(t, service.Repo, defaultTenant, "payments", "/bin/p6", "not_yet")
+		}
+
+		if page.NextCursor == "" {
+			break
+		}
+		query.Cursor = page.NextCursor
+	}
+
+	// The last page is exactly full, so only the extra row tells it is the last one
+	want := []string{"/bin/p1", "/bin/p2", "/bin/p3", "/bin/p4", "/bin/p5", "/bin/p6"}
+	if !slices.Equal(values, want) || pages != 3 {
+		t.Errorf("%d pages of %q, want 3 pages of %q", pages, values, want)
+	}
+
+	// A filter pages over the matching entries only
+	page, err := service.QueryProfiles(defaultTenant, ProfileQuery{Kind: KindContainer, Value: "p6", Limit: 2})
+	if err != nil || len(page.Entries) != 1 || page.NextCursor != "" {
+		t.Errorf("filtered page = %+v, %v, want only /bin/p6 without a cursor", page, err)
+	}
+
+	for name, cursor := range invalidCursors {
+		if _, err := service.QueryProfiles(defaultTenant, ProfileQuery{Kind: KindContainer, Cursor: cursor, Limit: 2}); !errors.Is(err, errInvalidCursor) {
+			t.Errorf("%s cursor = %v, want errInvalidCursor", name, err)
+		}
+	}
+}
+
+func TestQueryPoliciesPages(t *testing.T) {
+	service := &Service{Repo: newTestRepo(t)}
+	var rules []ContainerRule
+	for _, collection := range []string{"payments", "billing", "checkout"} {
+		rule := newContainerRule(collection)
+		rule.Name = collection + "-rule"
+		rules = append(rules, rule)
+	}
+	if err := service.Repo.SaveRules(defaultTenant, ContainerPolicy{Rules: rules}); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := service.QueryPolicies(defaultTenant, KindContainer, "", "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Policies) != 2 || first.NextCursor == "" {
+		t.Fatalf("first page = %+v, want 2 policies and a cursor", first)
+	}
+
+	last, err := service.QueryPolicies(defaultTenant, KindContainer, "", first.NextCursor, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(last.Policies) != 1 || last.NextCursor != "" || last.Policies[0].ID <= first.Policies[1].ID {
+		t.Errorf("last page = %+v, want the third policy without a cursor", last)
+	}
+
+	var collections []string
+	for _, policy := range append(first.Policies, last.Policies...) {
+		collections = append(collections, policy.Collection)
+	}
+	if !slices.Equal(collections, []string{"payments", "billing", "checkout"}) {
+		t.Errorf("collections = %q, want each stored rule once", collections)
+	}
+
+	for name, cursor := range invalidCursors {
+		if _, err := service.QueryPolicies(defaultTenant, KindContainer, "", cursor, 2); !errors.Is(err, errInvalidCursor) {
+			t.Errorf("%s cursor = %v, want errInvalidCursor", name, err)
+		}
+	}
+}
+
+func TestCountProfilesPages(t *testing.T) {
+	service := &Service{Repo: newTestRepo(t)}
+	for _, entry := range []struct{ collection, verdict string }{
+		{"billing", "legitimate"},
+		{"billing", "not_yet"},
+		{"checkout", "not_legitimate"},
+		{"payments", "not_yet"},
+	} {
+		insertContainerEntry(t, service.Repo, defaultTenant, entry.collection, "/bin/"+entry.verdict, entry.verdict)
+	}
+
+	first, err := service.CountProfiles(defaultTenant, KindContainer, "", "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []CollectionCounts{
+		{Collection: "billing", Total: 2, NotYet: 1, Legitimate: 1},
+		{Collection: "checkout", Total: 1, NotLegitimate: 1},
+	}
+	if !slices.Equal(first.Collections, want) || first.NextCursor == "" {
+		t.Fatalf("first page = %+v, want %+v and a cursor", first, want)
+	}
+
+	// Collections learned while paging show up only after the cursor
+	insertContainerEntry(t, service.Repo, defaultTenant, "analytics", "/bin/sh", "not_yet")
+	insertContainerEntry(t, service.Repo, defaultTenant, "shipping", "/bin/sh", "not_yet")
+
+	last, err := service.CountProfiles(defaultTenant, KindContainer, "", first.NextCursor, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []CollectionCounts{
+		{Collection: "payments", Total: 1, NotYet: 1},
+		{Collection: "shipping", Total: 1, NotYet: 1},
+	}
+	if !slices.Equal(last.Collections, want) || last.NextCursor != "" {
+		t.Errorf("last page = %+v, want %+v without a cursor", last, want)
+	}
+
+	if _, err := service.CountProfiles(defaultTenant, KindContainer, "", invalidCursors["not base64"], 2); !errors.Is(err, errInvalidCursor) {
+		t.Errorf("cursor = %v, want errInvalidCursor", err)
+	}
+}
@@ -6,7 +6,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
-	"slices"
 	"strings"
 	"time"
 )
@@ -15,23 +14,67 @@ type Repo struct {
 	DB *sql.DB
 }
 
-func (r *Repo) SaveProfiles(profiles []ContainerProfile) error {
+// seenUpsert refreshes last_seen of an entry observed again. previous_seen
+// keeps the sync it was seen in before, also when one sync sees it twice.
+const seenUpsert = `DO UPDATE SET
+		previous_seen = CASE WHEN last_seen = excluded.last_seen THEN previous_seen ELSE last_seen END,
+		last_seen = excluded.last_seen`
+
+// countFirstSeen counts the entries of a profile table first seen at seenAt
+func countFirstSeen(tx *sql.Tx, table, tenant string, seenAt time.Time) (int, error) {
+	var count int
+	err := tx.QueryRow(fmt.Sprintf(`
+		SELECT COUNT(*) FROM %s WHERE tenant = ? AND first_seen = ?
+	`, table), tenant, seenAt).Scan(&count)
+	return count, err
+}
+
+// SaveProfiles stores the entries of container profiles seen by the sync at
+// seenAt and returns how many were new
+func (r *Repo) SaveProfiles(tenant string, profiles []ContainerProfile, seenAt time.Time) (int, error) {
 	tx, err := r.DB.Begin()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer tx.Rollback()
 
 	stmt, err := tx.Prepare(`
-		INSERT OR IGNORE INTO container_profiles (collection_name, key, value, verdict, updated_at)
-		VALUES (?, ?, ?, 'not_yet', CURRENT_TIMESTAMP)
-	`)
+		INSERT INTO container_profiles (tenant, collection_name, key, value, verdict, updated_at, first_seen, last_seen)
+		VALUES (?, ?, ?, ?, 'not_yet', CURRENT_TIMESTAMP, ?, ?)
+		ON CONFLICT(tenant, collection_name, key, value) ` + seenUpsert + `
+		RETURNING id`)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer stmt.Close()
 
+	detailStmt, err := tx.Prepare(`
+		INSERT INTO container_profile_details (tenant, entry_id, image, namespace, cluster, user, ppath, command, md5, modified, interactive, first_seen, last_seen)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(entry_id, image, namespace, cluster, user, ppath, command, md5, modified, interactive)
+		DO UPDATE SET last_seen = excluded.last_seen`)
+	if err != nil {
+		return 0, err
+	}
+	defer detailStmt.Close()
+
 	for _, profile := range profiles {
+		// save stores an entry and the observation behind it: the workload of
+		// the profile and, for processes, how the process ran
+		save := func(collection, key, value string, proc *ProcessEntry) error {
+			var id int64
+			if err := stmt.QueryRow(tenant, collection, key, value, seenAt, seenAt).Scan(&id); err != nil {
+				return err
+			}
+
+			if proc == nil {
+				proc = &ProcessEntry{}
+			}
+			_, err := detailStmt.Exec(tenant, id, profile.Image, profile.Namespace, profile.Cluster,
+				proc.User, proc.PPath, proc.Command, proc.MD5, proc.Modified, proc.Interactive, seenAt, seenAt)
+			return err
+		}
+
 		// Filter collections to exclude "All"
 		collections := []string{}
 		for _, col := range profile.Collections {
@@ -49,9 +92,9 @@ func (r *Repo) SaveProfiles(profiles []ContainerProfile) error {
 			// Save DNS queries
 			for _, dns := range profile.Network.Behavioral.DNSQueries {
 				if dns.DomainName != "" {
-					_, err := stmt.Exec(collection, "dns_queries", dns.DomainName)
+					err := save(collection, "dns_queries", dns.DomainName, nil)
 					if err != nil {
-						return err
+						return 0, err
 					}
 				}
 			}
@@ -60,9 +103,9 @@ func (r *Repo) SaveProfiles(profiles []ContainerProfile) error {
 			for _, lp := range profile.Network.Behavioral.ListeningPorts {
 				for _, port := range lp.PortsData.Ports {
 					value := fmt.Sprintf("%d", port.Port)
-					_, err := stmt.Exec(collection, "listening_port", value)
+					err := save(collection, "listening_port", value, nil)
 					if err != nil {
-						return err
+						return 0, err
 					}
 				}
 			}
@@ -70,9 +113,9 @@ func (r *Repo) SaveProfiles(profiles []ContainerProfile) error {
 			// Save outbound ports
 			for _, port := range profile.Network.Behavioral.OutboundPorts.Ports {
 				value := fmt.Sprintf("%d", port.Port)
-				_, err := stmt.Exec(collection, "outbound_port", value)
+				err := save(collection, "outbound_port", value, nil)
 				if err != nil {
-					return err
+					return 0, err
 				}
 			}
 
@@ -81,9 +124,9 @@ func (r *Repo) SaveProfiles(profiles []ContainerProfile) error {
 				for _, port := range lp.PortsData.Ports {
 					if port.Port > 0 {
 						value := fmt.Sprintf("%d", port.Port)
-						_, err := stmt.Exec(collection, "listening_port_static", value)
+						err := save(collection, "listening_port_static", value, nil)
 						if err != nil {
-							return err
+							return 0, err
 						}
 					}
 				}
@@ -92,9 +135,9 @@ func (r *Repo) SaveProfiles(profiles []ContainerProfile) error {
 			// Save filesystem static entries
 			for _, fs := range profile.Filesystem.Static {
 				if fs.Path != "" {
-					_, err := stmt.Exec(collection, "filesystem_static", fs.Path)
+					err := save(collection, "filesystem_static", fs.Path, nil)
 					if err != nil {
-						return err
+						return 0, err
 					}
 				}
 			}
@@ -102,9 +145,9 @@ func (r *Repo) SaveProfiles(profiles []ContainerProfile) error {
 			// Save behavioral processes
 			for _, proc := range profile.Processes.Behavioral {
 				if proc.Path != "" {
-					_, err := stmt.Exec(collection, "process", proc.Path)
+					err := save(collection, "process", proc.Path, &proc)
 					if err != nil {
-						return err
+						return 0, err
 					}
 				}
 			}
@@ -112,60 +155,126 @@ func (r *Repo) SaveProfiles(profiles []ContainerProfile) error {
 			// Save static processes
 			for _, proc := range profile.Processes.Static {
 				if proc.Path != "" {
-					_, err := stmt.Exec(collection, "process", proc.Path)
+					err := save(collection, "process", proc.Path, &proc)
 					if err != nil {
-						return err
+						return 0, err
 					}
 				}
 			}
 		}
 	}
 
-	return tx.Commit()
+	saved, err := countFirstSeen(tx, "container_profiles", tenant, seenAt)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return saved, nil
 }
 
-func (r *Repo) SaveHostProfileRecords(records []HostProfileRecord) error {
+// SaveHostProfileRecords stores host profile records seen by the sync at
+// seenAt and returns how many were new
+func (r *Repo) SaveHostProfileRecords(tenant string, records []HostProfileRecord, seenAt time.Time) (int, error) {
 	tx, err := r.DB.Begin()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer tx.Rollback()
 
 	stmt, err := tx.Prepare(`
-		INSERT OR IGNORE INTO host_profiles (host_id, collection_name, key, value, created_at)
-		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
-	`)
+		INSERT INTO host_profiles (tenant, host_id, collection_name, key, value, verdict, created_at, updated_at, first_seen, last_seen)
+		VALUES (?, ?, ?, ?, ?, 'not_yet', CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?)
+		ON CONFLICT(tenant, host_id, collection_name, key, value) ` + seenUpsert)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer stmt.Close()
 
 	for _, record := range records {
-		_, err := stmt.Exec(record.HostID, record.CollectionName, record.Key, record.Value)
+		_, err := stmt.Exec(tenant, record.HostID, record.CollectionName, record.Key, record.Value, seenAt, seenAt)
 		if err != nil {
-			return err
+			return 0, err
 		}
 	}
 
-	return tx.Commit()
+	saved, err := countFirstSeen(tx, "host_profiles", tenant, seenAt)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return saved, nil
+}
+
+// Profile kinds that go through the verdict review loop
+const (
+	KindContainer   = "container"
+	KindHost        = "host"
+	KindAppEmbedded = "app-embedded"
+)
+
+var verdictKinds = []string{KindContainer, KindHost, KindAppEmbedded}
+
+// verdictTable returns the profile table holding the verdicts of a kind and,
+// for kinds whose entries belong to a host or app, the column naming it
+func verdictTable(kind string) (table, extraColumn string, err error) {
+	switch kind {
+	case KindContainer:
+		return "container_profiles", "", nil
+	case KindHost:
+		return "host_profiles", "host_id", nil
+	case KindAppEmbedded:
+		return "app_embedded_profiles", "app_id", nil
+	}
+	return "", "", fmt.Errorf("unknown profile kind: %s (valid: %s)", kind, strings.Join(verdictKinds, ", "))
 }
 
-func (r *Repo) ExportNotYetVerdict() (string, error) {
+// ExportNotYetVerdict writes the entries of a profile kind that still need a
+// verdict to a CSV file. Host and app-embedded entries carry their host_id or
+// app_id as an extra last column, so every file imports like a container one.
+// Container entries carry the summary of their observations instead. An empty
+// filename writes a timestamped file in the working directory.
+func (r *Repo) ExportNotYetVerdict(tenant, kind, filename string) (string, error) {
+	table, extraColumn, err := verdictTable(kind)
+	if err != nil {
+		return "", err
+	}
+
+	var details map[int64][]ProfileDetail
+	if kind == KindContainer {
+		details, err = r.listProfileDetails("p.tenant = ? AND p.verdict = 'not_yet'", tenant)
+		if err != nil {
+			return "", fmt.Errorf("failed to list profile details: %v", err)
+		}
+	}
+
+	extra := "''"
+	if extraColumn != "" {
+		extra = fmt.Sprintf("COALESCE(%s, '')", extraColumn)
+	}
+
 	// Query records with "not_yet" verdict
-	rows, err := r.DB.Query(`
-		SELECT id, collection_name, key, value, verdict, COALESCE(remarks, '') as remarks
-		FROM container_profiles
-		WHERE verdict = 'not_yet'
+	rows, err := r.DB.Query(fmt.Sprintf(`
+		SELECT id, collection_name, key, value, verdict, COALESCE(remarks, '') as remarks, %s
+		FROM %s
+		WHERE tenant = ? AND verdict = 'not_yet'
 		ORDER BY collection_name, key, value
-	`)
+	`, extra, table), tenant)
 	if err != nil {
 		return "", err
 	}
 	defer rows.Close()
 
 	// Create CSV file with timestamp
-	timestamp := time.Now().Format("20060102_150405")
-	filename := fmt.Sprintf("container_profiles_not_yet_%s.csv", timestamp)
+	if filename == "" {
+		timestamp := time.Now().Format("20060102_150405")
+		filename = fmt.Sprintf("%s_%s_not_yet_%s.csv", table, tenant, timestamp)
+	}
 
 	file, err := os.Create(filename)
 	if err != nil {
@@ -178,6 +287,12 @@ func (r *Repo) ExportNotYetVerdict() (string, error) {
 
 	// Write CSV header
 	header := []string{"id", "collection_name", "key", "value", "verdict", "remarks"}
+	if extraColumn != "" {
+		header = append(header, extraColumn)
+	}
+	if details != nil {
+		header = append(header, detailHeader...)
+	}
 	if err := writer.Write(header); err != nil {
 		return "", err
 	}
@@ -185,10 +300,10 @@ func (r *Repo) ExportNotYetVerdict() (string, error) {
 	// Write data rows
 	count := 0
 	for rows.Next() {
-		var id int
-		var collectionName, key, value, verdict, remarks string
+		var id int64
+		var collectionName, key, value, verdict, remarks, extraValue string
 
-		if err := rows.Scan(&id, &collectionName, &key, &value, &verdict, &remarks); err != nil {
+		if err := rows.Scan(&id, &collectionName, &key, &value, &verdict, &remarks, &extraValue); err != nil {
 			return "", err
 		}
 
@@ -200,6 +315,12 @@ func (r *Repo) ExportNotYetVerdict() (string, error) {
 			verdict,
 			remarks,
 		}
+		if extraColumn != "" {
+			row = append(row, extraValue)
+		}
+		if details != nil {
+			row = append(row, detailColumns(details[id])...)
+		}
 
 		if err := writer.Write(row); err != nil {
 			return "", err
@@ -211,35 +332,77 @@ func (r *Repo) ExportNotYetVerdict() (string, error) {
 		return "", err
 	}
 
-	fmt.Printf("Exported %d records to %s\n", count, filename)
+	logger.Printf("Exported %d %s records to %s\n", count, kind, filename)
 	return filename, nil
 }
 
-func (r *Repo) UpdateVerdicts(records []CapabilitiesCSVHeader) (int, error) {
+// checkVerdict validates the verdict value of a reviewed record
+func checkVerdict(record CapabilitiesCSVHeader) error {
+	if record.Verdict != "not_yet" && record.Verdict != "legitimate" && record.Verdict != "not_legitimate" {
+		return fmt.Errorf("invalid verdict value '%s' for ID %s. Must be: not_yet, legitimate, or not_legitimate", record.Verdict, record.ID)
+	}
+	return nil
+}
+
+// UpdateVerdicts stores reviewed verdicts of a profile kind and records each
+// changed verdict or remark in the verdict history under provenance
+func (r *Repo) UpdateVerdicts(tenant, kind string, records []CapabilitiesCSVHeader, provenance VerdictProvenance) (int, error) {
+	table, _, err := verdictTable(kind)
+	if err != nil {
+		return 0, err
+	}
+
 	tx, err := r.DB.Begin()
 	if err != nil {
 		return 0, err
 	}
 	defer tx.Rollback()
 
-	stmt, err := tx.Prepare(`
-		UPDATE container_profiles 
+	current, err := tx.Prepare(fmt.Sprintf(`
+		SELECT id, collection_name, key, value, COALESCE(verdict, ''), COALESCE(remarks, '')
+		FROM %s WHERE id = ? AND tenant = ?
+	`, table))
+	if err != nil {
+		return 0, err
+	}
+	defer current.Close()
+
+	stmt, err := tx.Prepare(fmt.Sprintf(`
+		UPDATE %s
 		SET verdict = ?, remarks = ?, updated_at = CURRENT_TIMESTAMP
-		WHERE id = ?
-	`)
+		WHERE id = ? AND tenant = ?
+	`, table))
 	if err != nil {
 		return 0, err
 	}
 	defer stmt.Close()
 
+	history, err := tx.Prepare(`
+		INSERT INTO verdict_history (tenant, kind, entry_id, collection_name, key, value, old_verdict, new_verdict, old_remarks, new_remarks, reviewer, approver, source, file_hash, changed_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return 0, err
+	}
+	defer history.Close()
+
+	changedAt := time.Now().UTC()
 	updatedCount := 0
 	for _, record := range records {
-		// Validate verdict value
-		if record.Verdict != "not_yet" && record.Verdict != "legitimate" && record.Verdict != "not_legitimate" {
-			return 0, fmt.Errorf("invalid verdict value '%s' for ID %s. Must be: not_yet, legitimate, or not_legitimate", record.Verdict, record.ID)
+		if err := checkVerdict(record); err != nil {
+			return 0, err
+		}
+
+		var change VerdictChange
+		err := current.QueryRow(record.ID, tenant).Scan(&change.EntryID, &change.Collection, &change.Key, &change.Value, &change.OldVerdict, &change.OldRemarks)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read record ID %s: %v", record.ID, err)
 		}
 
-		result, err := stmt.Exec(record.Verdict, record.Remarks, record.ID)
+		result, err := stmt.Exec(record.Verdict, record.Remarks, record.ID, tenant)
 		if err != nil {
 			return 0, fmt.Errorf("failed to update record ID %s: %v", record.ID, err)
 		}
@@ -252,17 +415,27 @@ func (r *Repo) UpdateVerdicts(records []CapabilitiesCSVHeader) (int, error) {
 		if rowsAffected > 0 {
 			updatedCount++
 		}
+
+		if change.OldVerdict == record.Verdict && change.OldRemarks == record.Remarks {
+			continue
+		}
+		_, err = history.Exec(tenant, kind, change.EntryID, change.Collection, change.Key, change.Value,
+			change.OldVerdict, record.Verdict, change.OldRemarks, record.Remarks,
+			provenance.Reviewer, provenance.Approver, provenance.Source, provenance.FileHash, changedAt)
+		if err != nil {
+			return 0, fmt.Errorf("failed to record history of ID %s: %v", record.ID, err)
+		}
 	}
 
 	if err := tx.Commit(); err != nil {
 		return 0, err
 	}
 
-	fmt.Printf("Updated %d records in database\n", updatedCount)
+	logger.Printf("Updated %d %s records in database\n", updatedCount, kind)
 	return updatedCount, nil
 }
 
-func (r *Repo) SaveRules(policy ContainerPolicy) error {
+func (r *Repo) SaveRules(tenant string, policy ContainerPolicy) error {
 	tx, err := r.DB.Begin()
 	if err != nil {
 		return err
@@ -270,8 +443,8 @@ func (r *Repo) SaveRules(policy ContainerPolicy) error {
 	defer tx.Rollback()
 
 	stmt, err := tx.Prepare(`
-		INSERT OR REPLACE INTO container_policies (collection_name, rule)
-		VALUES (?, ?)
+		INSERT OR REPLACE INTO container_policies (tenant, collection_name, rule)
+		VALUES (?, ?, ?)
 	`)
 	if err != nil {
 		return err
@@ -295,7 +468,7 @@ func (r *Repo) SaveRules(policy ContainerPolicy) error {
 				if err != nil {
 					return err
 				}
-				_, err = stmt.Exec(rule.Name, string(ruleJSON))
+				_, err = stmt.Exec(tenant, rule.Name, string(ruleJSON))
 				if err != nil {
 					return err
 				}
@@ -318,7 +491,7 @@ func (r *Repo) SaveRules(policy ContainerPolicy) error {
 			if err != nil {
 				return err
 			}
-			_, err = stmt.Exec(collectionName, string(ruleJSON))
+			_, err = stmt.Exec(tenant, collectionName, string(ruleJSON))
 			if err != nil {
 				return err
 			}
@@ -329,122 +502,7 @@ func (r *Repo) SaveRules(policy ContainerPolicy) error {
 	return tx.Commit()
 }
 
-// GetRuleByCollection retrieves a single rule from container_policies by collection name
-func (r *Repo) GetRuleByCollection(collectionName string) (ContainerRule, error) {
-	var ruleJSON string
-	err := r.DB.QueryRow(`
-		SELECT rule FROM container_policies WHERE collection_name = ?
-	`, collectionName).Scan(&ruleJSON)
-
-	if err == sql.ErrNoRows {
-		return ContainerRule{}, fmt.Errorf("no rule found for collection: %s", collectionName)
-	}
-	if err != nil {
-		return ContainerRule{}, err
-	}
-
-	var rule ContainerRule
-	if err := json.Unmarshal([]byte(ruleJSON), &rule); err != nil {
-		return ContainerRule{}, fmt.Errorf("failed to unmarshal rule: %v", err)
-	}
-
-	return rule, nil
-}
-
-// UpdateRuleWithVerdict updates a rule in container_policies with a new verdict value
-func (r *Repo) UpdateRuleWithVerdict(collectionName string, key string, value string) error {
-	// Get existing rule
-	rule, err := r.GetRuleByCollection(collectionName)
-	if err != nil {
-		// If rule doesn't exist, create a new one
-		if strings.Contains(err.Error(), "no rule found") {
-			rule = ContainerRule{
-				Name: collectionName,
-				DNS: DNSRule{
-					DomainList: DomainList{
-						Allowed: []string{},
-						Denied:  []string{},
-					},
-				},
-				Processes: ProcessRule{
-					AllowedList: []string{},
-					DeniedList:  DeniedList{Paths: []string{}},
-				},
-			}
-		} else {
-			return err
-		}
-	}
-
-	// Update the rule based on the key type
-	switch key {
-	case "dns_queries":
-		// Check if domain already exists in allowed list
-		if !slices.Contains(rule.DNS.DomainList.Allowed, value) {
-			rule.DNS.DomainList.Allowed = append(rule.DNS.DomainList.Allowed, value)
-			fmt.Printf("Added DNS allowed: %s to collection %s\n", value, collectionName)
-		}
-	case "processes", "process":
-		// Check if process already exists in allowed list
-		if !slices.Contains(rule.Processes.AllowedList, value) {
-			rule.Processes.AllowedList = append(rule.Processes.AllowedList, value)
-			fmt.Printf("Added process allowed: %s to collection %s\n", value, collectionName)
-		}
-	default:
-		return fmt.Errorf("unknown key type: %s", key)
-	}
-
-	// Marshal the updated rule back to JSON
-	ruleJSON, err := json.Marshal(rule)
-	if err != nil {
-		return fmt.Errorf("failed to marshal rule: %v", err)
-	}
-
-	// Update in database
-	_, err = r.DB.Exec(`
-		INSERT OR REPLACE INTO container_policies (collection_name, rule)
-		VALUES (?, ?)
-	`, collectionName, string(ruleJSON))
-
-	if err != nil {
-		return fmt.Errorf("failed to update rule: %v", err)
-	}
-
-	return nil
-}
-
-// GetAllRules retrieves all rules from container_policies table
-func (r *Repo) GetAllRules() ([]ContainerRule, error) {
-	rows, err := r.DB.Query(`
-		SELECT rule FROM container_policies
-	`)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var rules []ContainerRule
-	for rows.Next() {
-		var ruleJSON string
-		if err := rows.Scan(&ruleJSON); err != nil {
-			return nil, err
-		}
-
-		var rule ContainerRule
-		if err := json.Unmarshal([]byte(ruleJSON), &rule); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal rule: %v", err)
-		}
-		rules = append(rules, rule)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-
-	return rules, nil
-}
-
-func (r *Repo) SaveHostRules(policy HostPolicy) error {
+func (r *Repo) SaveHostRules(tenant string, policy HostPolicy) error {
 	tx, err := r.DB.Begin()
 	if err != nil {
 		return err
@@ -452,8 +510,8 @@ func (r *Repo) SaveHostRules(policy HostPolicy) error {
 	defer tx.Rollback()
 
 	stmt, err := tx.Prepare(`
-		INSERT OR REPLACE INTO host_policies (collection_name, rule)
-		VALUES (?, ?)
+		INSERT OR REPLACE INTO host_policies (tenant, collection_name, rule)
+		VALUES (?, ?, ?)
 	`)
 	if err != nil {
 		return err
@@ -477,7 +535,7 @@ func (r *Repo) SaveHostRules(policy HostPolicy) error {
 				if err != nil {
 					return err
 				}
-				_, err = stmt.Exec(rule.Name, string(ruleJSON))
+				_, err = stmt.Exec(tenant, rule.Name, string(ruleJSON))
 				if err != nil {
 					return err
 				}
@@ -500,7 +558,7 @@ func (r *Repo) SaveHostRules(policy HostPolicy) error {
 			if err != nil {
 				return err
 			}
-			_, err = stmt.Exec(collectionName, string(ruleJSON))
+			_, err = stmt.Exec(tenant, collectionName, string(ruleJSON))
 			if err != nil {
 				return err
 			}
@@ -511,35 +569,44 @@ func (r *Repo) SaveHostRules(policy HostPolicy) error {
 	return tx.Commit()
 }
 
-// SaveAppEmbeddedProfiles saves app-embedded profile records to the database
-func (r *Repo) SaveAppEmbeddedProfiles(records []AppEmbeddedProfileRecord) error {
+// SaveAppEmbeddedProfiles saves app-embedded profile records seen by the sync
+// at seenAt and returns how many were new
+func (r *Repo) SaveAppEmbeddedProfiles(tenant string, records []AppEmbeddedProfileRecord, seenAt time.Time) (int, error) {
 	tx, err := r.DB.Begin()
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer tx.Rollback()
 
 	stmt, err := tx.Prepare(`
-		INSERT OR REPLACE INTO app_embedded_profiles (profile_id, app_id, collection_name, key, value)
-		VALUES (?, ?, ?, ?, ?)
-	`)
+		INSERT INTO app_embedded_profiles (tenant, profile_id, app_id, collection_name, key, value, verdict, updated_at, first_seen, last_seen)
+		VALUES (?, ?, ?, ?, ?, ?, 'not_yet', CURRENT_TIMESTAMP, ?, ?)
+		ON CONFLICT(tenant, profile_id, collection_name, key, value) ` + seenUpsert)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer stmt.Close()
 
 	for _, record := range records {
-		_, err = stmt.Exec(record.ProfileID, record.AppID, record.CollectionName, record.Key, record.Value)
+		_, err := stmt.Exec(tenant, record.ProfileID, record.AppID, record.CollectionName, record.Key, record.Value, seenAt, seenAt)
 		if err != nil {
-			return err
+			return 0, err
 		}
 	}
 
-	return tx.Commit()
+	saved, err := countFirstSeen(tx, "app_embedded_profiles", tenant, seenAt)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return saved, nil
 }
 
 // SaveAppEmbeddedRules saves app-embedded policy rules to the database
-func (r *Repo) SaveAppEmbeddedRules(policy AppEmbeddedPolicy) error {
+func (r *Repo) SaveAppEmbeddedRules(tenant string, policy AppEmbeddedPolicy) error {
 	tx, err := r.DB.Begin()
 	if err != nil {
 		return err
@@ -547,8 +614,8 @@ func (r *Repo) SaveAppEmbeddedRules(policy AppEmbeddedPolicy) error {
 	defer tx.Rollback()
 
 	stmt, err := tx.Prepare(`
-		INSERT OR REPLACE INTO app_embedded_policies (policy_id, collection_name, rule)
-		VALUES (?, ?, ?)
+		INSERT OR REPLACE INTO app_embedded_policies (tenant, policy_id, collection_name, rule)
+		VALUES (?, ?, ?, ?)
 	`)
 	if err != nil {
 		return err
@@ -572,7 +639,7 @@ func (r *Repo) SaveAppEmbeddedRules(policy AppEmbeddedPolicy) error {
 				if err != nil {
 					return err
 				}
-				_, err = stmt.Exec(policy.ID, rule.Name, string(ruleJSON))
+				_, err = stmt.Exec(tenant, policy.ID, rule.Name, string(ruleJSON))
 				if err != nil {
 					return err
 				}
@@ -595,7 +662,7 @@ func (r *Repo) SaveAppEmbeddedRules(policy AppEmbeddedPolicy) error {
 			if err != nil {
 				return err
 			}
-			_, err = stmt.Exec(policy.ID, collectionName, string(ruleJSON))
+			_, err = stmt.Exec(tenant, policy.ID, collectionName, string(ruleJSON))
 			if err != nil {
 				return err
 			}
@@ -605,3 +672,1094 @@ func (r *Repo) SaveAppEmbeddedRules(policy AppEmbeddedPolicy) error {
 
 	return tx.Commit()
 }
+
+// SaveSyncedPolicy stores the full runtime policy of a profile kind as it is
+// in Prisma Cloud, replacing the previous one
+func (r *Repo) SaveSyncedPolicy(tenant, kind string, policy any, syncedAt time.Time) error {
+	policyJSON, err := json.Marshal(policy)
+	if err != nil {
+		return fmt.Errorf("failed to marshal policy: %v", err)
+	}
+
+	_, err = r.DB.Exec(`
+		INSERT INTO synced_policies (tenant, kind, policy, synced_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT(tenant, kind) DO UPDATE SET policy = excluded.policy, synced_at = excluded.synced_at
+	`, tenant, kind, string(policyJSON), syncedAt)
+	return err
+}
+
+// GetSyncedPolicy reads the last synced runtime policy of a profile kind into
+// policy and reports whether there was one
+func (r *Repo) GetSyncedPolicy(tenant, kind string, policy any) (bool, error) {
+	var policyJSON string
+	err := r.DB.QueryRow(`
+		SELECT policy FROM synced_policies WHERE tenant = ? AND kind = ?
+	`, tenant, kind).Scan(&policyJSON)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if err := json.Unmarshal([]byte(policyJSON), policy); err != nil {
+		return false, fmt.Errorf("failed to unmarshal synced %s policy: %v", kind, err)
+	}
+	return true, nil
+}
+
+// SavePreview stores a verdict import dry run with the records to apply on confirmation
+func (r *Repo) SavePreview(preview VerdictPreview, records []CapabilitiesCSVHeader, fingerprint string, createdAt time.Time) error {
+	recordsJSON, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	diffJSON, err := json.Marshal(preview.Diff)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.DB.Exec(`
+		INSERT INTO verdict_previews (token, tenant, kind, records, diff, applied, fingerprint, created_at, expires_at, reviewer, source, file_hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, preview.Token, preview.Tenant, preview.Kind, string(recordsJSON), string(diffJSON), preview.Applied, fingerprint, createdAt, preview.ExpiresAt,
+		preview.Reviewer, preview.Source, preview.FileHash)
+	return err
+}
+
+// GetPreview returns a stored dry run, its records and fingerprint, and when it was applied
+func (r *Repo) GetPreview(token string) (VerdictPreview, []CapabilitiesCSVHeader, string, *time.Time, error) {
+	var preview VerdictPreview
+	var recordsJSON, diffJSON, fingerprint string
+	var appliedAt sql.NullTime
+
+	err := r.DB.QueryRow(`
+		SELECT token, tenant, kind, records, diff, applied, fingerprint, expires_at, applied_at, reviewer, source, file_hash
+		FROM verdict_previews WHERE token = ?
+	`, token).Scan(&preview.Token, &preview.Tenant, &preview.Kind, &recordsJSON, &diffJSON, &preview.Applied, &fingerprint, &preview.ExpiresAt, &appliedAt,
+		&preview.Reviewer, &preview.Source, &preview.FileHash)
+	if err == sql.ErrNoRows {
+		return preview, nil, "", nil, errPreviewNotFound
+	}
+	if err != nil {
+		return preview, nil, "", nil, err
+	}
+
+	var records []CapabilitiesCSVHeader
+	if err := json.Unmarshal([]byte(recordsJSON), &records); err != nil {
+		return preview, nil, "", nil, fmt.Errorf("failed to unmarshal preview records: %v", err)
+	}
+	if err := json.Unmarshal([]byte(diffJSON), &preview.Diff); err != nil {
+		return preview, nil, "", nil, fmt.Errorf("failed to unmarshal preview diff: %v", err)
+	}
+	preview.TotalRecords = len(records)
+
+	if appliedAt.Valid {
+		return preview, records, fingerprint, &appliedAt.Time, nil
+	}
+	return preview, records, fingerprint, nil, nil
+}
+
+// MarkPreviewApplied records that a dry run was confirmed and pushed
+func (r *Repo) MarkPreviewApplied(token string, appliedAt time.Time) error {
+	_, err := r.DB.Exec(`UPDATE verdict_previews SET applied_at = ? WHERE token = ?`, appliedAt, token)
+	return err
+}
+
+// CreateJob records a newly queued job unless a job of the same tenant and type
+// is still queued or running, in this process or another sharing the database.
+// It then returns the id of that job instead.
+func (r *Repo) CreateJob(job Job) (string, error) {
+	for {
+		result, err := r.DB.Exec(`
+			INSERT INTO jobs (id, tenant, type, status, created_at)
+			SELECT ?, ?, ?, ?, ?
+			WHERE NOT EXISTS (SELECT 1 FROM jobs WHERE tenant = ? AND type = ? AND status IN (?, ?))
+		`, job.ID, job.Tenant, job.Type, job.Status, job.CreatedAt, job.Tenant, job.Type, JobQueued, JobRunning)
+		if err != nil {
+			return "", err
+		}
+		if inserted, err := result.RowsAffected(); err != nil || inserted == 1 {
+			return "", err
+		}
+
+		var activeID string
+		err = r.DB.QueryRow(`
+			SELECT id FROM jobs WHERE tenant = ? AND type = ? AND status IN (?, ?)
+			ORDER BY created_at LIMIT 1
+		`, job.Tenant, job.Type, JobQueued, JobRunning).Scan(&activeID)
+		// The active job finished in between, so try again
+		if err == sql.ErrNoRows {
+			continue
+		}
+		return activeID, err
+	}
+}
+
+// StartJob marks a job as running
+func (r *Repo) StartJob(id string, startedAt time.Time) error {
+	_, err := r.DB.Exec(`UPDATE jobs SET status = ?, started_at = ? WHERE id = ?`, JobRunning, startedAt, id)
+	return err
+}
+
+// FinishJob stores the outcome and final progress counters of a job
+func (r *Repo) FinishJob(id, status string, result []byte, errMsg string, pagesFetched, itemsFetched, rowsSaved int64, finishedAt time.Time) error {
+	var resultValue any
+	if result != nil {
+		resultValue = string(result)
+	}
+
+	_, err := r.DB.Exec(`
+		UPDATE jobs
+		SET status = ?, result = ?, error = ?, pages_fetched = ?, items_fetched = ?, rows_saved = ?, finished_at = ?
+		WHERE id = ?
+	`, status, resultValue, errMsg, pagesFetched, itemsFetched, rowsSaved, finishedAt, id)
+	return err
+}
+
+// FailUnfinishedJobs fails jobs that were queued or running when adam stopped
+func (r *Repo) FailUnfinishedJobs(reason string) (int, error) {
+	result, err := r.DB.Exec(`
+		UPDATE jobs SET status = ?, error = ?, finished_at = ?
+		WHERE status IN (?, ?)
+	`, JobFailed, reason, time.Now().UTC(), JobQueued, JobRunning)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := result.RowsAffected()
+	return int(count), err
+}
+
+const jobColumns = `id, tenant, type, status, pages_fetched, items_fetched, rows_saved, result, error, created_at, started_at, finished_at`
+
+// GetJob returns a job by id
+func (r *Repo) GetJob(id string) (Job, error) {
+	row := r.DB.QueryRow(`SELECT `+jobColumns+` FROM jobs WHERE id = ?`, id)
+
+	job, err := scanJob(row)
+	if err == sql.ErrNoRows {
+		return job, errJobNotFound
+	}
+	return job, err
+}
+
+// ListJobs returns the most recent jobs first, all tenants when tenant is empty
+func (r *Repo) ListJobs(tenant string, limit int) ([]Job, error) {
+	rows, err := r.DB.Query(`
+		SELECT `+jobColumns+` FROM jobs
+		WHERE ? = '' OR tenant = ?
+		ORDER BY created_at DESC
+		LIMIT ?
+	`, tenant, tenant, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []Job{}
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	return jobs, rows.Err()
+}
+
+func scanJob(row interface{ Scan(dest ...any) error }) (Job, error) {
+	var job Job
+	var result, errMsg sql.NullString
+	var startedAt, finishedAt sql.NullTime
+
+	err := row.Scan(&job.ID, &job.Tenant, &job.Type, &job.Status, &job.PagesFetched, &job.ItemsFetched, &job.RowsSaved,
+		&result, &errMsg, &job.CreatedAt, &startedAt, &finishedAt)
+	if err != nil {
+		return job, err
+	}
+
+	if result.Valid && result.String != "" {
+		job.Result = json.RawMessage(result.String)
+	}
+	job.Error = errMsg.String
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		job.FinishedAt = &finishedAt.Time
+		if startedAt.Valid {
+			job.DurationMs = finishedAt.Time.Sub(startedAt.Time).Milliseconds()
+		}
+	}
+
+	return job, nil
+}
+
+// GetScheduleRun returns when a scheduled operation last ran and its job, nil when it never ran
+func (r *Repo) GetScheduleRun(tenant, operation string) (*time.Time, string, error) {
+	var lastRunAt sql.NullTime
+	var lastJobID sql.NullString
+
+	err := r.DB.QueryRow(`
+		SELECT last_run_at, last_job_id FROM schedules WHERE tenant = ? AND operation = ?
+	`, tenant, operation).Scan(&lastRunAt, &lastJobID)
+	if err == sql.ErrNoRows {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	if !lastRunAt.Valid {
+		return nil, lastJobID.String, nil
+	}
+	return &lastRunAt.Time, lastJobID.String, nil
+}
+
+// SaveScheduleExpression records the cron expression of a scheduled operation
+func (r *Repo) SaveScheduleExpression(tenant, operation, expression string) error {
+	_, err := r.DB.Exec(`
+		INSERT INTO schedules (tenant, operation, expression, updated_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(tenant, operation) DO UPDATE SET expression = excluded.expression, updated_at = CURRENT_TIMESTAMP
+	`, tenant, operation, expression)
+	return err
+}
+
+// SaveScheduleRun records the scheduled time and job of the latest run of an operation
+func (r *Repo) SaveScheduleRun(tenant, operation string, scheduledAt time.Time, jobID string) error {
+	_, err := r.DB.Exec(`
+		UPDATE schedules SET last_run_at = ?, last_job_id = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE tenant = ? AND operation = ?
+	`, scheduledAt.UTC(), jobID, tenant, operation)
+	return err
+}
+
+// SavePolicySnapshot stores a version of a runtime policy and returns its id.
+// With skipUnchanged, a version equal to the latest one of its kind is not
+// stored again and its id is returned instead.
+func (r *Repo) SavePolicySnapshot(snapshot PolicySnapshot, skipUnchanged bool) (int64, error) {
+	if skipUnchanged {
+		var id int64
+		var fingerprint string
+		err := r.DB.QueryRow(`
+			SELECT id, fingerprint FROM policy_snapshots
+			WHERE tenant = ? AND kind = ?
+			ORDER BY id DESC LIMIT 1
+		`, snapshot.Tenant, snapshot.Kind).Scan(&id, &fingerprint)
+		if err != nil && err != sql.ErrNoRows {
+			return 0, err
+		}
+		if err == nil && fingerprint == snapshot.Fingerprint {
+			return id, nil
+		}
+	}
+
+	result, err := r.DB.Exec(`
+		INSERT INTO policy_snapshots (tenant, kind, source, policy, fingerprint, rules, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`, snapshot.Tenant, snapshot.Kind, snapshot.Source, string(snapshot.Policy), snapshot.Fingerprint, snapshot.Rules, snapshot.CreatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+const snapshotColumns = `id, tenant, kind, source, fingerprint, rules, created_at`
+
+// ListPolicySnapshots returns the most recent versions first, without their
+// policies, all kinds when kind is empty
+func (r *Repo) ListPolicySnapshots(tenant, kind string, limit int) ([]PolicySnapshot, error) {
+	rows, err := r.DB.Query(`
+		SELECT `+snapshotColumns+` FROM policy_snapshots
+		WHERE tenant = ? AND (? = '' OR kind = ?)
+		ORDER BY id DESC
+		LIMIT ?
+	`, tenant, kind, kind, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := []PolicySnapshot{}
+	for rows.Next() {
+		var snapshot PolicySnapshot
+		err := rows.Scan(&snapshot.ID, &snapshot.Tenant, &snapshot.Kind, &snapshot.Source, &snapshot.Fingerprint,
+			&snapshot.Rules, &snapshot.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, rows.Err()
+}
+
+// GetPolicySnapshot returns a version of a runtime policy of a tenant, policy included
+func (r *Repo) GetPolicySnapshot(tenant string, id int64) (PolicySnapshot, error) {
+	var snapshot PolicySnapshot
+	var policy string
+	err := r.DB.QueryRow(`
+		SELECT `+snapshotColumns+`, policy FROM policy_snapshots
+		WHERE tenant = ? AND id = ?
+	`, tenant, id).Scan(&snapshot.ID, &snapshot.Tenant, &snapshot.Kind, &snapshot.Source, &snapshot.Fingerprint,
+		&snapshot.Rules, &snapshot.CreatedAt, &policy)
+	if err == sql.ErrNoRows {
+		return snapshot, errSnapshotNotFound
+	}
+	if err != nil {
+		return snapshot, err
+	}
+
+	snapshot.Policy = json.RawMessage(policy)
+	return snapshot, nil
+}
+
+// RecordProfileSync records a profile sync of a kind and the drift since the
+// previous complete sync: entries first seen at seenAt are new, entries seen
+// again after missing the previous sync reappeared, and, when this sync is
+// complete, entries seen in the previous sync but not in this one disappeared.
+func (r *Repo) RecordProfileSync(tenant, kind string, seenAt time.Time, complete bool) (ProfileSync, error) {
+	sync := ProfileSync{Tenant: tenant, Kind: kind, SyncedAt: seenAt, Complete: complete}
+
+	table, _, err := verdictTable(kind)
+	if err != nil {
+		return sync, err
+	}
+
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return sync, err
+	}
+	defer tx.Rollback()
+
+	var previous sql.NullTime
+	err = tx.QueryRow(`
+		SELECT synced_at FROM profile_syncs
+		WHERE tenant = ? AND kind = ? AND complete = 1
+		ORDER BY id DESC LIMIT 1
+	`, tenant, kind).Scan(&previous)
+	if err != nil && err != sql.ErrNoRows {
+		return sync, err
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO profile_syncs (tenant, kind, synced_at, complete) VALUES (?, ?, ?, ?)
+	`, tenant, kind, seenAt, complete)
+	if err != nil {
+		return sync, err
+	}
+	if sync.ID, err = result.LastInsertId(); err != nil {
+		return sync, err
+	}
+
+	record := func(change, where string, args ...any) (int, error) {
+		result, err := tx.Exec(fmt.Sprintf(`
+			INSERT INTO profile_drift (sync_id, tenant, kind, entry_id, collection_name, key, value, change)
+			SELECT ?, tenant, ?, id, collection_name, key, value, ? FROM %s
+			WHERE tenant = ? AND %s
+		`, table, where), append([]any{sync.ID, kind, change, tenant}, args...)...)
+		if err != nil {
+			return 0, fmt.Errorf("failed to record %s entries: %v", change, err)
+		}
+		count, err := result.RowsAffected()
+		return int(count), err
+	}
+
+	if sync.New, err = record(DriftNew, "first_seen = ?", seenAt); err != nil {
+		return sync, err
+	}
+	if previous.Valid {
+		sync.PreviousSyncedAt = &previous.Time
+		sync.Reappeared, err = record(DriftReappeared, "last_seen = ? AND first_seen < ? AND previous_seen < ?", seenAt, seenAt, previous.Time)
+		if err != nil {
+			return sync, err
+		}
+		if complete {
+			sync.Disappeared, err = record(DriftDisappeared, "last_seen >= ? AND last_seen < ?", previous.Time, seenAt)
+			if err != nil {
+				return sync, err
+			}
+		}
+	}
+
+	_, err = tx.Exec(`
+		UPDATE profile_syncs SET new_count = ?, disappeared_count = ?, reappeared_count = ? WHERE id = ?
+	`, sync.New, sync.Disappeared, sync.Reappeared, sync.ID)
+	if err != nil {
+		return sync, err
+	}
+
+	return sync, tx.Commit()
+}
+
+const profileSyncColumns = `id, tenant, kind, synced_at, complete, new_count, disappeared_count, reappeared_count`
+
+func scanProfileSync(row interface{ Scan(dest ...any) error }) (ProfileSync, error) {
+	var sync ProfileSync
+	err := row.Scan(&sync.ID, &sync.Tenant, &sync.Kind, &sync.SyncedAt, &sync.Complete, &sync.New, &sync.Disappeared, &sync.Reappeared)
+	return sync, err
+}
+
+// GetProfileSync returns a profile sync of a tenant and kind, the latest one when id is 0
+func (r *Repo) GetProfileSync(tenant, kind string, id int64) (ProfileSync, error) {
+	row := r.DB.QueryRow(`
+		SELECT `+profileSyncColumns+` FROM profile_syncs
+		WHERE tenant = ? AND kind = ? AND (? = 0 OR id = ?)
+		ORDER BY id DESC LIMIT 1
+	`, tenant, kind, id, id)
+
+	sync, err := scanProfileSync(row)
+	if err == sql.ErrNoRows {
+		return sync, errProfileSyncNotFound
+	}
+	return sync, err
+}
+
+// ListDrift returns the drift entries of a profile sync with their current
+// verdict, by collection, all collections when collection is empty
+func (r *Repo) ListDrift(sync ProfileSync, collection string) ([]DriftEntry, error) {
+	table, _, err := verdictTable(sync.Kind)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.DB.Query(fmt.Sprintf(`
+		SELECT d.collection_name, d.key, d.value, d.change, COALESCE(p.verdict, ''), p.first_seen, p.last_seen
+		FROM profile_drift d LEFT JOIN %s p ON p.id = d.entry_id
+		WHERE d.sync_id = ? AND (? = '' OR d.collection_name = ?)
+		ORDER BY d.collection_name, d.change, d.key, d.value
+	`, table), sync.ID, collection, collection)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []DriftEntry{}
+	for rows.Next() {
+		var entry DriftEntry
+		var firstSeen, lastSeen sql.NullTime
+		err := rows.Scan(&entry.Collection, &entry.Key, &entry.Value, &entry.Change, &entry.Verdict, &firstSeen, &lastSeen)
+		if err != nil {
+			return nil, err
+		}
+		if firstSeen.Valid {
+			entry.FirstSeen = &firstSeen.Time
+		}
+		if lastSeen.Valid {
+			entry.LastSeen = &lastSeen.Time
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// ListUnemailedSyncs returns the profile syncs of a tenant whose new and
+// reappeared entries were not emailed yet, oldest first
+func (r *Repo) ListUnemailedSyncs(tenant string) ([]ProfileSync, error) {
+	rows, err := r.DB.Query(`
+		SELECT `+profileSyncColumns+` FROM profile_syncs
+		WHERE tenant = ? AND emailed_at IS NULL
+		ORDER BY id
+	`, tenant)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	syncs := []ProfileSync{}
+	for rows.Next() {
+		sync, err := scanProfileSync(rows)
+		if err != nil {
+			return nil, err
+		}
+		syncs = append(syncs, sync)
+	}
+
+	return syncs, rows.Err()
+}
+
+// MarkSyncsEmailed records that the drift of profile syncs was emailed
+func (r *Repo) MarkSyncsEmailed(ids []int64, emailedAt time.Time) error {
+	for _, id := range ids {
+		if _, err := r.DB.Exec(`UPDATE profile_syncs SET emailed_at = ? WHERE id = ?`, emailedAt, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// policyCollections lists the collections of every synced runtime policy of a
+// tenant. A rule without collections counts by its name, as in SaveRules.
+const policyCollections = `
+	WITH policy_collections(name) AS (
+		SELECT json_extract(c.value, '$.name')
+		FROM synced_policies p, json_each(p.policy, '$.rules') r, json_each(r.value, '$.collections') c
+		WHERE p.tenant = ?
+		UNION
+		SELECT json_extract(r.value, '$.name')
+		FROM synced_policies p, json_each(p.policy, '$.rules') r
+		WHERE p.tenant = ? AND COALESCE(json_array_length(r.value, '$.collections'), 0) = 0
+	)`
+
+// ListRetentionCandidates returns the entries of a profile kind a retention
+// run would remove. Entries of collections in no synced policy are archived,
+// which needs a synced policy of the kind so a kind never synced keeps its
+// entries. Entries still awaiting a verdict and unseen since cutoff are
+// purged; a zero cutoff disables purging.
+func (r *Repo) ListRetentionCandidates(tenant, kind string, archiveOrphaned bool, cutoff time.Time) ([]RetiredEntry, error) {
+	return listRetentionCandidates(r.DB, tenant, kind, archiveOrphaned, cutoff)
+}
+
+func listRetentionCandidates(db interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}, tenant, kind string, archiveOrphaned bool, cutoff time.Time) ([]RetiredEntry, error) {
+	table, extraColumn, err := verdictTable(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	owner := "''"
+	if extraColumn != "" {
+		owner = fmt.Sprintf("COALESCE(%s, '')", extraColumn)
+	}
+
+	orphaned := `? AND EXISTS (SELECT 1 FROM synced_policies WHERE tenant = ? AND kind = ?)
+		AND collection_name NOT IN (SELECT name FROM policy_collections WHERE name IS NOT NULL)`
+	unseen := `NOT ? AND verdict = 'not_yet' AND last_seen < ?`
+
+	rows, err := db.Query(fmt.Sprintf(policyCollections+`
+		SELECT id, collection_name, key, value, %s, COALESCE(verdict, ''), COALESCE(remarks, ''), first_seen, last_seen,
+			CASE WHEN %s THEN '%s' ELSE '%s' END
+		FROM %s
+		WHERE tenant = ? AND ((%s) OR (%s))
+		ORDER BY collection_name, key, value
+	`, owner, orphaned, RetentionArchived, RetentionPurged, table, orphaned, unseen),
+		tenant, tenant,
+		archiveOrphaned, tenant, kind,
+		tenant,
+		archiveOrphaned, tenant, kind,
+		cutoff.IsZero(), cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []RetiredEntry{}
+	for rows.Next() {
+		entry := RetiredEntry{Kind: kind}
+		var firstSeen, lastSeen sql.NullTime
+		err := rows.Scan(&entry.EntryID, &entry.Collection, &entry.Key, &entry.Value, &entry.Owner,
+			&entry.Verdict, &entry.Remarks, &firstSeen, &lastSeen, &entry.Action)
+		if err != nil {
+			return nil, err
+		}
+		if firstSeen.Valid {
+			entry.FirstSeen = &firstSeen.Time
+		}
+		if lastSeen.Valid {
+			entry.LastSeen = &lastSeen.Time
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// RetireProfileEntries removes the retention candidates of every profile kind
+// and logs them under a new retention run. Listing and removing share one
+// transaction, so an entry a sync sees again in between is never removed.
+func (r *Repo) RetireProfileEntries(run RetentionRun, cutoff time.Time) (RetentionRun, error) {
+	tx, err := r.DB.Begin()
+	if err != nil {
+		return run, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO retention_runs (tenant, ran_at, unseen_days, archive_orphaned) VALUES (?, ?, ?, ?)
+	`, run.Tenant, run.RanAt, run.Policy.UnseenDays, run.Policy.ArchiveOrphaned)
+	if err != nil {
+		return run, err
+	}
+	if run.ID, err = result.LastInsertId(); err != nil {
+		return run, err
+	}
+
+	run.Entries = []RetiredEntry{}
+	for _, kind := range verdictKinds {
+		table, _, err := verdictTable(kind)
+		if err != nil {
+			return run, err
+		}
+
+		entries, err := listRetentionCandidates(tx, run.Tenant, kind, run.Policy.ArchiveOrphaned, cutoff)
+		if err != nil {
+			return run, fmt.Errorf("failed to list %s retention candidates: %v", kind, err)
+		}
+
+		for _, entry := range entries {
+			_, err = tx.Exec(`
+				INSERT INTO retired_profile_entries (run_id, tenant, kind, action, entry_id, collection_name, key, value, owner, verdict, remarks, first_seen, last_seen)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, run.ID, run.Tenant, kind, entry.Action, entry.EntryID, entry.Collection, entry.Key, entry.Value,
+				entry.Owner, entry.Verdict, entry.Remarks, entry.FirstSeen, entry.LastSeen)
+			if err != nil {
+				return run, fmt.Errorf("failed to log %s entry %d: %v", kind, entry.EntryID, err)
+			}
+
+			_, err = tx.Exec(fmt.Sprintf(`DELETE FROM %s WHERE id = ?`, table), entry.EntryID)
+			if err == nil && kind == KindContainer {
+				_, err = tx.Exec(`DELETE FROM container_profile_details WHERE entry_id = ?`, entry.EntryID)
+			}
+			if err != nil {
+				return run, fmt.Errorf("failed to remove %s entry %d: %v", kind, entry.EntryID, err)
+			}
+
+			if entry.Action == RetentionArchived {
+				run.Archived++
+			} else {
+				run.Purged++
+			}
+		}
+		run.Entries = append(run.Entries, entries...)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE retention_runs SET purged_count = ?, archived_count = ? WHERE id = ?
+	`, run.Purged, run.Archived, run.ID)
+	if err != nil {
+		return run, err
+	}
+
+	return run, tx.Commit()
+}
+
+const retentionRunColumns = `id, tenant, ran_at, unseen_days, archive_orphaned, purged_count, archived_count`
+
+func scanRetentionRun(row interface{ Scan(dest ...any) error }) (RetentionRun, error) {
+	var run RetentionRun
+	err := row.Scan(&run.ID, &run.Tenant, &run.RanAt, &run.Policy.UnseenDays, &run.Policy.ArchiveOrphaned, &run.Purged, &run.Archived)
+	return run, err
+}
+
+// ListRetentionRuns returns the latest retention runs of a tenant, newest first
+func (r *Repo) ListRetentionRuns(tenant string, limit int) ([]RetentionRun, error) {
+	rows, err := r.DB.Query(`
+		SELECT `+retentionRunColumns+` FROM retention_runs
+		WHERE tenant = ?
+		ORDER BY id DESC LIMIT ?
+	`, tenant, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []RetentionRun{}
+	for rows.Next() {
+		run, err := scanRetentionRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+
+	return runs, rows.Err()
+}
+
+// GetRetentionRun returns a retention run of a tenant with the entries it removed
+func (r *Repo) GetRetentionRun(tenant string, id int64) (RetentionRun, error) {
+	run, err := scanRetentionRun(r.DB.QueryRow(`
+		SELECT `+retentionRunColumns+` FROM retention_runs WHERE tenant = ? AND id = ?
+	`, tenant, id))
+	if err == sql.ErrNoRows {
+		return run, errRetentionRunNotFound
+	}
+	if err != nil {
+		return run, err
+	}
+
+	rows, err := r.DB.Query(`
+		SELECT kind, action, entry_id, collection_name, key, value, owner, COALESCE(verdict, ''), COALESCE(remarks, ''), first_seen, last_seen
+		FROM retired_profile_entries
+		WHERE run_id = ?
+		ORDER BY kind, action, collection_name, key, value
+	`, id)
+	if err != nil {
+		return run, err
+	}
+	defer rows.Close()
+
+	run.Entries = []RetiredEntry{}
+	for rows.Next() {
+		var entry RetiredEntry
+		var firstSeen, lastSeen sql.NullTime
+		err := rows.Scan(&entry.Kind, &entry.Action, &entry.EntryID, &entry.Collection, &entry.Key, &entry.Value,
+			&entry.Owner, &entry.Verdict, &entry.Remarks, &firstSeen, &lastSeen)
+		if err != nil {
+			return run, err
+		}
+		if firstSeen.Valid {
+			entry.FirstSeen = &firstSeen.Time
+		}
+		if lastSeen.Valid {
+			entry.LastSeen = &lastSeen.Time
+		}
+		run.Entries = append(run.Entries, entry)
+	}
+
+	return run, rows.Err()
+}
+
+// listProfileDetails returns the observations of the container profile
+// entries matched by where, an expression over the entry as p, by entry id
+func (r *Repo) listProfileDetails(where string, args ...any) (map[int64][]ProfileDetail, error) {
+	rows, err := r.DB.Query(`
+		SELECT d.entry_id, d.image, d.namespace, d.cluster, d.user, d.ppath, d.command, d.md5, d.modified, d.interactive, d.first_seen, d.last_seen
+		FROM container_profile_details d JOIN container_profiles p ON p.id = d.entry_id
+		WHERE `+where+`
+		ORDER BY d.entry_id, d.image, d.user, d.ppath, d.command
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	details := make(map[int64][]ProfileDetail)
+	for rows.Next() {
+		var id int64
+		var d ProfileDetail
+		var firstSeen, lastSeen sql.NullTime
+		err := rows.Scan(&id, &d.Image, &d.Namespace, &d.Cluster, &d.User, &d.PPath, &d.Command, &d.MD5,
+			&d.Modified, &d.Interactive, &firstSeen, &lastSeen)
+		if err != nil {
+			return nil, err
+		}
+		if firstSeen.Valid {
+			d.FirstSeen = &firstSeen.Time
+		}
+		if lastSeen.Valid {
+			d.LastSeen = &lastSeen.Time
+		}
+		details[id] = append(details[id], d)
+	}
+
+	return details, rows.Err()
+}
+
+// GetProfileDetails returns a container profile entry of a tenant with its observations
+func (r *Repo) GetProfileDetails(tenant string, id int64) (ProfileEntryDetails, error) {
+	entry := ProfileEntryDetails{ID: id}
+	err := r.DB.QueryRow(`
+		SELECT collection_name, key, value, COALESCE(verdict, '') FROM container_profiles WHERE tenant = ? AND id = ?
+	`, tenant, id).Scan(&entry.Collection, &entry.Key, &entry.Value, &entry.Verdict)
+	if err == sql.ErrNoRows {
+		return entry, errProfileEntryNotFound
+	}
+	if err != nil {
+		return entry, err
+	}
+
+	details, err := r.listProfileDetails("p.tenant = ? AND p.id = ?", tenant, id)
+	if err != nil {
+		return entry, err
+	}
+	entry.Details = details[id]
+	if entry.Details == nil {
+		entry.Details = []ProfileDetail{}
+	}
+	return entry, nil
+}
+
+// ListVerdictHistory returns the verdict changes of a tenant matching filter, newest first
+func (r *Repo) ListVerdictHistory(tenant string, filter VerdictHistoryFilter) ([]VerdictChange, error) {
+	rows, err := r.DB.Query(`
+		SELECT id, kind, entry_id, collection_name, key, value, COALESCE(old_verdict, ''), new_verdict,
+			COALESCE(old_remarks, ''), COALESCE(new_remarks, ''), reviewer, approver, source, file_hash, changed_at
+		FROM verdict_history
+		WHERE tenant = ? AND kind = ?
+			AND (? = 0 OR entry_id = ?)
+			AND (? = '' OR collection_name = ?)
+			AND (? = '' OR value = ?)
+		ORDER BY id DESC LIMIT ?
+	`, tenant, filter.Kind, filter.EntryID, filter.EntryID, filter.Collection, filter.Collection, filter.Value, filter.Value, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	changes := []VerdictChange{}
+	for rows.Next() {
+		var c VerdictChange
+		err := rows.Scan(&c.ID, &c.Kind, &c.EntryID, &c.Collection, &c.Key, &c.Value, &c.OldVerdict, &c.NewVerdict,
+			&c.OldRemarks, &c.NewRemarks, &c.Reviewer, &c.Approver, &c.Source, &c.FileHash, &c.ChangedAt)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, c)
+	}
+
+	return changes, rows.Err()
+}
+
+// CreateAPIToken stores a named token by the hash of its secret and returns its id
+func (r *Repo) CreateAPIToken(token APIToken, secretHash string) (int64, error) {
+	result, err := r.DB.Exec(`
+		INSERT INTO api_tokens (name, secret_hash, scopes, created_at, expires_at) VALUES (?, ?, ?, ?, ?)
+	`, token.Name, secretHash, strings.Join(token.Scopes, ","), token.CreatedAt, token.ExpiresAt)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			return 0, fmt.Errorf("an active token named %s already exists", token.Name)
+		}
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+const apiTokenColumns = `id, name, scopes, created_at, expires_at, revoked_at, last_used_at`
+
+func scanAPIToken(row interface{ Scan(dest ...any) error }, extra ...any) (APIToken, error) {
+	var token APIToken
+	var scopes string
+	var expiresAt, revokedAt, lastUsedAt sql.NullTime
+	dest := append([]any{&token.ID, &token.Name, &scopes, &token.CreatedAt, &expiresAt, &revokedAt, &lastUsedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return token, err
+	}
+
+	token.Scopes = strings.Split(scopes, ",")
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	return token, nil
+}
+
+// GetAPIToken returns a token and the hash of its secret
+func (r *Repo) GetAPIToken(id int64) (APIToken, string, error) {
+	var hash string
+	token, err := scanAPIToken(r.DB.QueryRow(`
+		SELECT `+apiTokenColumns+`, secret_hash FROM api_tokens WHERE id = ?
+	`, id), &hash)
+	if err == sql.ErrNoRows {
+		return token, "", errTokenNotFound
+	}
+	return token, hash, err
+}
+
+// ListAPITokens returns every token, newest first
+func (r *Repo) ListAPITokens() ([]APIToken, error) {
+	rows, err := r.DB.Query(`SELECT ` + apiTokenColumns + ` FROM api_tokens ORDER BY id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []APIToken{}
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+
+	return tokens, rows.Err()
+}
+
+// RevokeAPIToken revokes a token, keeping the time of an earlier revocation
+func (r *Repo) RevokeAPIToken(id int64, revokedAt time.Time) (APIToken, error) {
+	_, err := r.DB.Exec(`UPDATE api_tokens SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, revokedAt, id)
+	if err != nil {
+		return APIToken{}, err
+	}
+
+	token, _, err := r.GetAPIToken(id)
+	return token, err
+}
+
+// TouchAPIToken records when a token was last used
+func (r *Repo) TouchAPIToken(id int64, usedAt time.Time) error {
+	_, err := r.DB.Exec(`UPDATE api_tokens SET last_used_at = ? WHERE id = ?`, usedAt, id)
+	return err
+}
+
+// QueryProfileEntries returns up to limit entries of a tenant matching the
+// query with an id above afterID, by id
+func (r *Repo) QueryProfileEntries(tenant string, query ProfileQuery, afterID int64, limit int) ([]ProfileEntry, error) {
+	table, extraColumn, err := verdictTable(query.Kind)
+	if err != nil {
+		return nil, err
+	}
+	source := "''"
+	if extraColumn != "" {
+		source = fmt.Sprintf("COALESCE(%s, '')", extraColumn)
+	}
+
+	where := []string{"tenant = ?", "id > ?"}
+	args := []any{tenant, afterID}
+	for _, filter := range []struct {
+		condition string
+		value     string
+	}{
+		{"collection_name = ?", query.Collection},
+		{"key = ?", query.Key},
+		{"COALESCE(verdict, 'not_yet') = ?", query.Verdict},
+		{"instr(value, ?) > 0", query.Value},
+	} {
+		if filter.value != "" {
+			where = append(where, filter.condition)
+			args = append(args, filter.value)
+		}
+	}
+	for _, filter := range []struct {
+		condition string
+		at        *time.Time
+	}{
+		{"first_seen >= ?", query.FirstSeenAfter},
+		{"first_seen < ?", query.FirstSeenBefore},
+		{"last_seen >= ?", query.LastSeenAfter},
+		{"last_seen < ?", query.LastSeenBefore},
+	} {
+		if filter.at != nil {
+			where = append(where, filter.condition)
+			args = append(args, *filter.at)
+		}
+	}
+	args = append(args, limit)
+
+	rows, err := r.DB.Query(fmt.Sprintf(`
+		SELECT id, collection_name, %s, key, value, COALESCE(verdict, 'not_yet'), COALESCE(remarks, ''), first_seen, last_seen
+		FROM %s
+		WHERE %s
+		ORDER BY id LIMIT ?
+	`, source, table, strings.Join(where, " AND ")), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []ProfileEntry{}
+	for rows.Next() {
+		var entry ProfileEntry
+		var firstSeen, lastSeen sql.NullTime
+		err := rows.Scan(&entry.ID, &entry.Collection, &entry.Source, &entry.Key, &entry.Value, &entry.Verdict, &entry.Remarks, &firstSeen, &lastSeen)
+		if err != nil {
+			return nil, err
+		}
+		if firstSeen.Valid {
+			entry.FirstSeen = &firstSeen.Time
+		}
+		if lastSeen.Valid {
+			entry.LastSeen = &lastSeen.Time
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+// GetProfileEntry returns a stored entry of a profile kind
+func (r *Repo) GetProfileEntry(tenant, kind string, id int64) (ProfileEntry, error) {
+	table, _, err := verdictTable(kind)
+	if err != nil {
+		return ProfileEntry{}, err
+	}
+
+	entry := ProfileEntry{ID: id}
+	err = r.DB.QueryRow(fmt.Sprintf(`
+		SELECT collection_name, key, value, COALESCE(verdict, 'not_yet'), COALESCE(remarks, '') FROM %s WHERE tenant = ? AND id = ?
+	`, table), tenant, id).Scan(&entry.Collection, &entry.Key, &entry.Value, &entry.Verdict, &entry.Remarks)
+	if err == sql.ErrNoRows {
+		return entry, errProfileEntryNotFound
+	}
+	return entry, err
+}
+
+// QueryStoredPolicies returns up to limit rules stored per collection for a
+// profile kind with an id above afterID, by id
+func (r *Repo) QueryStoredPolicies(tenant, kind, collection string, afterID int64, limit int) ([]StoredPolicy, error) {
+	var table, policyID string
+	switch kind {
+	case KindContainer:
+		table, policyID = "container_policies", "''"
+	case KindHost:
+		table, policyID = "host_policies", "''"
+	case KindAppEmbedded:
+		table, policyID = "app_embedded_policies", "policy_id"
+	default:
+		return nil, fmt.Errorf("unknown profile kind: %s (valid: %s)", kind, strings.Join(verdictKinds, ", "))
+	}
+
+	rows, err := r.DB.Query(fmt.Sprintf(`
+		SELECT id, collection_name, %s, rule, created_at
+		FROM %s
+		WHERE tenant = ? AND id > ? AND (? = '' OR collection_name = ?)
+		ORDER BY id LIMIT ?
+	`, policyID, table), tenant, afterID, collection, collection, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	policies := []StoredPolicy{}
+	for rows.Next() {
+		var policy StoredPolicy
+		var rule string
+		var createdAt sql.NullTime
+		if err := rows.Scan(&policy.ID, &policy.Collection, &policy.PolicyID, &rule, &createdAt); err != nil {
+			return nil, err
+		}
+		policy.Rule = json.RawMessage(rule)
+		if createdAt.Valid {
+			policy.CreatedAt = &createdAt.Time
+		}
+		policies = append(policies, policy)
+	}
+
+	return policies, rows.Err()
+}
+
+// CountProfileEntries counts the entries of a profile kind by verdict for up
+// to limit collections sorted after the collection named after
+func (r *Repo) CountProfileEntries(tenant, kind, collection, after string, limit int) ([]CollectionCounts, error) {
+	table, _, err := verdictTable(kind)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := r.DB.Query(fmt.Sprintf(`
+		SELECT collection_name, COUNT(*),
+			SUM(COALESCE(verdict, 'not_yet') = 'not_yet'),
+			SUM(COALESCE(verdict, '') = 'legitimate'),
+			SUM(COALESCE(verdict, '') = 'not_legitimate')
+		FROM %s
+		WHERE tenant = ? AND collection_name > ? AND (? = '' OR collection_name = ?)
+		GROUP BY collection_name
+		ORDER BY collection_name LIMIT ?
+	`, table), tenant, after, collection, collection, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []CollectionCounts{}
+	for rows.Next() {
+		var c CollectionCounts
+		if err := rows.Scan(&c.Collection, &c.Total, &c.NotYet, &c.Legitimate, &c.NotLegitimate); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+
+	return counts, rows.Err()
+}
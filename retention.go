@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// What a retention run does with a profile entry
+const (
+	RetentionPurged   = "purged"
+	RetentionArchived = "archived"
+)
+
+var errRetentionRunNotFound = errors.New("retention run not found")
+
+// RetentionPolicy decides which profile entries a retention run removes
+type RetentionPolicy struct {
+	// UnseenDays purges entries still awaiting a verdict that no sync has seen
+	// for that many days, 0 keeps them
+	UnseenDays int `json:"unseen_days"`
+	// ArchiveOrphaned archives the entries of collections no synced runtime
+	// policy mentions anymore, verdict and remarks included
+	ArchiveOrphaned bool `json:"archive_orphaned"`
+}
+
+// RetiredEntry is a profile entry a retention run removes or removed
+type RetiredEntry struct {
+	Kind       string `json:"kind"`
+	Action     string `json:"action"`
+	EntryID    int64  `json:"entry_id"`
+	Collection string `json:"collection"`
+	Key        string `json:"key"`
+	Value      string `json:"value"`
+	// Owner is the host_id or app_id of host and app-embedded entries
+	Owner     string     `json:"owner,omitempty"`
+	Verdict   string     `json:"verdict"`
+	Remarks   string     `json:"remarks,omitempty"`
+	FirstSeen *time.Time `json:"first_seen,omitempty"`
+	LastSeen  *time.Time `json:"last_seen,omitempty"`
+}
+
+// RetentionRun is one logged retention run
+type RetentionRun struct {
+	ID       int64           `json:"id"`
+	Tenant   string          `json:"tenant"`
+	RanAt    time.Time       `json:"ran_at"`
+	Policy   RetentionPolicy `json:"policy"`
+	Purged   int             `json:"purged"`
+	Archived int             `json:"archived"`
+	Entries  []RetiredEntry  `json:"entries,omitempty"`
+}
+
+// RetentionReport is what a retention run removed or, on a dry run, would remove
+type RetentionReport struct {
+	Tenant string          `json:"tenant"`
+	DryRun bool            `json:"dry_run"`
+	RunID  int64           `json:"run_id,omitempty"`
+	Policy RetentionPolicy `json:"policy"`
+	// Cutoff is the last_seen before which entries awaiting a verdict are purged
+	Cutoff   *time.Time     `json:"cutoff,omitempty"`
+	Purged   int            `json:"purged"`
+	Archived int            `json:"archived"`
+	Entries  []RetiredEntry `json:"entries"`
+}
+
+// retentionPolicy returns the configured retention policy
+func (s *Service) retentionPolicy() RetentionPolicy {
+	return RetentionPolicy{
+		UnseenDays:      s.Cfg.RetentionUnseenDays,
+		ArchiveOrphaned: s.Cfg.RetentionArchiveOrphaned,
+	}
+}
+
+// ApplyRetention removes the stale profile entries of a tenant under the
+// configured retention policy and logs them. A dry run only reports them.
+func (s *Service) ApplyRetention(tenant string, dryRun bool) (RetentionReport, error) {
+	now := time.Now().UTC()
+	report := RetentionReport{Tenant: tenant, DryRun: dryRun, Policy: s.retentionPolicy(), Entries: []RetiredEntry{}}
+	if report.Policy.UnseenDays < 0 {
+		return report, fmt.Errorf("RETENTION_UNSEEN_DAYS must not be negative")
+	}
+
+	var cutoff time.Time
+	if report.Policy.UnseenDays > 0 {
+		cutoff = now.AddDate(0, 0, -report.Policy.UnseenDays)
+		report.Cutoff = &cutoff
+	}
+
+	if dryRun {
+		for _, kind := range verdictKinds {
+			entries, err := s.Repo.ListRetentionCandidates(tenant, kind, report.Policy.ArchiveOrphaned, cutoff)
+			if err != nil {
+				return report, fmt.Errorf("failed to list %s retention candidates: %v", kind, err)
+			}
+			for _, entry := range entries {
+				if entry.Action == RetentionArchived {
+					report.Archived++
+				} else {
+					report.Purged++
+				}
+			}
+			report.Entries = append(report.Entries, entries...)
+		}
+
+		logger.Printf("Retention dry run for tenant %s: %d entries would be purged, %d archived\n", tenant, report.Purged, report.Archived)
+		return report, nil
+	}
+
+	run, err := s.Repo.RetireProfileEntries(RetentionRun{Tenant: tenant, RanAt: now, Policy: report.Policy}, cutoff)
+	if err != nil {
+		return report, fmt.Errorf("failed to apply retention: %v", err)
+	}
+	report.RunID = run.ID
+	report.Purged = run.Purged
+	report.Archived = run.Archived
+	report.Entries = run.Entries
+
+	logger.Printf("Retention run %d for tenant %s: %d entries purged, %d archived\n", run.ID, tenant, run.Purged, run.Archived)
+	return report, nil
+}
+
+// ListRetentionRuns returns the latest retention runs of a tenant, without their entries
+func (s *Service) ListRetentionRuns(tenant string, limit int) ([]RetentionRun, error) {
+	return s.Repo.ListRetentionRuns(tenant, limit)
+}
+
+// GetRetentionRun returns a retention run of a tenant with the entries it removed
+func (s *Service) GetRetentionRun(tenant string, id int64) (RetentionRun, error) {
+	return s.Repo.GetRetentionRun(tenant, id)
+}
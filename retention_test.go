@@ -0,0 +1,167 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// retentionService stores profile entries of every age and verdict next to a
+// synced container policy that only covers the payments collection
+func retentionService(t *testing.T, policy RetentionPolicy) *Service {
+	service := &Service{Repo: newTestRepo(t), Cfg: Config{
+		RetentionUnseenDays:      policy.UnseenDays,
+		RetentionArchiveOrphaned: policy.ArchiveOrphaned,
+	}}
+
+	now := time.Now().UTC()
+	stale, recent := now.AddDate(0, 0, -40), now.AddDate(0, 0, -5)
+	for _, entry := range []struct {
+		collection, value, verdict string
+		lastSeen                   time.Time
+	}{
+		{"payments", "stale-unreviewed", "not_yet", stale},
+		{"payments", "stale-approved", "legitimate", stale},
+		{"payments", "stale-denied", "not_legitimate", stale},
+		{"payments", "recent-unreviewed", "not_yet", recent},
+		{"legacy", "orphaned-approved", "legitimate", recent},
+		{"legacy", "orphaned-stale", "not_yet", stale},
+	} {
+		_, err := service.Repo.DB.Exec(`
+			INSERT INTO container_profiles (tenant, collection_name, key, value, verdict, updated_at, first_seen, last_seen)
+			VALUES (?, ?, 'processes', ?, ?, CURRENT_TIMESTAMP, ?, ?)
+		`, defaultTenant, entry.collection, entry.value, entry.verdict, stale, entry.lastSeen)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// No host policy was ever synced, so host entries are never archived
+	_, err := service.Repo.DB.Exec(`
+		INSERT INTO host_profiles (tenant, host_id, collection_name, key, value, verdict, created_at, updated_at, first_seen, last_seen)
+		VALUES (?, 'host-1', 'legacy', 'processes', 'host-stale', 'not_yet', ?, ?, ?, ?)
+	`, defaultTenant, stale, stale, stale, stale)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policyRule := ContainerRule{Name: "payments-rule", Collections: []Collection{{Name: "payments"}}}
+	err = service.Repo.SaveSyncedPolicy(defaultTenant, KindContainer, ContainerPolicy{Rules: []ContainerRule{policyRule}}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service
+}
+
+// retiredValues lists retired entries as "action value"
+func retiredValues(entries []RetiredEntry) []string {
+	values := []string{}
+	for _, entry := range entries {
+		values = append(values, entry.Action+" "+entry.Value)
+	}
+	slices.Sort(values)
+	return values
+}
+
+func TestApplyRetention(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy RetentionPolicy
+		want   []string
+	}{
+		{
+			name:   "unseen entries awaiting a verdict are purged",
+			policy: RetentionPolicy{UnseenDays: 30},
+			want:   []string{"purged host-stale", "purged orphaned-stale", "purged stale-unreviewed"},
+		},
+		{
+			name:   "the cutoff keeps entries seen since",
+			policy: RetentionPolicy{UnseenDays: 60},
+			want:   []string{},
+		},
+		{
+			name:   "orphaned collections are archived, verdicts included",
+			policy: RetentionPolicy{ArchiveOrphaned: true},
+			want:   []string{"archived orphaned-approved", "archived orphaned-stale"},
+		},
+		{
+			name:   "archiving wins over purging",
+			policy: RetentionPolicy{UnseenDays: 30, ArchiveOrphaned: true},
+			want:   []string{"archived orphaned-approved", "archived orphaned-stale", "purged host-stale", "purged stale-unreviewed"},
+		},
+		{
+			name: "nothing is removed without a policy",
+			want: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service := retentionService(t, tt.policy)
+			countEntries := func() int {
+				var count int
+				if err := service.Repo.DB.QueryRow(`
+					SELECT (SELECT COUNT(*) FROM container_profiles) + (SELECT COUNT(*) FROM host_profiles)
+				`).Scan(&count); err != nil {
+					t.Fatal(err)
+				}
+				return count
+			}
+
+			// A dry run reports the candidates and removes nothing
+			preview, err := service.ApplyRetention(defaultTenant, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := retiredValues(preview.Entries); !slices.Equal(got, tt.want) {
+				t.Errorf("dry run = %q, want %q", got, tt.want)
+			}
+			if preview.RunID != 0 || countEntries() != 7 {
+				t.Errorf("dry run logged run %d and left %d of 7 entries", preview.RunID, countEntries())
+			}
+			if (preview.Cutoff != nil) != (tt.policy.UnseenDays > 0) {
+				t.Errorf("cutoff = %v with %d unseen days", preview.Cutoff, tt.policy.UnseenDays)
+			}
+
+			report, err := service.ApplyRetention(defaultTenant, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := retiredValues(report.Entries); !slices.Equal(got, tt.want) {
+				t.Errorf("run = %q, want %q", got, tt.want)
+			}
+			if report.Purged != preview.Purged || report.Archived != preview.Archived || report.Purged+report.Archived != len(tt.want) {
+				t.Errorf("run removed %d purged, %d archived, dry run said %d, %d", report.Purged, report.Archived, preview.Purged, preview.Archived)
+			}
+			if remaining := countEntries(); remaining != 7-len(tt.want) {
+				t.Errorf("%d entries left, want %d", remaining, 7-len(tt.want))
+			}
+
+			// The run is logged with what it removed, verdicts included
+			run, err := service.GetRetentionRun(defaultTenant, report.RunID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := retiredValues(run.Entries); !slices.Equal(got, tt.want) || run.Policy != tt.policy {
+				t.Errorf("logged run = %q under %+v, want %q under %+v", got, run.Policy, tt.want, tt.policy)
+			}
+			for _, entry := range run.Entries {
+				if entry.Value == "orphaned-approved" && entry.Verdict != "legitimate" {
+					t.Errorf("archived entry lost its verdict: %+v", entry)
+				}
+			}
+			if _, err := service.GetRetentionRun("other", report.RunID); err != errRetentionRunNotFound {
+				t.Errorf("run of another tenant = %v, want errRetentionRunNotFound", err)
+			}
+
+			// A second run has nothing left to remove
+			again, err := service.ApplyRetention(defaultTenant, false)
+			if err != nil || len(again.Entries) != 0 {
+				t.Errorf("second run = %q, %v, want nothing removed", retiredValues(again.Entries), err)
+			}
+		})
+	}
+
+	service := retentionService(t, RetentionPolicy{UnseenDays: -1})
+	if _, err := service.ApplyRetention(defaultTenant, true); err == nil {
+		t.Error("want an error for negative RETENTION_UNSEEN_DAYS")
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strconv"
+)
+
+// reviewFiles is the web review UI, served from the binary at /review/
+//
+//go:embed web/review
+var reviewFiles embed.FS
+
+// reviewUI serves the review UI. The page itself holds no data; it calls the
+// API with the token the reviewer enters.
+func reviewUI() http.Handler {
+	files, err := fs.Sub(reviewFiles, "web/review")
+	if err != nil {
+		panic(fmt.Errorf("Failed to load review UI: %v", err))
+	}
+	return http.StripPrefix("/review/", http.FileServerFS(files))
+}
+
+// ReviewDecision is a verdict given to a stored profile entry in the review UI
+type ReviewDecision struct {
+	ID      int64  `json:"id"`
+	Verdict string `json:"verdict"`
+	Remarks string `json:"remarks"`
+}
+
+// PreviewReview previews the verdicts given in the review UI like a CSV
+// import dry run. The entries are read by id, so reviewers only send their
+// decisions; the preview is confirmed like any other.
+func (s *Service) PreviewReview(ctx context.Context, tenant, kind, reviewer string, decisions []ReviewDecision) (VerdictPreview, error) {
+	records := make([]CapabilitiesCSVHeader, 0, len(decisions))
+	for _, decision := range decisions {
+		entry, err := s.Repo.GetProfileEntry(tenant, kind, decision.ID)
+		if err != nil {
+			return VerdictPreview{}, fmt.Errorf("entry %d: %w", decision.ID, err)
+		}
+		records = append(records, CapabilitiesCSVHeader{
+			ID:             strconv.FormatInt(entry.ID, 10),
+			CollectionName: entry.Collection,
+			Key:            entry.Key,
+			Value:          entry.Value,
+			Verdict:        decision.Verdict,
+			Remarks:        decision.Remarks,
+		})
+	}
+
+	return s.PreviewVerdicts(ctx, tenant, kind, records, VerdictProvenance{Reviewer: reviewer, Source: VerdictSourceReview})
+}
@@ -2,16 +2,27 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 )
 
-// detectDelimiter auto-detects the CSV delimiter by counting occurrences
+// detectDelimiter auto-detects the CSV delimiter by counting occurrences in
+// the header line, which holds only column names: values further down may
+// contain any of the delimiters
 func detectDelimiter(data []byte) rune {
+	if end := bytes.IndexByte(data, '\n'); end >= 0 {
+		data = data[:end]
+	}
+
 	comma := bytes.Count(data, []byte(","))
 	semicolon := bytes.Count(data, []byte(";"))
 	tab := bytes.Count(data, []byte("\t"))
@@ -25,182 +36,407 @@ func detectDelimiter(data []byte) rune {
 	return ',' // default
 }
 
-// parseCSVWithAutoDetect parses a CSV file with auto-detected delimiter
-func parseCSVWithAutoDetect(file io.Reader) ([]CapabilitiesCSVHeader, error) {
+// verdictCSVColumns maps the header names of a verdict CSV, lowercased, to
+// the fields they fill. remarks is optional; other columns, such as host_id
+// or the details of container entries, are ignored.
+var verdictCSVColumns = map[string]func(*CapabilitiesCSVHeader, string){
+	"id":              func(r *CapabilitiesCSVHeader, v string) { r.ID = v },
+	"collection_name": func(r *CapabilitiesCSVHeader, v string) { r.CollectionName = v },
+	"collection":      func(r *CapabilitiesCSVHeader, v string) { r.CollectionName = v },
+	"key":             func(r *CapabilitiesCSVHeader, v string) { r.Key = v },
+	"value":           func(r *CapabilitiesCSVHeader, v string) { r.Value = v },
+	"verdict":         func(r *CapabilitiesCSVHeader, v string) { r.Verdict = v },
+	"remarks":         func(r *CapabilitiesCSVHeader, v string) { r.Remarks = v },
+}
+
+var requiredVerdictCSVColumns = []string{"id", "collection_name", "key", "value", "verdict"}
+
+// parseCSVWithAutoDetect parses a verdict CSV file with auto-detected
+// delimiter, mapping columns by the names in its header. A row too short for
+// a mapped column is returned with a problem instead of failing the file.
+func parseCSVWithAutoDetect(file io.Reader) ([]VerdictCSVRow, error) {
 	// Read entire file into buffer to detect delimiter
 	data, err := io.ReadAll(file)
 	if err != nil {
 		return nil, err
 	}
+	// Excel saves UTF-8 CSV files with a byte order mark
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
 
 	delimiter := detectDelimiter(data)
-	fmt.Printf("Detected CSV delimiter: %c\n", delimiter)
+	logger.Printf("Detected CSV delimiter: %c\n", delimiter)
 
 	reader := csv.NewReader(bytes.NewReader(data))
 	reader.Comma = delimiter
+	reader.FieldsPerRecord = -1
 
-	// Read header first (and discard)
-	_, err = reader.Read()
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("the file is empty")
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	var records []CapabilitiesCSVHeader
+	columns := map[int]string{}
+	found := map[string]bool{}
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "collection" {
+			name = "collection_name"
+		}
+		if _, ok := verdictCSVColumns[name]; ok && !found[name] {
+			columns[i] = name
+			found[name] = true
+		}
+	}
+	var missing []string
+	for _, name := range requiredVerdictCSVColumns {
+		if !found[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("header is missing the %s column(s), expected %s,remarks",
+			strings.Join(missing, ", "), strings.Join(requiredVerdictCSVColumns, ","))
+	}
+
+	rows := []VerdictCSVRow{}
 	for {
 		record, err := reader.Read()
 		if err == io.EOF {
 			break
 		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rows = append(rows, VerdictCSVRow{Line: parseErr.StartLine, Problem: parseErr.Err.Error()})
+			continue
+		}
 		if err != nil {
 			return nil, err
 		}
+		line, _ := reader.FieldPos(0)
 
-		// record format: id, collection_name, key, value, verdict, remarks
-		if len(record) < 5 {
+		// Spreadsheets leave rows of empty cells behind
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
 			continue
 		}
 
-		records = append(records, CapabilitiesCSVHeader{
-			ID:             strings.TrimSpace(record[0]),
-			CollectionName: strings.TrimSpace(record[1]),
-			Key:            strings.TrimSpace(record[2]),
-			Value:          strings.TrimSpace(record[3]),
-			Verdict:        strings.TrimSpace(record[4]),
-			Remarks:        strings.TrimSpace(record[5]),
-		})
+		row := VerdictCSVRow{Line: line}
+		var short []string
+		for i, name := range columns {
+			if i >= len(record) {
+				if name != "remarks" {
+					short = append(short, name)
+				}
+				continue
+			}
+			verdictCSVColumns[name](&row.Record, strings.TrimSpace(record[i]))
+		}
+		if len(short) > 0 {
+			slices.Sort(short)
+			row.Problem = fmt.Sprintf("row has %d columns, missing %s", len(record), strings.Join(short, ", "))
+		}
+		rows = append(rows, row)
 	}
 
-	return records, nil
+	return rows, nil
 }
 
-func fetchProfile(service *Service) http.HandlerFunc {
+// requestReviewer names who sent a request for the verdict history: the name
+// of its API token. The shared TOKEN cannot tell reviewers apart, so with it
+// they name themselves in the X-Reviewer header. Such a name is only claimed,
+// so it is recorded under the token, e.g. "token:alice", never as a bare name
+// that reads like a named token; requests without it are recorded as "token".
+func requestReviewer(r *http.Request, caller Caller) string {
+	if !caller.Shared {
+		return caller.Name
+	}
+	if reviewer := strings.TrimSpace(r.Header.Get("X-Reviewer")); reviewer != "" {
+		return caller.Name + ":" + reviewer
+	}
+	return caller.Name
+}
+
+// queryBool parses an optional boolean query parameter, false when absent
+func queryBool(r *http.Request, name string) (bool, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return false, nil
+	}
+
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s: %q", name, value)
+	}
+
+	return parsed, nil
+}
+
+// queryLimit reads the page size of a query, 100 by default
+func queryLimit(r *http.Request) (int, error) {
+	value := r.URL.Query().Get("limit")
+	if value == "" {
+		return 100, nil
+	}
+
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 1 || limit > maxPageSize {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+	}
+
+	return limit, nil
+}
+
+// writeSyncError reports a failed profile sync as JSON, including how far the fetch got
+func writeSyncError(w http.ResponseWriter, message string, result SyncResult, err error) {
+	status := http.StatusInternalServerError
+	if result.FetchError != nil {
+		status = http.StatusBadGateway
+	}
+
+	resp := Response{
+		Message: fmt.Sprintf("%s: %v", message, err),
+		Data:    result,
+	}
+
+	res, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(res)
+}
+
+// writeJSON writes resp with the given status code
+func writeJSON(w http.ResponseWriter, status int, resp Response) {
+	res, err := json.Marshal(resp)
+	if err != nil {
+		http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(res)
+}
+
+// writePreviewError maps a failed verdict confirmation to its status code
+func writePreviewError(w http.ResponseWriter, err error) {
+	var conflict *PolicyConflictError
+	switch {
+	case errors.As(err, &conflict):
+		writeJSON(w, http.StatusConflict, Response{Message: err.Error(), Data: conflict.Conflicts})
+	case errors.Is(err, errPreviewNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, errPreviewExpired), errors.Is(err, errPreviewApplied):
+		http.Error(w, err.Error(), http.StatusGone)
+	case errors.Is(err, errPreviewStale):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, fmt.Sprintf("Failed to update verdicts: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// submitJob queues an operation in the background and answers 202 with the job,
+// or 409 with the job that is already queued or running for the tenant
+func submitJob(w http.ResponseWriter, service *Service, operation, tenant string, allowPartial bool) {
+	fn, err := service.Operation(operation, tenant, allowPartial)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	submitJobFunc(w, service, operation, tenant, fn)
+}
+
+// submitJobFunc queues fn as a job of the given operation, for operations that
+// take request parameters Operation does not know about
+func submitJobFunc(w http.ResponseWriter, service *Service, operation, tenant string, fn JobFunc) {
+	job, err := service.Jobs.Submit(tenant, operation, fn)
+	if err != nil {
+		writeSubmitError(w, job, err)
+		return
+	}
+
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, Response{Message: "Job queued", Data: job})
+}
+
+// runJob queues fn as a job of the given operation and waits for it, so a GET
+// is held to the same one-job-per-tenant rule as a POST. It answers and returns
+// false when the job could not be queued or the request ended before it finished;
+// otherwise the caller writes the response from what fn captured.
+func runJob(w http.ResponseWriter, r *http.Request, service *Service, operation, tenant string, fn JobFunc) bool {
+	job, err := service.Jobs.Submit(tenant, operation, fn)
+	if err != nil {
+		writeSubmitError(w, job, err)
+		return false
+	}
+
+	job, err = service.Jobs.Wait(r.Context(), job.ID)
+	if err != nil {
+		w.Header().Set("Location", "/jobs/"+job.ID)
+		writeJSON(w, http.StatusAccepted, Response{Message: "Job still running", Data: job})
+		return false
+	}
+
+	return true
+}
+
+// writeSubmitError answers a job that could not be queued with 409 and the job
+// already queued or running for the tenant, or 503 when the queue is full
+func writeSubmitError(w http.ResponseWriter, job Job, err error) {
+	switch {
+	case errors.Is(err, errJobAlreadyActive):
+		writeJSON(w, http.StatusConflict, Response{Message: err.Error(), Data: job})
+	case errors.Is(err, errJobQueueFull):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		http.Error(w, fmt.Sprintf("Failed to submit job: %v", err), http.StatusInternalServerError)
+	}
+}
+
+func getJob(service *Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		err := validateToken(r, service.Cfg.Token)
+		_, err := validateToken(r, service, "")
 		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			writeAuthError(w, err)
 			return
 		}
 
-		err = service.FetchAndSaveProfiles()
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to fetch profiles: %v", err), http.StatusInternalServerError)
+		job, err := service.Jobs.Get(r.PathValue("id"))
+		if errors.Is(err, errJobNotFound) {
+			http.Error(w, "Job not found", http.StatusNotFound)
 			return
 		}
-
-		w.WriteHeader(http.StatusOK)
-
-		resp := Response{
-			Message: "Profiles fetched and saved successfully!",
-		}
-
-		res, err := json.Marshal(resp)
 		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get job: %v", err), http.StatusInternalServerError)
 			return
 		}
 
-		w.Write(res)
+		writeJSON(w, http.StatusOK, Response{Message: "Job " + job.Status, Data: job})
 	}
 }
 
-func sendVerdict(service *Service) http.HandlerFunc {
+func listJobs(service *Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		err := validateToken(r, service.Cfg.Token)
+		_, err := validateToken(r, service, "")
 		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			writeAuthError(w, err)
 			return
 		}
 
-		err = service.SendVerdict()
+		tenant := ""
+		if r.URL.Query().Get("tenant") != "" {
+			tenant, err = service.ResolveTenant(r.URL.Query().Get("tenant"))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		limit := 50
+		if value := r.URL.Query().Get("limit"); value != "" {
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > 500 {
+				http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+				return
+			}
+		}
+
+		jobs, err := service.Jobs.List(tenant, limit)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to send verdict email: %v", err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Failed to list jobs: %v", err), http.StatusInternalServerError)
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
+		writeJSON(w, http.StatusOK, Response{Message: fmt.Sprintf("%d jobs", len(jobs)), Data: jobs})
+	}
+}
 
-		resp := Response{
-			Message: "Verdict email sent successfully",
+func listSchedules(service *Service, scheduler *Scheduler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
 		}
 
-		res, err := json.Marshal(resp)
+		_, err := validateToken(r, service, "")
 		if err != nil {
+			writeAuthError(w, err)
 			return
 		}
 
-		w.Write(res)
+		schedules := scheduler.Schedules()
+		writeJSON(w, http.StatusOK, Response{Message: fmt.Sprintf("%d schedules", len(schedules)), Data: schedules})
 	}
 }
 
-func updateVerdict(service *Service) http.HandlerFunc {
+func fetchProfile(service *Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodPost {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		err := validateToken(r, service.Cfg.Token)
+		_, err := validateToken(r, service, ScopeSync)
 		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			writeAuthError(w, err)
 			return
 		}
 
-		err = r.ParseMultipartForm(10 << 20) // 10 MB max
+		tenant, err := service.ResolveTenant(r.URL.Query().Get("tenant"))
 		if err != nil {
-			http.Error(w, "File too large", http.StatusBadRequest)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		file, _, err := r.FormFile("file")
+		allowPartial, err := queryBool(r, "allow_partial")
 		if err != nil {
-			http.Error(w, "File not found in request", http.StatusBadRequest)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		defer file.Close()
 
-		capabilities, err := parseCSVWithAutoDetect(file)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to process CSV: %v", err), http.StatusBadRequest)
+		if r.Method == http.MethodPost {
+			submitJob(w, service, OpContainerProfiles, tenant, allowPartial)
 			return
 		}
 
-		// Update verdicts in database
-		updatedCount, err := service.Repo.UpdateVerdicts(capabilities)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to update verdicts: %v", err), http.StatusInternalServerError)
+		var result SyncResult
+		if !runJob(w, r, service, OpContainerProfiles, tenant, func(ctx context.Context) (any, error) {
+			result, err = service.FetchAndSaveProfiles(ctx, tenant, allowPartial)
+			return result, err
+		}) {
 			return
 		}
-
-		// Push legitimate verdicts to Prisma Cloud
-		pcPushedCount, err := service.PushVerdictToPrismaCloud(capabilities)
 		if err != nil {
-			// Log error but don't fail the request - local DB update succeeded
-			fmt.Printf("Warning: Failed to push to Prisma Cloud: %v\n", err)
+			writeSyncError(w, "Failed to fetch profiles", result, err)
+			return
 		}
 
 		w.WriteHeader(http.StatusOK)
 
 		resp := Response{
-			Message: fmt.Sprintf("Successfully updated %d records", updatedCount),
-			Data: map[string]int{
-				"updated_count":   updatedCount,
-				"total_records":   len(capabilities),
-				"pc_pushed_count": pcPushedCount,
-			},
+			Message: "Profiles fetched and saved successfully!",
+			Data:    result,
 		}
 
 		res, err := json.Marshal(resp)
 		if err != nil {
-			http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
 			return
 		}
 
@@ -208,29 +444,67 @@ func updateVerdict(service *Service) http.HandlerFunc {
 	}
 }
 
-func fetchPolicies(service *Service) http.HandlerFunc {
+func sendVerdict(service *Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		err := validateToken(r, service.Cfg.Token)
+		_, err := validateToken(r, service, ScopeReport)
 		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			writeAuthError(w, err)
 			return
 		}
 
-		err = service.FetchAndSavePolicies()
+		tenant, err := service.ResolveTenant(r.URL.Query().Get("tenant"))
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to fetch policies: %v", err), http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Without ?kind= every profile kind is sent
+		var kinds []string
+		if name := r.URL.Query().Get("kind"); name != "" {
+			kind, err := ResolveVerdictKind(name)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			kinds = []string{kind}
+		}
+
+		if r.Method == http.MethodPost {
+			if kinds == nil {
+				submitJob(w, service, OpVerdictEmail, tenant, false)
+				return
+			}
+			submitJobFunc(w, service, OpVerdictEmail, tenant, func(ctx context.Context) (any, error) {
+				return map[string]string{"tenant": tenant, "kind": kinds[0]}, service.SendVerdict(tenant, kinds...)
+			})
+			return
+		}
+
+		data := map[string]string{"tenant": tenant}
+		if kinds != nil {
+			data["kind"] = kinds[0]
+		}
+		if !runJob(w, r, service, OpVerdictEmail, tenant, func(ctx context.Context) (any, error) {
+			err = service.SendVerdict(tenant, kinds...)
+			return data, err
+		}) {
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to send verdict email: %v", err), http.StatusInternalServerError)
 			return
 		}
 
 		w.WriteHeader(http.StatusOK)
 
 		resp := Response{
-			Message: "Policies fetched and saved successfully!",
+			Message: "Verdict email sent successfully",
+			Data:    data,
 		}
 
 		res, err := json.Marshal(resp)
@@ -242,33 +516,151 @@ func fetchPolicies(service *Service) http.HandlerFunc {
 	}
 }
 
-func fetchHostPolicies(service *Service) http.HandlerFunc {
+func updateVerdict(service *Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
+		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		err := validateToken(r, service.Cfg.Token)
+		caller, err := validateToken(r, service, ScopeReview)
 		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			writeAuthError(w, err)
 			return
 		}
 
-		err = service.FetchAndSaveHostPolicies()
+		tenant, err := service.ResolveTenant(r.URL.Query().Get("tenant"))
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to fetch host policies: %v", err), http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		kind, err := ResolveVerdictKind(r.URL.Query().Get("kind"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		reviewer := requestReviewer(r, caller)
+
+		// A previewed import is applied by its token alone, no file needed
+		if token := r.URL.Query().Get("confirm"); token != "" {
+			if !caller.Can(ScopePush) {
+				writeAuthError(w, &ForbiddenError{Scope: ScopePush})
+				return
+			}
+			// Whoever confirms approves the verdicts of the preview's reviewer
+			result, err := service.ConfirmVerdicts(r.Context(), tenant, token, reviewer)
+			if err != nil {
+				writePreviewError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, Response{
+				Message: fmt.Sprintf("Successfully updated %d records", result.UpdatedCount),
+				Data:    result,
+			})
+			return
+		}
+
+		dryRun, err := queryBool(r, "dry_run")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		lenient, err := queryBool(r, "lenient")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// Only a dry run is left to reviewers without the push scope
+		if !dryRun && !caller.Can(ScopePush) {
+			writeAuthError(w, &ForbiddenError{Scope: ScopePush})
+			return
+		}
+
+		err = r.ParseMultipartForm(10 << 20) // 10 MB max
+		if err != nil {
+			http.Error(w, "File too large", http.StatusBadRequest)
+			return
+		}
+
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "File not found in request", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		data, err := io.ReadAll(file)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to read CSV: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		rows, err := parseCSVWithAutoDetect(bytes.NewReader(data))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to process CSV: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		// Without ?lenient=true a single rejected row refuses the whole file
+		capabilities, validation, err := service.ValidateVerdicts(tenant, kind, rows, lenient)
+		var invalid *VerdictValidationError
+		if errors.As(err, &invalid) {
+			writeJSON(w, http.StatusUnprocessableEntity, Response{Message: err.Error(), Data: invalid.Validation})
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to validate CSV: %v", err), http.StatusInternalServerError)
+			return
+		}
+		provenance := VerdictProvenance{Reviewer: reviewer, Approver: reviewer, Source: VerdictSourceUpload, FileHash: fileHash(data)}
+
+		if dryRun {
+			preview, err := service.PreviewVerdicts(r.Context(), tenant, kind, capabilities, provenance)
+			var conflict *PolicyConflictError
+			if errors.As(err, &conflict) {
+				writeJSON(w, http.StatusConflict, Response{Message: err.Error(), Data: conflict.Conflicts})
+				return
+			}
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to preview verdicts: %v", err), http.StatusBadRequest)
+				return
+			}
+			preview.Validation = &validation
+
+			if r.URL.Query().Get("format") == "html" || strings.Contains(r.Header.Get("Accept"), "text/html") {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				if err := renderPreviewHTML(w, preview); err != nil {
+					logger.Printf("Failed to render preview %s: %v\n", preview.Token, err)
+				}
+				return
+			}
+
+			writeJSON(w, http.StatusOK, Response{
+				Message: fmt.Sprintf("Preview of %d records%s, confirm with ?confirm=%s", preview.TotalRecords, rejectedNote(validation), preview.Token),
+				Data:    preview,
+			})
+			return
+		}
+
+		result, err := service.ImportVerdicts(r.Context(), tenant, kind, capabilities, true, provenance)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to update verdicts: %v", err), http.StatusInternalServerError)
 			return
 		}
+		result.Validation = &validation
 
 		w.WriteHeader(http.StatusOK)
 
 		resp := Response{
-			Message: "Host policies fetched and saved successfully!",
+			Message: fmt.Sprintf("Successfully updated %d records%s", result.UpdatedCount, rejectedNote(validation)),
+			Data:    result,
 		}
 
 		res, err := json.Marshal(resp)
 		if err != nil {
+			http.Error(w, "Failed to marshal response", http.StatusInternalServerError)
 			return
 		}
 
@@ -276,68 +668,107 @@ func fetchHostPolicies(service *Service) http.HandlerFunc {
 	}
 }
 
-func fetchHostProfile(service *Service) http.HandlerFunc {
+// reviewVerdicts previews the decisions of the review UI, sent as JSON
+// {"decisions": [{"id": 1, "verdict": "legitimate", "remarks": "..."}]}.
+// The returned token is confirmed with /verdict/update?confirm=.
+func reviewVerdicts(service *Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
+		if r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		err := validateToken(r, service.Cfg.Token)
+		caller, err := validateToken(r, service, ScopeReview)
 		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			writeAuthError(w, err)
 			return
 		}
 
-		err = service.FetchAndSaveHostProfiles()
+		tenant, err := service.ResolveTenant(r.URL.Query().Get("tenant"))
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to fetch host profiles: %v", err), http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
+		kind, err := ResolveVerdictKind(r.URL.Query().Get("kind"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 
-		resp := Response{
-			Message: "Host profiles fetched and saved successfully!",
+		var body struct {
+			Decisions []ReviewDecision `json:"decisions"`
+		}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 10<<20)).Decode(&body); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid review: %v", err), http.StatusBadRequest)
+			return
+		}
+		if len(body.Decisions) == 0 {
+			http.Error(w, "no decisions to review", http.StatusBadRequest)
+			return
 		}
 
-		res, err := json.Marshal(resp)
-		if err != nil {
+		preview, err := service.PreviewReview(r.Context(), tenant, kind, requestReviewer(r, caller), body.Decisions)
+		var conflict *PolicyConflictError
+		switch {
+		case errors.As(err, &conflict):
+			writeJSON(w, http.StatusConflict, Response{Message: err.Error(), Data: conflict.Conflicts})
+			return
+		case errors.Is(err, errProfileEntryNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, fmt.Sprintf("Failed to preview verdicts: %v", err), http.StatusBadRequest)
 			return
 		}
 
-		w.Write(res)
+		writeJSON(w, http.StatusOK, Response{
+			Message: fmt.Sprintf("Preview of %d records, confirm with ?confirm=%s", preview.TotalRecords, preview.Token),
+			Data:    preview,
+		})
 	}
 }
 
-func weeklyAlertReport(service *Service) http.HandlerFunc {
+func fetchPolicies(service *Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		err := validateToken(r, service.Cfg.Token)
+		_, err := validateToken(r, service, ScopeSync)
 		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			writeAuthError(w, err)
 			return
 		}
 
-		awsCount, gcpCount, err := service.GenerateWeeklyAlertReport()
+		tenant, err := service.ResolveTenant(r.URL.Query().Get("tenant"))
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to generate weekly alert report: %v", err), http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			submitJob(w, service, OpContainerPolicies, tenant, false)
+			return
+		}
+
+		if !runJob(w, r, service, OpContainerPolicies, tenant, func(ctx context.Context) (any, error) {
+			err = service.FetchAndSavePolicies(ctx, tenant)
+			return map[string]string{"tenant": tenant}, err
+		}) {
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to fetch policies: %v", err), http.StatusInternalServerError)
 			return
 		}
 
 		w.WriteHeader(http.StatusOK)
 
 		resp := Response{
-			Message: "Weekly CSPM alert report sent successfully",
-			Data: map[string]interface{}{
-				"aws_alerts_count": awsCount,
-				"gcp_alerts_count": gcpCount,
-				"emailed_to":       service.Cfg.WeeklyReportTo,
-			},
+			Message: "Policies fetched and saved successfully!",
+			Data:    map[string]string{"tenant": tenant},
 		}
 
 		res, err := json.Marshal(resp)
@@ -349,29 +780,46 @@ func weeklyAlertReport(service *Service) http.HandlerFunc {
 	}
 }
 
-func fetchAppEmbeddedProfile(service *Service) http.HandlerFunc {
+func fetchHostPolicies(service *Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		err := validateToken(r, service.Cfg.Token)
+		_, err := validateToken(r, service, ScopeSync)
 		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			writeAuthError(w, err)
 			return
 		}
 
-		err = service.FetchAndSaveAppEmbeddedProfiles()
+		tenant, err := service.ResolveTenant(r.URL.Query().Get("tenant"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			submitJob(w, service, OpHostPolicies, tenant, false)
+			return
+		}
+
+		if !runJob(w, r, service, OpHostPolicies, tenant, func(ctx context.Context) (any, error) {
+			err = service.FetchAndSaveHostPolicies(ctx, tenant)
+			return map[string]string{"tenant": tenant}, err
+		}) {
+			return
+		}
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to fetch app-embedded profiles: %v", err), http.StatusInternalServerError)
+			http.Error(w, fmt.Sprintf("Failed to fetch host policies: %v", err), http.StatusInternalServerError)
 			return
 		}
 
 		w.WriteHeader(http.StatusOK)
 
 		resp := Response{
-			Message: "App-embedded profiles fetched and saved successfully!",
+			Message: "Host policies fetched and saved successfully!",
+			Data:    map[string]string{"tenant": tenant},
 		}
 
 		res, err := json.Marshal(resp)
@@ -383,36 +831,959 @@ func fetchAppEmbeddedProfile(service *Service) http.HandlerFunc {
 	}
 }
 
-func fetchAppEmbeddedPolicies(service *Service) http.HandlerFunc {
+func fetchHostProfile(service *Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		err := validateToken(r, service.Cfg.Token)
+		_, err := validateToken(r, service, ScopeSync)
 		if err != nil {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			writeAuthError(w, err)
 			return
 		}
 
-		err = service.FetchAndSaveAppEmbeddedPolicies()
+		tenant, err := service.ResolveTenant(r.URL.Query().Get("tenant"))
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to fetch app-embedded policies: %v", err), http.StatusInternalServerError)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
-
-		resp := Response{
-			Message: "App-embedded policies fetched and saved successfully!",
+		allowPartial, err := queryBool(r, "allow_partial")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
-		res, err := json.Marshal(resp)
-		if err != nil {
+		if r.Method == http.MethodPost {
+			submitJob(w, service, OpHostProfiles, tenant, allowPartial)
+			return
+		}
+
+		var result SyncResult
+		if !runJob(w, r, service, OpHostProfiles, tenant, func(ctx context.Context) (any, error) {
+			result, err = service.FetchAndSaveHostProfiles(ctx, tenant, allowPartial)
+			return result, err
+		}) {
+			return
+		}
+		if err != nil {
+			writeSyncError(w, "Failed to fetch host profiles", result, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		resp := Response{
+			Message: "Host profiles fetched and saved successfully!",
+			Data:    result,
+		}
+
+		res, err := json.Marshal(resp)
+		if err != nil {
+			return
+		}
+
+		w.Write(res)
+	}
+}
+
+func weeklyAlertReport(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		_, err := validateToken(r, service, ScopeReport)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+
+		tenant, err := service.ResolveTenant(r.URL.Query().Get("tenant"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			submitJob(w, service, OpWeeklyReport, tenant, false)
+			return
+		}
+
+		var result WeeklyReportResult
+		if !runJob(w, r, service, OpWeeklyReport, tenant, func(ctx context.Context) (any, error) {
+			result, err = service.GenerateWeeklyAlertReport(ctx, tenant, false)
+			return result, err
+		}) {
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to generate weekly alert report: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		resp := Response{
+			Message: "Weekly CSPM alert report sent successfully",
+			Data:    result,
+		}
+
+		res, err := json.Marshal(resp)
+		if err != nil {
+			return
+		}
+
+		w.Write(res)
+	}
+}
+
+func fetchAppEmbeddedProfile(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		_, err := validateToken(r, service, ScopeSync)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+
+		tenant, err := service.ResolveTenant(r.URL.Query().Get("tenant"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		allowPartial, err := queryBool(r, "allow_partial")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			submitJob(w, service, OpAppEmbeddedProfiles, tenant, allowPartial)
+			return
+		}
+
+		var result SyncResult
+		if !runJob(w, r, service, OpAppEmbeddedProfiles, tenant, func(ctx context.Context) (any, error) {
+			result, err = service.FetchAndSaveAppEmbeddedProfiles(ctx, tenant, allowPartial)
+			return result, err
+		}) {
+			return
+		}
+		if err != nil {
+			writeSyncError(w, "Failed to fetch app-embedded profiles", result, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		resp := Response{
+			Message: "App-embedded profiles fetched and saved successfully!",
+			Data:    result,
+		}
+
+		res, err := json.Marshal(resp)
+		if err != nil {
+			return
+		}
+
+		w.Write(res)
+	}
+}
+
+func fetchAppEmbeddedPolicies(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		_, err := validateToken(r, service, ScopeSync)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+
+		tenant, err := service.ResolveTenant(r.URL.Query().Get("tenant"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			submitJob(w, service, OpAppEmbeddedPolicies, tenant, false)
+			return
+		}
+
+		if !runJob(w, r, service, OpAppEmbeddedPolicies, tenant, func(ctx context.Context) (any, error) {
+			err = service.FetchAndSaveAppEmbeddedPolicies(ctx, tenant)
+			return map[string]string{"tenant": tenant}, err
+		}) {
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to fetch app-embedded policies: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+
+		resp := Response{
+			Message: "App-embedded policies fetched and saved successfully!",
+			Data:    map[string]string{"tenant": tenant},
+		}
+
+		res, err := json.Marshal(resp)
+		if err != nil {
 			return
 		}
 
 		w.Write(res)
 	}
 }
+
+// snapshotID parses the {id} path value of a snapshot endpoint
+func snapshotID(r *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid snapshot id: %q", r.PathValue("id"))
+	}
+	return id, nil
+}
+
+// writeSnapshotError answers 404 for an unknown snapshot and 400 otherwise
+func writeSnapshotError(w http.ResponseWriter, message string, err error) {
+	if errors.Is(err, errSnapshotNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	http.Error(w, fmt.Sprintf("%s: %v", message, err), http.StatusBadRequest)
+}
+
+func listSnapshots(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		_, err := validateToken(r, service, ScopeReview)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+
+		tenant, err := service.ResolveTenant(r.URL.Query().Get("tenant"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		limit := 50
+		if value := r.URL.Query().Get("limit"); value != "" {
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > 500 {
+				http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+				return
+			}
+		}
+
+		snapshots, err := service.ListSnapshots(tenant, r.URL.Query().Get("kind"), limit)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to list snapshots: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Message: fmt.Sprintf("%d snapshots", len(snapshots)), Data: snapshots})
+	}
+}
+
+func getSnapshot(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		_, err := validateToken(r, service, ScopeReview)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+
+		tenant, err := service.ResolveTenant(r.URL.Query().Get("tenant"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		id, err := snapshotID(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		snapshot, err := service.GetSnapshot(tenant, id)
+		if err != nil {
+			writeSnapshotError(w, "Failed to get snapshot", err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Message: fmt.Sprintf("Snapshot %d", id), Data: snapshot})
+	}
+}
+
+func diffSnapshots(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		_, err := validateToken(r, service, ScopeReview)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+
+		tenant, err := service.ResolveTenant(r.URL.Query().Get("tenant"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+		if from == "" {
+			http.Error(w, "from is required: a snapshot id or live", http.StatusBadRequest)
+			return
+		}
+		if to == "" {
+			to = "live"
+		}
+
+		diff, err := service.DiffSnapshots(r.Context(), tenant, from, to)
+		if err != nil {
+			writeSnapshotError(w, "Failed to diff snapshots", err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Message: fmt.Sprintf("Diff of %s policy from %s to %s", diff.Kind, from, to), Data: diff})
+	}
+}
+
+func rollbackPolicy(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		caller, err := validateToken(r, service, ScopeReview)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+
+		tenant, err := service.ResolveTenant(r.URL.Query().Get("tenant"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		id, err := snapshotID(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		dryRun, err := queryBool(r, "dry_run")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !dryRun && !caller.Can(ScopePush) {
+			writeAuthError(w, &ForbiddenError{Scope: ScopePush})
+			return
+		}
+
+		result, err := service.RollbackPolicy(r.Context(), tenant, id, dryRun)
+		if errors.Is(err, errSnapshotNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to roll back policy: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		message := fmt.Sprintf("Rolled back %s policy to snapshot %d", result.Kind, id)
+		if dryRun {
+			message = fmt.Sprintf("Dry run: rolling back %s policy to snapshot %d", result.Kind, id)
+		}
+		writeJSON(w, http.StatusOK, Response{Message: message, Data: result})
+	}
+}
+
+func getDrift(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		_, err := validateToken(r, service, ScopeReview)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+
+		tenant, err := service.ResolveTenant(r.URL.Query().Get("tenant"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		kind, err := ResolveVerdictKind(r.URL.Query().Get("kind"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var syncID int64
+		if value := r.URL.Query().Get("sync_id"); value != "" {
+			syncID, err = strconv.ParseInt(value, 10, 64)
+			if err != nil || syncID < 1 {
+				http.Error(w, fmt.Sprintf("invalid sync_id: %q", value), http.StatusBadRequest)
+				return
+			}
+		}
+
+		report, err := service.GetDrift(tenant, kind, syncID, r.URL.Query().Get("collection"))
+		if errors.Is(err, errProfileSyncNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get drift: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		message := fmt.Sprintf("%d new, %d disappeared, %d reappeared entries", report.Sync.New, report.Sync.Disappeared, report.Sync.Reappeared)
+		writeJSON(w, http.StatusOK, Response{Message: message, Data: report})
+	}
+}
+
+func sendDrift(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		_, err := validateToken(r, service, ScopeReport)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+
+		tenant, err := service.ResolveTenant(r.URL.Query().Get("tenant"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			submitJob(w, service, OpDriftEmail, tenant, false)
+			return
+		}
+
+		var summary DriftSummary
+		if !runJob(w, r, service, OpDriftEmail, tenant, func(ctx context.Context) (any, error) {
+			summary, err = service.SendDriftSummary(tenant)
+			return summary, err
+		}) {
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to send drift email: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		message := "No newly learned entries awaiting a verdict"
+		if summary.Sent {
+			message = fmt.Sprintf("Drift email sent with %d entries", summary.Entries)
+		}
+		writeJSON(w, http.StatusOK, Response{Message: message, Data: summary})
+	}
+}
+
+// applyRetention reports on GET what the retention policy would remove and
+// removes it on POST, as a background job
+func applyRetention(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		_, err := validateToken(r, service, ScopeAdmin)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+
+		tenant, err := service.ResolveTenant(r.URL.Query().Get("tenant"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			submitJob(w, service, OpRetention, tenant, false)
+			return
+		}
+
+		report, err := service.ApplyRetention(tenant, true)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to check retention: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		message := fmt.Sprintf("Dry run: %d entries would be purged, %d archived", report.Purged, report.Archived)
+		writeJSON(w, http.StatusOK, Response{Message: message, Data: report})
+	}
+}
+
+func listRetentionRuns(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		_, err := validateToken(r, service, ScopeAdmin)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+
+		tenant, err := service.ResolveTenant(r.URL.Query().Get("tenant"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		limit := 50
+		if value := r.URL.Query().Get("limit"); value != "" {
+			limit, err = strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > 500 {
+				http.Error(w, "limit must be between 1 and 500", http.StatusBadRequest)
+				return
+			}
+		}
+
+		runs, err := service.ListRetentionRuns(tenant, limit)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to list retention runs: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Message: fmt.Sprintf("%d retention runs", len(runs)), Data: runs})
+	}
+}
+
+func getRetentionRun(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		_, err := validateToken(r, service, ScopeAdmin)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+
+		tenant, err := service.ResolveTenant(r.URL.Query().Get("tenant"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id < 1 {
+			http.Error(w, fmt.Sprintf("invalid retention run id: %q", r.PathValue("id")), http.StatusBadRequest)
+			return
+		}
+
+		run, err := service.GetRetentionRun(tenant, id)
+		if errors.Is(err, errRetentionRunNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get retention run: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Message: fmt.Sprintf("Retention run %d", id), Data: run})
+	}
+}
+
+func getProfileDetails(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		_, err := validateToken(r, service, ScopeReview)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+
+		tenant, err := service.ResolveTenant(r.URL.Query().Get("tenant"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil || id < 1 {
+			http.Error(w, fmt.Sprintf("invalid profile entry id: %q", r.PathValue("id")), http.StatusBadRequest)
+			return
+		}
+
+		entry, err := service.GetProfileDetails(tenant, id)
+		if errors.Is(err, errProfileEntryNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get profile details: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Message: fmt.Sprintf("%d observations", len(entry.Details)), Data: entry})
+	}
+}
+
+func verdictHistory(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		_, err := validateToken(r, service, ScopeReview)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+
+		tenant, err := service.ResolveTenant(r.URL.Query().Get("tenant"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		kind, err := ResolveVerdictKind(r.URL.Query().Get("kind"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		filter := VerdictHistoryFilter{
+			Kind:       kind,
+			Collection: r.URL.Query().Get("collection"),
+			Value:      r.URL.Query().Get("value"),
+			Limit:      100,
+		}
+		if value := r.URL.Query().Get("id"); value != "" {
+			filter.EntryID, err = strconv.ParseInt(value, 10, 64)
+			if err != nil || filter.EntryID < 1 {
+				http.Error(w, fmt.Sprintf("invalid id: %q", value), http.StatusBadRequest)
+				return
+			}
+		}
+		if filter.EntryID == 0 && filter.Collection == "" {
+			http.Error(w, "id or collection is required", http.StatusBadRequest)
+			return
+		}
+		if value := r.URL.Query().Get("limit"); value != "" {
+			filter.Limit, err = strconv.Atoi(value)
+			if err != nil || filter.Limit < 1 || filter.Limit > 1000 {
+				http.Error(w, "limit must be between 1 and 1000", http.StatusBadRequest)
+				return
+			}
+		}
+
+		changes, err := service.VerdictHistory(tenant, filter)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to get verdict history: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Message: fmt.Sprintf("%d verdict changes", len(changes)), Data: changes})
+	}
+}
+
+// queryProfiles returns a page of stored profile entries of a kind
+// (?collection=, ?key=, ?verdict=, ?value= substring, ?first_seen_after=,
+// ?first_seen_before=, ?last_seen_after=, ?last_seen_before=, ?limit=, ?cursor=)
+func queryProfiles(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		_, err := validateToken(r, service, ScopeReview)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+
+		q := r.URL.Query()
+		tenant, err := service.ResolveTenant(q.Get("tenant"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		query := ProfileQuery{
+			Collection: q.Get("collection"),
+			Key:        q.Get("key"),
+			Verdict:    q.Get("verdict"),
+			Value:      q.Get("value"),
+			Cursor:     q.Get("cursor"),
+		}
+		query.Kind, err = ResolveVerdictKind(q.Get("kind"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if query.Verdict != "" && query.Verdict != "not_yet" && query.Verdict != "legitimate" && query.Verdict != "not_legitimate" {
+			http.Error(w, fmt.Sprintf("invalid verdict: %q (valid: not_yet, legitimate, not_legitimate)", query.Verdict), http.StatusBadRequest)
+			return
+		}
+		query.Limit, err = queryLimit(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for name, at := range map[string]**time.Time{
+			"first_seen_after":  &query.FirstSeenAfter,
+			"first_seen_before": &query.FirstSeenBefore,
+			"last_seen_after":   &query.LastSeenAfter,
+			"last_seen_before":  &query.LastSeenBefore,
+		} {
+			*at, err = parseQueryTime(name, q.Get(name))
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		page, err := service.QueryProfiles(tenant, query)
+		if errors.Is(err, errInvalidCursor) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to query profiles: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Message: fmt.Sprintf("%d profile entries", len(page.Entries)), Data: page})
+	}
+}
+
+// countProfiles returns a page of the entry counts per collection and
+// verdict of a kind (?collection=, ?limit=, ?cursor=)
+func countProfiles(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		_, err := validateToken(r, service, ScopeReview)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+
+		q := r.URL.Query()
+		tenant, err := service.ResolveTenant(q.Get("tenant"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		kind, err := ResolveVerdictKind(q.Get("kind"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		limit, err := queryLimit(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		page, err := service.CountProfiles(tenant, kind, q.Get("collection"), q.Get("cursor"), limit)
+		if errors.Is(err, errInvalidCursor) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to count profiles: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Message: fmt.Sprintf("%d collections", len(page.Collections)), Data: page})
+	}
+}
+
+// queryPolicies returns a page of the rules stored per collection for a kind
+// (?collection=, ?limit=, ?cursor=)
+func queryPolicies(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		_, err := validateToken(r, service, ScopeReview)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+
+		q := r.URL.Query()
+		tenant, err := service.ResolveTenant(q.Get("tenant"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		kind, err := ResolveVerdictKind(q.Get("kind"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		limit, err := queryLimit(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		page, err := service.QueryPolicies(tenant, kind, q.Get("collection"), q.Get("cursor"), limit)
+		if errors.Is(err, errInvalidCursor) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to query policies: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Message: fmt.Sprintf("%d collection policies", len(page.Policies)), Data: page})
+	}
+}
+
+// tokens lists the API tokens on GET and issues one on POST
+// (?name=, ?scopes=review,push, ?expires_in=720h)
+func tokens(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		_, err := validateToken(r, service, ScopeAdmin)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			list, err := service.ListTokens()
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Failed to list tokens: %v", err), http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusOK, Response{Message: fmt.Sprintf("%d tokens", len(list)), Data: list})
+			return
+		}
+
+		scopes, err := parseScopes(r.URL.Query().Get("scopes"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		var ttl time.Duration
+		if value := r.URL.Query().Get("expires_in"); value != "" {
+			ttl, err = time.ParseDuration(value)
+			if err != nil || ttl <= 0 {
+				http.Error(w, fmt.Sprintf("invalid expires_in: %q", value), http.StatusBadRequest)
+				return
+			}
+		}
+
+		token, err := service.IssueToken(r.URL.Query().Get("name"), scopes, ttl)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to issue token: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		writeJSON(w, http.StatusCreated, Response{Message: "Token issued, it is shown only once", Data: token})
+	}
+}
+
+func revokeToken(service *Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		_, err := validateToken(r, service, ScopeAdmin)
+		if err != nil {
+			writeAuthError(w, err)
+			return
+		}
+
+		id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid token id: %q", r.PathValue("id")), http.StatusBadRequest)
+			return
+		}
+
+		token, err := service.RevokeToken(id)
+		if errors.Is(err, errTokenNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to revoke token: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, Response{Message: fmt.Sprintf("Token %d revoked", id), Data: token})
+	}
+}
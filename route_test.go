@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDetectDelimiterReadsHeaderOnly(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want rune
+	}{
+		{"comma", "id,collection_name,key,value,verdict\n1,a,process,/bin/sh,legitimate\n", ','},
+		{"semicolon", "id;collection_name;key;value;verdict\n1;a;process;/bin/sh;legitimate\n", ';'},
+		{"tab", "id\tcollection_name\tkey\tvalue\tverdict\n", '\t'},
+		{"semicolons in values", "id,collection_name,key,value,verdict,commands\n1,a,process,/bin/sh,legitimate,\"sh -c a;b;c;d;e;f;g\"\n", ','},
+		{"no newline", "id;collection_name;key;value;verdict", ';'},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := detectDelimiter([]byte(tt.data)); got != tt.want {
+				t.Errorf("detectDelimiter = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseCSVWithAutoDetectReadsExport(t *testing.T) {
+	details := detailColumns([]ProfileDetail{{User: "root", Command: "sh -c a;b"}, {User: "app", Command: "sh -c c;d"}})
+	data := "id,collection_name,key,value,verdict,remarks," + strings.Join(detailHeader, ",") + "\n" +
+		"7,payments,process,/bin/sh,legitimate,ok," + strings.Join(details, ",") + "\n"
+
+	rows, err := parseCSVWithAutoDetect(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Problem != "" {
+		t.Fatalf("rows = %+v", rows)
+	}
+	want := CapabilitiesCSVHeader{ID: "7", CollectionName: "payments", Key: "process", Value: "/bin/sh", Verdict: "legitimate", Remarks: "ok"}
+	if rows[0].Record != want {
+		t.Errorf("record = %+v, want %+v", rows[0].Record, want)
+	}
+}
+
+func TestRequestReviewerMarksClaimedNames(t *testing.T) {
+	shared := Caller{Name: "token", Shared: true}
+	named := Caller{Name: "alice"}
+	tests := []struct {
+		name   string
+		caller Caller
+		header string
+		want   string
+	}{
+		{"named token", named, "", "alice"},
+		{"named token ignores the header", named, "mallory", "alice"},
+		{"shared token", shared, "", "token"},
+		{"shared token with a claimed name", shared, " alice ", "token:alice"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/verdict/review", nil)
+			if tt.header != "" {
+				r.Header.Set("X-Reviewer", tt.header)
+			}
+			if got := requestReviewer(r, tt.caller); got != tt.want {
+				t.Errorf("requestReviewer = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,396 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+// parsePort reads a port number stored as a profile value
+func parsePort(key, value string) (int, error) {
+	port, err := strconv.Atoi(value)
+	if err != nil || port < 1 || port > 65535 {
+		return 0, fmt.Errorf("invalid port %q for key %s", value, key)
+	}
+	return port, nil
+}
+
+// portEnd returns the last port of a range; Prisma omits end for a single port
+func portEnd(start, end int) int {
+	if end == 0 {
+		return start
+	}
+	return end
+}
+
+// Ids of the runtime policies in Prisma Cloud
+const (
+	containerPolicyID   = "containerRuntime"
+	hostPolicyID        = "hostRuntime"
+	appEmbeddedPolicyID = "appEmbeddedRuntime"
+)
+
+// newContainerRule is the rule created for a collection that has none yet,
+// named after and scoped to that collection
+func newContainerRule(collection string) ContainerRule {
+	return ContainerRule{
+		Name:        collection,
+		Collections: []Collection{{Name: collection}},
+		DNS: DNSRule{
+			DomainList: DomainList{
+				Allowed: []string{},
+				Denied:  []string{},
+			},
+		},
+		Filesystem: FileSystemRule{
+			AllowedList: []string{},
+			DeniedList:  FileSystemDeniedList{Paths: []string{}},
+		},
+		Network: NetworkRule{
+			AllowedIPs:     []string{},
+			DeniedIPs:      []string{},
+			ListeningPorts: ContainerPort{Allowed: []ContainerPortObject{}, Denied: []ContainerPortObject{}},
+			OutboundPorts:  ContainerPort{Allowed: []ContainerPortObject{}, Denied: []ContainerPortObject{}},
+		},
+		Processes: ProcessRule{
+			AllowedList: []string{},
+			DeniedList:  DeniedList{Paths: []string{}},
+		},
+	}
+}
+
+// newHostRule is the rule created for a host collection that has none yet
+func newHostRule(collection string) HostRule {
+	return HostRule{
+		Name:        collection,
+		Collections: []Collection{{Name: collection}},
+		AntiMalware: HostAntiMalwareRule{
+			AllowedProcesses: []string{},
+			DeniedProcesses:  DeniedList{Paths: []string{}},
+		},
+		Network: HostNetworkRule{
+			AllowedOutboundIPs:   []string{},
+			DeniedListeningPorts: []PortRange{},
+			DeniedOutboundIPs:    []string{},
+			DeniedOutboundPorts:  []PortRange{},
+		},
+	}
+}
+
+// newAppEmbeddedRule is the rule created for an app-embedded collection that has none yet
+func newAppEmbeddedRule(collection string) AppEmbeddedRule {
+	return AppEmbeddedRule{
+		Name:        collection,
+		Collections: []Collection{{Name: collection}},
+		DNS: DNSRule{
+			DomainList: DomainList{
+				Allowed: []string{},
+				Denied:  []string{},
+			},
+		},
+		Network: NetworkRule{
+			AllowedIPs:     []string{},
+			DeniedIPs:      []string{},
+			ListeningPorts: ContainerPort{Allowed: []ContainerPortObject{}, Denied: []ContainerPortObject{}},
+			OutboundPorts:  ContainerPort{Allowed: []ContainerPortObject{}, Denied: []ContainerPortObject{}},
+		},
+		Processes: AppEmbeddedProcessRule{
+			Blacklist: []string{},
+			Whitelist: []string{},
+		},
+	}
+}
+
+// denyEffects are the effects VERDICT_DENY_EFFECT may switch a deny list to
+var denyEffects = []string{"alert", "prevent", "block"}
+
+// applyContainerVerdict writes a reviewed profile entry into a container rule.
+// A legitimate entry is allowed and taken off the deny side, a not_legitimate
+// one is denied and taken off the allow side. When denyEffect is set, the deny
+// list receiving an entry is switched to that effect. It reports whether the
+// rule changed, so other verdicts and entries already in place report false.
+func applyContainerVerdict(rule *ContainerRule, key, value, verdict, denyEffect string) (bool, error) {
+	if verdict != "legitimate" && verdict != "not_legitimate" {
+		return false, nil
+	}
+	deny := verdict == "not_legitimate"
+	changed := false
+
+	// allowDeny moves value between the allow and deny side of a string list
+	allowDeny := func(allowed, denied *[]string, effect *string) {
+		if deny {
+			changed = moveString(allowed, denied, value)
+			changed = setEffect(effect, denyEffect) || changed
+		} else {
+			changed = moveString(denied, allowed, value)
+		}
+	}
+
+	switch key {
+	case "dns_queries":
+		allowDeny(&rule.DNS.DomainList.Allowed, &rule.DNS.DomainList.Denied, &rule.DNS.DomainList.Effect)
+	case "processes", "process":
+		allowDeny(&rule.Processes.AllowedList, &rule.Processes.DeniedList.Paths, &rule.Processes.DeniedList.Effect)
+	case "filesystem_static", "filesystem":
+		allowDeny(&rule.Filesystem.AllowedList, &rule.Filesystem.DeniedList.Paths, &rule.Filesystem.DeniedList.Effect)
+	case "listening_port", "listening_port_static", "outbound_port":
+		port, err := parsePort(key, value)
+		if err != nil {
+			return false, err
+		}
+		ports := &rule.Network.OutboundPorts
+		if key != "outbound_port" {
+			ports = &rule.Network.ListeningPorts
+		}
+		if deny {
+			changed = movePort(&ports.Allowed, &ports.Denied, port, true)
+			changed = setEffect(&ports.Effect, denyEffect) || changed
+		} else {
+			changed = movePort(&ports.Denied, &ports.Allowed, port, false)
+		}
+	default:
+		return false, fmt.Errorf("unknown key type: %s", key)
+	}
+
+	return changed, nil
+}
+
+// applyHostVerdict writes a reviewed host profile entry into a host rule like
+// applyContainerVerdict does for containers, and likewise reports whether the
+// rule changed. Host rules have no allow list for ports, so an approved port
+// is only taken off the deny lists. When denyEffect is set, the deny list
+// receiving an entry is switched to that effect; the network deny lists share
+// one effect.
+func applyHostVerdict(rule *HostRule, key, value, verdict, denyEffect string) (bool, error) {
+	if verdict != "legitimate" && verdict != "not_legitimate" {
+		return false, nil
+	}
+	deny := verdict == "not_legitimate"
+	changed := false
+
+	// allowDeny moves value between the allow and deny side of a string list
+	allowDeny := func(allowed, denied *[]string, effect *string) {
+		if deny {
+			changed = moveString(allowed, denied, value)
+			changed = setEffect(effect, denyEffect) || changed
+		} else {
+			changed = moveString(denied, allowed, value)
+		}
+	}
+
+	switch key {
+	case "process":
+		allowDeny(&rule.AntiMalware.AllowedProcesses, &rule.AntiMalware.DeniedProcesses.Paths, &rule.AntiMalware.DeniedProcesses.Effect)
+	case "outgoing_ip":
+		allowDeny(&rule.Network.AllowedOutboundIPs, &rule.Network.DeniedOutboundIPs, &rule.Network.DenyListEffect)
+	case "listening_port", "outgoing_port":
+		port, err := parsePort(key, value)
+		if err != nil {
+			return false, err
+		}
+		ports := &rule.Network.DeniedOutboundPorts
+		if key == "listening_port" {
+			ports = &rule.Network.DeniedListeningPorts
+		}
+		if deny {
+			*ports, changed = addHostPort(*ports, port)
+			changed = setEffect(&rule.Network.DenyListEffect, denyEffect) || changed
+		} else {
+			*ports, changed = removePort(*ports, port)
+		}
+	default:
+		return false, fmt.Errorf("unknown key type: %s", key)
+	}
+
+	return changed, nil
+}
+
+// appEmbeddedMetadataKeys are the app-embedded profile entries that describe
+// where an app runs rather than what it does, so a rule has nothing to enforce for them
+var appEmbeddedMetadataKeys = []string{"profile_id", "app_id", "cluster", "cluster_type", "container", "image", "image_id", "start_time"}
+
+// applyAppEmbeddedVerdict writes a reviewed app-embedded profile entry into an
+// app-embedded rule like applyContainerVerdict does for containers. Metadata
+// entries are reviewed but not enforced, so they leave the rule unchanged.
+func applyAppEmbeddedVerdict(rule *AppEmbeddedRule, key, value, verdict, denyEffect string) (bool, error) {
+	if verdict != "legitimate" && verdict != "not_legitimate" || slices.Contains(appEmbeddedMetadataKeys, key) {
+		return false, nil
+	}
+	deny := verdict == "not_legitimate"
+	changed := false
+
+	// allowDeny moves value between the allow and deny side of a string list
+	allowDeny := func(allowed, denied *[]string, effect *string) {
+		if deny {
+			changed = moveString(allowed, denied, value)
+			changed = setEffect(effect, denyEffect) || changed
+		} else {
+			changed = moveString(denied, allowed, value)
+		}
+	}
+
+	switch key {
+	case "dns_queries":
+		allowDeny(&rule.DNS.DomainList.Allowed, &rule.DNS.DomainList.Denied, &rule.DNS.DomainList.Effect)
+	case "processes":
+		allowDeny(&rule.Processes.Whitelist, &rule.Processes.Blacklist, &rule.Processes.Effect)
+	case "outbound_ip":
+		allowDeny(&rule.Network.AllowedIPs, &rule.Network.DeniedIPs, &rule.Network.DeniedIPsEffect)
+	case "listening_port", "outbound_port":
+		port, err := parsePort(key, value)
+		if err != nil {
+			return false, err
+		}
+		ports := &rule.Network.OutboundPorts
+		if key == "listening_port" {
+			ports = &rule.Network.ListeningPorts
+		}
+		if deny {
+			changed = movePort(&ports.Allowed, &ports.Denied, port, true)
+			changed = setEffect(&ports.Effect, denyEffect) || changed
+		} else {
+			changed = movePort(&ports.Denied, &ports.Allowed, port, false)
+		}
+	default:
+		return false, fmt.Errorf("unknown key type: %s", key)
+	}
+
+	return changed, nil
+}
+
+// setEffect switches a deny list effect when one is configured and reports
+// whether that changed it
+func setEffect(effect *string, denyEffect string) bool {
+	if denyEffect == "" || *effect == denyEffect {
+		return false
+	}
+	*effect = denyEffect
+	return true
+}
+
+// moveString takes value off one list and onto another and reports whether
+// either of them changed
+func moveString(from, to *[]string, value string) bool {
+	fromLen, toLen := len(*from), len(*to)
+	*from, *to = removeString(*from, value), addString(*to, value)
+	return len(*from) != fromLen || len(*to) != toLen
+}
+
+// movePort takes port off one container port list and onto another and
+// reports whether either of them changed
+func movePort(from, to *[]ContainerPortObject, port int, deny bool) bool {
+	removed := removeContainerPort(*from, port)
+	changed := !slices.Equal(removed, *from)
+	*from = removed
+
+	var added bool
+	*to, added = addPort(*to, port, deny)
+	return changed || added
+}
+
+// addString appends value unless the list already has it. The list passed
+// in is never written to.
+func addString(list []string, value string) []string {
+	if list == nil {
+		list = []string{}
+	}
+	if slices.Contains(list, value) {
+		return list
+	}
+	return append(slices.Clip(list), value)
+}
+
+// removeString drops every occurrence of value from a copy of the list
+func removeString(list []string, value string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return slices.DeleteFunc(slices.Clone(list), func(v string) bool { return v == value })
+}
+
+// addPort adds a single port to a container port list and coalesces
+// overlapping or adjacent ranges, so approving 80, 81 and 82 one by one ends
+// up as a single 80-82 range. It reports false when the port was already covered.
+func addPort(ports []ContainerPortObject, port int, deny bool) ([]ContainerPortObject, bool) {
+	for _, p := range ports {
+		if p.Deny == deny && p.Start <= port && port <= portEnd(p.Start, p.End) {
+			return ports, false
+		}
+	}
+
+	return coalescePorts(append(slices.Clip(ports), ContainerPortObject{Deny: deny, Start: port, End: port})), true
+}
+
+// coalescePorts sorts port ranges and merges those that overlap or touch.
+// Ranges with a different deny flag are never merged.
+func coalescePorts(ports []ContainerPortObject) []ContainerPortObject {
+	sorted := slices.Clone(ports)
+	slices.SortFunc(sorted, func(a, b ContainerPortObject) int {
+		if a.Deny != b.Deny {
+			if a.Deny {
+				return 1
+			}
+			return -1
+		}
+		return a.Start - b.Start
+	})
+
+	merged := []ContainerPortObject{}
+	for _, p := range sorted {
+		p.End = portEnd(p.Start, p.End)
+		if last := len(merged) - 1; last >= 0 && merged[last].Deny == p.Deny && p.Start <= merged[last].End+1 {
+			merged[last].End = max(merged[last].End, p.End)
+			continue
+		}
+		merged = append(merged, p)
+	}
+	return merged
+}
+
+// removeContainerPort drops a single port from port ranges, splitting a range that contains it
+func removeContainerPort(ports []ContainerPortObject, port int) []ContainerPortObject {
+	result := []ContainerPortObject{}
+	for _, p := range ports {
+		end := portEnd(p.Start, p.End)
+		if port < p.Start || port > end {
+			result = append(result, p)
+			continue
+		}
+		if port > p.Start {
+			result = append(result, ContainerPortObject{Deny: p.Deny, Start: p.Start, End: port - 1})
+		}
+		if port < end {
+			result = append(result, ContainerPortObject{Deny: p.Deny, Start: port + 1, End: end})
+		}
+	}
+	return result
+}
+
+// removePort is removeContainerPort for the port ranges of host rules. It
+// reports false when no range covered the port.
+func removePort(ranges []PortRange, port int) ([]PortRange, bool) {
+	removed := toPortRanges(removeContainerPort(toContainerPorts(ranges), port))
+	return removed, !slices.Equal(removed, ranges)
+}
+
+// addHostPort is addPort for the deny lists of host rules
+func addHostPort(ranges []PortRange, port int) ([]PortRange, bool) {
+	ports, added := addPort(toContainerPorts(ranges), port, true)
+	return toPortRanges(ports), added
+}
+
+func toContainerPorts(ranges []PortRange) []ContainerPortObject {
+	ports := make([]ContainerPortObject, len(ranges))
+	for i, pr := range ranges {
+		ports[i] = ContainerPortObject(pr)
+	}
+	return ports
+}
+
+func toPortRanges(ports []ContainerPortObject) []PortRange {
+	ranges := make([]PortRange, len(ports))
+	for i, p := range ports {
+		ranges[i] = PortRange(p)
+	}
+	return ranges
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestApplyHostVerdict(t *testing.T) {
+	base := func() HostRule {
+		rule := newHostRule("hosts")
+		rule.AntiMalware.AllowedProcesses = []string{"/usr/bin/curl"}
+		rule.Network.AllowedOutboundIPs = []string{"10.0.0.1"}
+		rule.Network.DeniedOutboundIPs = []string{"10.0.0.9"}
+		rule.Network.DeniedListeningPorts = []PortRange{{Deny: true, Start: 8000, End: 8010}}
+		return rule
+	}
+
+	tests := []struct {
+		name          string
+		key, value    string
+		verdict       string
+		denyEffect    string
+		want          func(rule *HostRule)
+		wantUnchanged bool
+	}{
+		{
+			name: "denied process", key: "process", value: "/usr/bin/curl", verdict: "not_legitimate", denyEffect: "prevent",
+			want: func(rule *HostRule) {
+				rule.AntiMalware.AllowedProcesses = []string{}
+				rule.AntiMalware.DeniedProcesses = DeniedList{Effect: "prevent", Paths: []string{"/usr/bin/curl"}}
+			},
+		},
+		{
+			name: "denied outgoing ip keeps the effect without VERDICT_DENY_EFFECT", key: "outgoing_ip", value: "10.0.0.1", verdict: "not_legitimate",
+			want: func(rule *HostRule) {
+				rule.Network.AllowedOutboundIPs = []string{}
+				rule.Network.DeniedOutboundIPs = []string{"10.0.0.9", "10.0.0.1"}
+			},
+		},
+		{
+			name: "approved outgoing ip", key: "outgoing_ip", value: "10.0.0.9", verdict: "legitimate",
+			want: func(rule *HostRule) {
+				rule.Network.AllowedOutboundIPs = []string{"10.0.0.1", "10.0.0.9"}
+				rule.Network.DeniedOutboundIPs = []string{}
+			},
+		},
+		{
+			name: "denied listening port joins the adjacent range", key: "listening_port", value: "8011", verdict: "not_legitimate", denyEffect: "block",
+			want: func(rule *HostRule) {
+				rule.Network.DeniedListeningPorts = []PortRange{{Deny: true, Start: 8000, End: 8011}}
+				rule.Network.DenyListEffect = "block"
+			},
+		},
+		{
+			name: "approved listening port splits the range", key: "listening_port", value: "8005", verdict: "legitimate",
+			want: func(rule *HostRule) {
+				rule.Network.DeniedListeningPorts = []PortRange{{Deny: true, Start: 8000, End: 8004}, {Deny: true, Start: 8006, End: 8010}}
+			},
+		},
+		{
+			name: "denied outgoing port", key: "outgoing_port", value: "443", verdict: "not_legitimate", denyEffect: "alert",
+			want: func(rule *HostRule) {
+				rule.Network.DeniedOutboundPorts = []PortRange{{Deny: true, Start: 443, End: 443}}
+				rule.Network.DenyListEffect = "alert"
+			},
+		},
+		{
+			name: "process already allowed", key: "process", value: "/usr/bin/curl", verdict: "legitimate",
+			want: func(rule *HostRule) {}, wantUnchanged: true,
+		},
+		{
+			name: "outgoing ip already denied", key: "outgoing_ip", value: "10.0.0.9", verdict: "not_legitimate",
+			want: func(rule *HostRule) {}, wantUnchanged: true,
+		},
+		{
+			name: "listening port inside the denied range", key: "listening_port", value: "8005", verdict: "not_legitimate",
+			want: func(rule *HostRule) {}, wantUnchanged: true,
+		},
+		{
+			name: "approved port that was never denied", key: "outgoing_port", value: "443", verdict: "legitimate",
+			want: func(rule *HostRule) {}, wantUnchanged: true,
+		},
+		{
+			name: "not yet reviewed", key: "process", value: "/usr/bin/curl", verdict: "not_yet",
+			want: func(rule *HostRule) {}, wantUnchanged: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := base()
+			changed, err := applyHostVerdict(&rule, tt.key, tt.value, tt.verdict, tt.denyEffect)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changed == tt.wantUnchanged {
+				t.Errorf("changed = %v", changed)
+			}
+			want := base()
+			tt.want(&want)
+			if !reflect.DeepEqual(rule, want) {
+				t.Errorf("rule = %+v\nwant   %+v", rule, want)
+			}
+		})
+	}
+
+	rule := base()
+	if _, err := applyHostVerdict(&rule, "listening_port", "http", "not_legitimate", ""); err == nil {
+		t.Error("want an error for an invalid port")
+	}
+}
+
+func TestApplyContainerVerdict(t *testing.T) {
+	base := func() ContainerRule {
+		rule := newContainerRule("payments")
+		rule.Processes.AllowedList = []string{"/bin/sh"}
+		rule.Processes.DeniedList = DeniedList{Effect: "alert", Paths: []string{"/bin/nc"}}
+		rule.DNS.DomainList.Allowed = []string{"example.com"}
+		rule.Network.ListeningPorts.Allowed = []ContainerPortObject{{Start: 80, End: 90}}
+		rule.Network.OutboundPorts.Denied = []ContainerPortObject{{Deny: true, Start: 25, End: 25}}
+		return rule
+	}
+
+	tests := []struct {
+		name          string
+		key, value    string
+		verdict       string
+		denyEffect    string
+		want          func(rule *ContainerRule)
+		wantUnchanged bool
+	}{
+		{
+			name: "approved process", key: "processes", value: "/bin/ls", verdict: "legitimate",
+			want: func(rule *ContainerRule) { rule.Processes.AllowedList = []string{"/bin/sh", "/bin/ls"} },
+		},
+		{
+			name: "denied process moves off the allow list", key: "processes", value: "/bin/sh", verdict: "not_legitimate",
+			want: func(rule *ContainerRule) {
+				rule.Processes.AllowedList = []string{}
+				rule.Processes.DeniedList.Paths = []string{"/bin/nc", "/bin/sh"}
+			},
+		},
+		{
+			name: "approved port outside the allowed range", key: "listening_port", value: "91", verdict: "legitimate",
+			want: func(rule *ContainerRule) {
+				rule.Network.ListeningPorts.Allowed = []ContainerPortObject{{Start: 80, End: 91}}
+			},
+		},
+		{
+			name: "VERDICT_DENY_EFFECT on an entry already denied", key: "processes", value: "/bin/nc", verdict: "not_legitimate", denyEffect: "prevent",
+			want: func(rule *ContainerRule) { rule.Processes.DeniedList.Effect = "prevent" },
+		},
+		{
+			name: "process already allowed", key: "processes", value: "/bin/sh", verdict: "legitimate",
+			want: func(rule *ContainerRule) {}, wantUnchanged: true,
+		},
+		{
+			name: "process already denied with its effect", key: "processes", value: "/bin/nc", verdict: "not_legitimate", denyEffect: "alert",
+			want: func(rule *ContainerRule) {}, wantUnchanged: true,
+		},
+		{
+			name: "domain already allowed", key: "dns_queries", value: "example.com", verdict: "legitimate",
+			want: func(rule *ContainerRule) {}, wantUnchanged: true,
+		},
+		{
+			name: "port inside the allowed range", key: "listening_port", value: "85", verdict: "legitimate",
+			want: func(rule *ContainerRule) {}, wantUnchanged: true,
+		},
+		{
+			name: "port already denied", key: "outbound_port", value: "25", verdict: "not_legitimate",
+			want: func(rule *ContainerRule) {}, wantUnchanged: true,
+		},
+		{
+			name: "not yet reviewed", key: "processes", value: "/bin/ls", verdict: "not_yet",
+			want: func(rule *ContainerRule) {}, wantUnchanged: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := base()
+			changed, err := applyContainerVerdict(&rule, tt.key, tt.value, tt.verdict, tt.denyEffect)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changed == tt.wantUnchanged {
+				t.Errorf("changed = %v", changed)
+			}
+			want := base()
+			tt.want(&want)
+			if !reflect.DeepEqual(rule, want) {
+				t.Errorf("rule = %+v\nwant   %+v", rule, want)
+			}
+		})
+	}
+}
+
+func TestCoalescePorts(t *testing.T) {
+	tests := []struct {
+		name  string
+		ports []ContainerPortObject
+		want  []ContainerPortObject
+	}{
+		{"empty", nil, []ContainerPortObject{}},
+		{"single port gets an end", []ContainerPortObject{{Start: 80}}, []ContainerPortObject{{Start: 80, End: 80}}},
+		{"adjacent", []ContainerPortObject{{Start: 82, End: 82}, {Start: 80, End: 80}, {Start: 81, End: 81}}, []ContainerPortObject{{Start: 80, End: 82}}},
+		{"overlapping", []ContainerPortObject{{Start: 80, End: 90}, {Start: 85, End: 95}}, []ContainerPortObject{{Start: 80, End: 95}}},
+		{"contained", []ContainerPortObject{{Start: 80, End: 90}, {Start: 82, End: 83}}, []ContainerPortObject{{Start: 80, End: 90}}},
+		{"gap", []ContainerPortObject{{Start: 80, End: 80}, {Start: 82, End: 82}}, []ContainerPortObject{{Start: 80, End: 80}, {Start: 82, End: 82}}},
+		{
+			"deny flag kept apart",
+			[]ContainerPortObject{{Deny: true, Start: 81, End: 81}, {Start: 80, End: 80}, {Start: 82, End: 82}},
+			[]ContainerPortObject{{Start: 80, End: 80}, {Start: 82, End: 82}, {Deny: true, Start: 81, End: 81}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := coalescePorts(tt.ports); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("coalescePorts = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRemoveContainerPort(t *testing.T) {
+	tests := []struct {
+		name  string
+		ports []ContainerPortObject
+		port  int
+		want  []ContainerPortObject
+	}{
+		{"not covered", []ContainerPortObject{{Start: 80, End: 90}}, 443, []ContainerPortObject{{Start: 80, End: 90}}},
+		{"single port", []ContainerPortObject{{Start: 80}}, 80, []ContainerPortObject{}},
+		{"first of a range", []ContainerPortObject{{Start: 80, End: 90}}, 80, []ContainerPortObject{{Start: 81, End: 90}}},
+		{"last of a range", []ContainerPortObject{{Start: 80, End: 90}}, 90, []ContainerPortObject{{Start: 80, End: 89}}},
+		{"splits a range", []ContainerPortObject{{Deny: true, Start: 80, End: 90}}, 85, []ContainerPortObject{{Deny: true, Start: 80, End: 84}, {Deny: true, Start: 86, End: 90}}},
+		{"every range", []ContainerPortObject{{Start: 80, End: 81}, {Deny: true, Start: 81, End: 81}}, 81, []ContainerPortObject{{Start: 80, End: 80}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input := slices.Clone(tt.ports)
+			if got := removeContainerPort(tt.ports, tt.port); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("removeContainerPort = %+v, want %+v", got, tt.want)
+			}
+			if !slices.Equal(tt.ports, input) {
+				t.Errorf("input changed to %+v", tt.ports)
+			}
+		})
+	}
+}
+
+func TestAddPort(t *testing.T) {
+	ports := []ContainerPortObject{{Start: 80, End: 81}}
+	got, added := addPort(ports, 82, false)
+	if !added || !reflect.DeepEqual(got, []ContainerPortObject{{Start: 80, End: 82}}) {
+		t.Errorf("addPort = %+v, %v", got, added)
+	}
+	if got, added := addPort(ports, 81, false); added || !reflect.DeepEqual(got, ports) {
+		t.Errorf("addPort of a covered port = %+v, %v", got, added)
+	}
+	if !reflect.DeepEqual(ports, []ContainerPortObject{{Start: 80, End: 81}}) {
+		t.Errorf("input changed to %+v", ports)
+	}
+}
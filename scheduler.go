@@ -0,0 +1,239 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// scheduleSpecs maps every operation to its SCHEDULE_* cron expression; empty disables it
+func scheduleSpecs(cfg Config) map[string]string {
+	return map[string]string{
+		OpContainerProfiles:   cfg.ScheduleContainerProfiles,
+		OpHostProfiles:        cfg.ScheduleHostProfiles,
+		OpAppEmbeddedProfiles: cfg.ScheduleAppEmbeddedProfiles,
+		OpContainerPolicies:   cfg.ScheduleContainerPolicies,
+		OpHostPolicies:        cfg.ScheduleHostPolicies,
+		OpAppEmbeddedPolicies: cfg.ScheduleAppEmbeddedPolicies,
+		OpVerdictEmail:        cfg.ScheduleVerdictEmail,
+		OpDriftEmail:          cfg.ScheduleDriftEmail,
+		OpRetention:           cfg.ScheduleRetention,
+		OpWeeklyReport:        cfg.ScheduleWeeklyReport,
+	}
+}
+
+// ScheduleStatus describes one scheduled operation of one tenant
+type ScheduleStatus struct {
+	Tenant        string     `json:"tenant"`
+	Operation     string     `json:"operation"`
+	Expression    string     `json:"expression"`
+	LastRunAt     *time.Time `json:"last_run_at,omitempty"`
+	LastJobID     string     `json:"last_job_id,omitempty"`
+	LastJobStatus string     `json:"last_job_status,omitempty"`
+	NextRunAt     *time.Time `json:"next_run_at,omitempty"`
+}
+
+type scheduleEntry struct {
+	tenant     string
+	operation  string
+	expression string
+	schedule   *cronSchedule
+	next       time.Time
+	lastRunAt  *time.Time
+	lastJobID  string
+}
+
+// Scheduler submits operations as jobs on their cron schedules, for every
+// tenant. A run is skipped while the previous job of the same operation is
+// still queued or running. After a restart, a run missed within the catch-up
+// window is started once, however many runs were missed.
+type Scheduler struct {
+	Service  *Service
+	Location *time.Location
+	CatchUp  time.Duration
+
+	mu      sync.Mutex
+	entries []*scheduleEntry
+}
+
+func NewScheduler(service *Service, cfg Config) (*Scheduler, error) {
+	location, err := time.LoadLocation(cfg.ScheduleTimezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid SCHEDULE_TIMEZONE %q: %v", cfg.ScheduleTimezone, err)
+	}
+
+	scheduler := &Scheduler{
+		Service:  service,
+		Location: location,
+		CatchUp:  cfg.ScheduleCatchUp,
+	}
+
+	specs := scheduleSpecs(cfg)
+	for _, operation := range operations {
+		expression := strings.TrimSpace(specs[operation])
+		if expression == "" {
+			continue
+		}
+
+		schedule, err := parseCron(expression, location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule for %s: %v", operation, err)
+		}
+
+		for _, tenant := range service.Tenants {
+			scheduler.entries = append(scheduler.entries, &scheduleEntry{
+				tenant:     tenant.Name,
+				operation:  operation,
+				expression: expression,
+				schedule:   schedule,
+			})
+		}
+	}
+
+	return scheduler, nil
+}
+
+// Start loads the last runs, catches up on missed runs and starts the scheduling loop
+func (s *Scheduler) Start() error {
+	if len(s.entries) == 0 {
+		logger.Println("Scheduler: no schedules configured")
+		return nil
+	}
+
+	now := time.Now()
+
+	s.mu.Lock()
+	for _, entry := range s.entries {
+		lastRunAt, lastJobID, err := s.Service.Repo.GetScheduleRun(entry.tenant, entry.operation)
+		if err != nil {
+			s.mu.Unlock()
+			return fmt.Errorf("failed to load schedule state: %v", err)
+		}
+		if lastRunAt != nil {
+			local := lastRunAt.In(s.Location)
+			lastRunAt = &local
+		}
+		entry.lastRunAt = lastRunAt
+		entry.lastJobID = lastJobID
+
+		if err := s.Service.Repo.SaveScheduleExpression(entry.tenant, entry.operation, entry.expression); err != nil {
+			s.mu.Unlock()
+			return fmt.Errorf("failed to save schedule: %v", err)
+		}
+
+		entry.next = entry.schedule.Next(now)
+
+		// Catch up on the latest run missed while adam was down
+		if lastRunAt != nil && s.CatchUp > 0 {
+			missed := entry.schedule.Next(*lastRunAt)
+			if !missed.IsZero() && !missed.After(now) {
+				for next := entry.schedule.Next(missed); !next.IsZero() && !next.After(now); next = entry.schedule.Next(next) {
+					missed = next
+				}
+				if now.Sub(missed) <= s.CatchUp {
+					logger.Printf("Scheduler: catching up on %s for tenant %s missed at %s\n", entry.operation, entry.tenant, missed.Format(time.RFC3339))
+					s.fire(entry, missed)
+				} else {
+					logger.Printf("Scheduler: skipping %s for tenant %s missed at %s, outside the catch-up window\n", entry.operation, entry.tenant, missed.Format(time.RFC3339))
+				}
+			}
+		}
+
+		logger.Printf("Scheduler: %s for tenant %s on %q, next run %s\n", entry.operation, entry.tenant, entry.expression, entry.next.Format(time.RFC3339))
+	}
+	s.mu.Unlock()
+
+	go s.loop()
+	return nil
+}
+
+func (s *Scheduler) loop() {
+	for {
+		s.mu.Lock()
+		var next time.Time
+		for _, entry := range s.entries {
+			if !entry.next.IsZero() && (next.IsZero() || entry.next.Before(next)) {
+				next = entry.next
+			}
+		}
+		s.mu.Unlock()
+
+		if next.IsZero() {
+			logger.Println("Scheduler: no upcoming runs, stopping")
+			return
+		}
+
+		time.Sleep(time.Until(next))
+
+		now := time.Now()
+		s.mu.Lock()
+		for _, entry := range s.entries {
+			if !entry.next.IsZero() && !entry.next.After(now) {
+				s.fire(entry, entry.next)
+				entry.next = entry.schedule.Next(now)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+// fire submits the job of an entry for the run scheduled at scheduledAt. Callers hold s.mu.
+func (s *Scheduler) fire(entry *scheduleEntry, scheduledAt time.Time) {
+	fn, err := s.Service.Operation(entry.operation, entry.tenant, false)
+	if err != nil {
+		logger.Printf("Scheduler: %v\n", err)
+		return
+	}
+
+	job, err := s.Service.Jobs.Submit(entry.tenant, entry.operation, fn)
+	if errors.Is(err, errJobAlreadyActive) {
+		logger.Printf("Scheduler: skipping %s for tenant %s, job %s is still %s\n", entry.operation, entry.tenant, job.ID, job.Status)
+		return
+	}
+	if err != nil {
+		logger.Printf("Scheduler: failed to submit %s for tenant %s: %v\n", entry.operation, entry.tenant, err)
+		return
+	}
+
+	entry.lastRunAt = &scheduledAt
+	entry.lastJobID = job.ID
+	if err := s.Service.Repo.SaveScheduleRun(entry.tenant, entry.operation, scheduledAt, job.ID); err != nil {
+		logger.Printf("Warning: failed to record scheduled run of %s for tenant %s: %v\n", entry.operation, entry.tenant, err)
+	}
+	logger.Printf("Scheduler: started %s for tenant %s as job %s\n", entry.operation, entry.tenant, job.ID)
+}
+
+// Schedules lists every configured schedule with its last and next run
+func (s *Scheduler) Schedules() []ScheduleStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	statuses := []ScheduleStatus{}
+	for _, entry := range s.entries {
+		status := ScheduleStatus{
+			Tenant:     entry.tenant,
+			Operation:  entry.operation,
+			Expression: entry.expression,
+			LastRunAt:  entry.lastRunAt,
+			LastJobID:  entry.lastJobID,
+		}
+		if !entry.next.IsZero() {
+			next := entry.next
+			status.NextRunAt = &next
+		}
+		if entry.lastJobID != "" {
+			if job, err := s.Service.Jobs.Get(entry.lastJobID); err == nil {
+				status.LastJobStatus = job.Status
+			}
+		}
+		statuses = append(statuses, status)
+	}
+
+	sort.SliceStable(statuses, func(i, j int) bool {
+		return statuses[i].Tenant < statuses[j].Tenant
+	})
+	return statuses
+}
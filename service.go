@@ -1,108 +1,285 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 )
 
 type Service struct {
-	Repo *Repo
-	Cfg  Config
+	Repo    *Repo
+	Cfg     Config
+	Tenants []Tenant
+	Clients map[string]*PCClient
+	Jobs    *JobManager
 }
 
-func (s *Service) SendVerdict() error {
-	// Export CSV
-	csvFilename, err := s.Repo.ExportNotYetVerdict()
-	if err != nil {
-		return fmt.Errorf("failed to export CSV: %v", err)
+// ResolveTenant validates a tenant name, defaulting to the first configured tenant when empty
+func (s *Service) ResolveTenant(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return s.Tenants[0].Name, nil
 	}
 
-	// Send email
-	if err := sendEmailWithCSV(s.Cfg, csvFilename); err != nil {
-		return err
+	if _, ok := s.Clients[name]; !ok {
+		return "", fmt.Errorf("unknown tenant: %s", name)
+	}
+
+	return name, nil
+}
+
+// client returns the Prisma Cloud client of a tenant
+func (s *Service) client(tenant string) (*PCClient, error) {
+	client, ok := s.Clients[tenant]
+	if !ok {
+		return nil, fmt.Errorf("unknown tenant: %s", tenant)
+	}
+	return client, nil
+}
+
+// Operations that can run as jobs, on a schedule or from the command line
+const (
+	OpContainerProfiles   = "container-profiles"
+	OpHostProfiles        = "host-profiles"
+	OpAppEmbeddedProfiles = "app-embedded-profiles"
+	OpContainerPolicies   = "container-policies"
+	OpHostPolicies        = "host-policies"
+	OpAppEmbeddedPolicies = "app-embedded-policies"
+	OpVerdictEmail        = "verdict-email"
+	OpDriftEmail          = "drift-email"
+	OpRetention           = "retention"
+	OpWeeklyReport        = "weekly-report"
+)
+
+var operations = []string{
+	OpContainerProfiles,
+	OpHostProfiles,
+	OpAppEmbeddedProfiles,
+	OpContainerPolicies,
+	OpHostPolicies,
+	OpAppEmbeddedPolicies,
+	OpVerdictEmail,
+	OpDriftEmail,
+	OpRetention,
+	OpWeeklyReport,
+}
+
+// Operation returns the work of a named operation for a tenant, with its
+// result shaped like the response of the matching HTTP endpoint
+func (s *Service) Operation(name, tenant string, allowPartial bool) (JobFunc, error) {
+	switch name {
+	case OpContainerProfiles:
+		return func(ctx context.Context) (any, error) {
+			return s.FetchAndSaveProfiles(ctx, tenant, allowPartial)
+		}, nil
+	case OpHostProfiles:
+		return func(ctx context.Context) (any, error) {
+			return s.FetchAndSaveHostProfiles(ctx, tenant, allowPartial)
+		}, nil
+	case OpAppEmbeddedProfiles:
+		return func(ctx context.Context) (any, error) {
+			return s.FetchAndSaveAppEmbeddedProfiles(ctx, tenant, allowPartial)
+		}, nil
+	case OpContainerPolicies:
+		return func(ctx context.Context) (any, error) {
+			return map[string]string{"tenant": tenant}, s.FetchAndSavePolicies(ctx, tenant)
+		}, nil
+	case OpHostPolicies:
+		return func(ctx context.Context) (any, error) {
+			return map[string]string{"tenant": tenant}, s.FetchAndSaveHostPolicies(ctx, tenant)
+		}, nil
+	case OpAppEmbeddedPolicies:
+		return func(ctx context.Context) (any, error) {
+			return map[string]string{"tenant": tenant}, s.FetchAndSaveAppEmbeddedPolicies(ctx, tenant)
+		}, nil
+	case OpVerdictEmail:
+		return func(ctx context.Context) (any, error) {
+			return map[string]string{"tenant": tenant}, s.SendVerdict(tenant)
+		}, nil
+	case OpDriftEmail:
+		return func(ctx context.Context) (any, error) {
+			return s.SendDriftSummary(tenant)
+		}, nil
+	case OpRetention:
+		return func(ctx context.Context) (any, error) {
+			return s.ApplyRetention(tenant, false)
+		}, nil
+	case OpWeeklyReport:
+		return func(ctx context.Context) (any, error) {
+			return s.GenerateWeeklyAlertReport(ctx, tenant, false)
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unknown operation: %s (valid: %s)", name, strings.Join(operations, ", "))
+}
+
+// ResolveVerdictKind validates a profile kind for the verdict workflow,
+// defaulting to container profiles when empty
+func ResolveVerdictKind(name string) (string, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		return KindContainer, nil
 	}
+	if _, _, err := verdictTable(name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
 
-	// Delete the CSV file after sending
-	if err := os.Remove(csvFilename); err != nil {
-		fmt.Printf("Warning: failed to delete CSV file: %v\n", err)
+// SendVerdict emails the entries still waiting for a verdict, one email per
+// profile kind. Without kinds every kind is sent.
+func (s *Service) SendVerdict(tenant string, kinds ...string) error {
+	if len(kinds) == 0 {
+		kinds = verdictKinds
+	}
+
+	for _, kind := range kinds {
+		// Export CSV
+		csvFilename, err := s.Repo.ExportNotYetVerdict(tenant, kind, "")
+		if err != nil {
+			return fmt.Errorf("failed to export %s CSV: %v", kind, err)
+		}
+
+		// Send email
+		err = sendEmailWithCSV(s.Cfg, tenant, kind, csvFilename)
+
+		// Delete the CSV file after sending
+		if err := os.Remove(csvFilename); err != nil {
+			logger.Printf("Warning: failed to delete CSV file: %v\n", err)
+		}
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func (s *Service) FetchAndSaveProfiles() error {
-	token, err := login(s.Cfg.AccessKeyId, s.Cfg.SecretAccessKey)
-	if err != nil {
-		return fmt.Errorf("login failed: %v", err)
+// SyncResult reports what a profile sync fetched and whether it was saved
+type SyncResult struct {
+	Tenant     string      `json:"tenant"`
+	Fetched    int         `json:"fetched"`
+	Saved      bool        `json:"saved"`
+	RowsSaved  int         `json:"rows_saved"`
+	Partial    bool        `json:"partial"`
+	FetchError *FetchError `json:"fetch_error,omitempty"`
+	// Drift is how the saved entries changed since the previous sync
+	Drift *ProfileSync `json:"drift,omitempty"`
+}
+
+// checkFetch records a fetch error on the result and decides whether what was
+// fetched may still be saved. A partial dataset is only saved when allowPartial
+// is set, since it would otherwise look like a complete snapshot.
+func checkFetch(result *SyncResult, err error, allowPartial bool) error {
+	if err == nil {
+		return nil
 	}
 
-	profiles, err := getRuntimeContainerProfile(token)
+	var fetchErr *FetchError
+	if errors.As(err, &fetchErr) {
+		result.FetchError = fetchErr
+	}
+
+	if fetchErr == nil || !allowPartial || result.Fetched == 0 {
+		return err
+	}
+
+	result.Partial = true
+	logger.Printf("Warning: saving partial dataset of %d items: %v\n", result.Fetched, err)
+	return nil
+}
+
+func (s *Service) FetchAndSaveProfiles(ctx context.Context, tenant string, allowPartial bool) (SyncResult, error) {
+	result := SyncResult{Tenant: tenant}
+
+	client, err := s.client(tenant)
 	if err != nil {
-		return fmt.Errorf("failed to get profiles: %v", err)
+		return result, err
+	}
+
+	profiles, err := client.GetContainerProfiles(ctx)
+	result.Fetched = len(profiles)
+	if err := checkFetch(&result, err, allowPartial); err != nil {
+		return result, fmt.Errorf("failed to get profiles: %v", err)
 	}
 
 	// Save profiles to database
-	err = s.Repo.SaveProfiles(profiles)
+	seenAt := time.Now().UTC()
+	saved, err := s.Repo.SaveProfiles(tenant, profiles, seenAt)
 	if err != nil {
-		return fmt.Errorf("failed to save profiles: %v", err)
+		return result, fmt.Errorf("failed to save profiles: %v", err)
 	}
+	result.Saved = true
+	result.RowsSaved = saved
+	jobProgress(ctx).AddRows(saved)
 
-	fmt.Printf("Successfully saved data from %d profiles to database\n", len(profiles))
-	return nil
+	if err := s.recordDrift(&result, KindContainer, seenAt); err != nil {
+		return result, err
+	}
+
+	logger.Printf("Successfully saved data from %d profiles to database\n", len(profiles))
+	return result, nil
 }
 
-func (s *Service) FetchAndSavePolicies() error {
-	token, err := login(s.Cfg.AccessKeyId, s.Cfg.SecretAccessKey)
+func (s *Service) FetchAndSavePolicies(ctx context.Context, tenant string) error {
+	client, err := s.client(tenant)
 	if err != nil {
-		return fmt.Errorf("login failed: %v", err)
+		return err
 	}
 
-	policy, err := getAllRuntimeContainerPolicies(token)
+	policy, err := client.GetContainerPolicy(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get policies: %v", err)
 	}
 
 	// Save policies to database
-	err = s.Repo.SaveRules(policy)
+	_, err = s.storePolicy(tenant, KindContainer, SnapshotSync, policy)
 	if err != nil {
 		return fmt.Errorf("failed to save policies: %v", err)
 	}
+	jobProgress(ctx).AddRows(len(policy.Rules))
 
-	fmt.Printf("Successfully saved data from policy %s with %d rules to database\n", policy.ID, len(policy.Rules))
+	logger.Printf("Successfully saved data from policy %s with %d rules to database\n", policy.ID, len(policy.Rules))
 	return nil
 }
 
-func (s *Service) FetchAndSaveHostPolicies() error {
-	token, err := login(s.Cfg.AccessKeyId, s.Cfg.SecretAccessKey)
+func (s *Service) FetchAndSaveHostPolicies(ctx context.Context, tenant string) error {
+	client, err := s.client(tenant)
 	if err != nil {
-		return fmt.Errorf("login failed: %v", err)
+		return err
 	}
 
-	policy, err := getAllRuntimeHostPolicies(token)
+	policy, err := client.GetHostPolicy(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get host policies: %v", err)
 	}
 
 	// Save policies to database
-	err = s.Repo.SaveHostRules(policy)
+	_, err = s.storePolicy(tenant, KindHost, SnapshotSync, policy)
 	if err != nil {
 		return fmt.Errorf("failed to save host policies: %v", err)
 	}
+	jobProgress(ctx).AddRows(len(policy.Rules))
 
-	fmt.Printf("Successfully saved data from host policy %s with %d rules to database\n", policy.ID, len(policy.Rules))
+	logger.Printf("Successfully saved data from host policy %s with %d rules to database\n", policy.ID, len(policy.Rules))
 	return nil
 }
 
-func (s *Service) FetchAndSaveHostProfiles() error {
-	token, err := login(s.Cfg.AccessKeyId, s.Cfg.SecretAccessKey)
+func (s *Service) FetchAndSaveHostProfiles(ctx context.Context, tenant string, allowPartial bool) (SyncResult, error) {
+	result := SyncResult{Tenant: tenant}
+
+	client, err := s.client(tenant)
 	if err != nil {
-		return fmt.Errorf("login failed: %v", err)
+		return result, err
 	}
 
-	profiles, err := getRuntimeHostProfile(token)
-	if err != nil {
-		return fmt.Errorf("failed to get host profiles: %v", err)
+	profiles, err := client.GetHostProfiles(ctx)
+	result.Fetched = len(profiles)
+	if err := checkFetch(&result, err, allowPartial); err != nil {
+		return result, fmt.Errorf("failed to get host profiles: %v", err)
 	}
 
 	// Transform profiles into records with business logic
@@ -172,7 +349,7 @@ func (s *Service) FetchAndSaveHostProfiles() error {
 					}
 				}
 
-				// Save outgoing ports
+				// Save outgoing ports and the IPs they connect to
 				for _, op := range app.OutgoingPorts {
 					if op.Port > 0 {
 						records = append(records, HostProfileRecord{
@@ -182,30 +359,49 @@ func (s *Service) FetchAndSaveHostProfiles() error {
 							Value:          fmt.Sprintf("%d", op.Port),
 						})
 					}
+					if op.IP != "" {
+						records = append(records, HostProfileRecord{
+							HostID:         profile.ID,
+							CollectionName: collection,
+							Key:            "outgoing_ip",
+							Value:          op.IP,
+						})
+					}
 				}
 			}
 		}
 	}
 
 	// Save records to database
-	err = s.Repo.SaveHostProfileRecords(records)
+	seenAt := time.Now().UTC()
+	saved, err := s.Repo.SaveHostProfileRecords(tenant, records, seenAt)
 	if err != nil {
-		return fmt.Errorf("failed to save host profiles: %v", err)
+		return result, fmt.Errorf("failed to save host profiles: %v", err)
 	}
+	result.Saved = true
+	result.RowsSaved = saved
+	jobProgress(ctx).AddRows(saved)
 
-	fmt.Printf("Successfully saved data from %d host profiles to database\n", len(profiles))
-	return nil
+	if err := s.recordDrift(&result, KindHost, seenAt); err != nil {
+		return result, err
+	}
+
+	logger.Printf("Successfully saved data from %d host profiles to database\n", len(profiles))
+	return result, nil
 }
 
-func (s *Service) FetchAndSaveAppEmbeddedProfiles() error {
-	token, err := login(s.Cfg.AccessKeyId, s.Cfg.SecretAccessKey)
+func (s *Service) FetchAndSaveAppEmbeddedProfiles(ctx context.Context, tenant string, allowPartial bool) (SyncResult, error) {
+	result := SyncResult{Tenant: tenant}
+
+	client, err := s.client(tenant)
 	if err != nil {
-		return fmt.Errorf("login failed: %v", err)
+		return result, err
 	}
 
-	profiles, err := getAppEmbeddedProfile(token)
-	if err != nil {
-		return fmt.Errorf("failed to get app-embedded profiles: %v", err)
+	profiles, err := client.GetAppEmbeddedProfiles(ctx)
+	result.Fetched = len(profiles)
+	if err := checkFetch(&result, err, allowPartial); err != nil {
+		return result, fmt.Errorf("failed to get app-embedded profiles: %v", err)
 	}
 
 	// Transform profiles into records
@@ -308,116 +504,190 @@ func (s *Service) FetchAndSaveAppEmbeddedProfiles() error {
 					Value:         profile.ClusterType,
 				})
 			}
+
+			// Save what the app does, the entries a verdict pushes into its rule
+			for _, proc := range profile.Processes {
+				if proc.Path != "" {
+					records = append(records, AppEmbeddedProfileRecord{
+						ProfileID:      profile.ID,
+						AppID:          profile.AppID,
+						CollectionName: collection,
+						Key:            "processes",
+						Value:          proc.Path,
+					})
+				}
+			}
+
+			for _, query := range profile.DNSQueries {
+				if query.DomainName != "" {
+					records = append(records, AppEmbeddedProfileRecord{
+						ProfileID:      profile.ID,
+						AppID:          profile.AppID,
+						CollectionName: collection,
+						Key:            "dns_queries",
+						Value:          query.DomainName,
+					})
+				}
+			}
+
+			for _, port := range profile.Network.ListeningPorts {
+				if port.Port > 0 {
+					records = append(records, AppEmbeddedProfileRecord{
+						ProfileID:      profile.ID,
+						AppID:          profile.AppID,
+						CollectionName: collection,
+						Key:            "listening_port",
+						Value:          fmt.Sprintf("%d", port.Port),
+					})
+				}
+			}
+
+			for _, conn := range profile.Network.Outbound {
+				if conn.Port > 0 {
+					records = append(records, AppEmbeddedProfileRecord{
+						ProfileID:      profile.ID,
+						AppID:          profile.AppID,
+						CollectionName: collection,
+						Key:            "outbound_port",
+						Value:          fmt.Sprintf("%d", conn.Port),
+					})
+				}
+				if conn.IP != "" {
+					records = append(records, AppEmbeddedProfileRecord{
+						ProfileID:      profile.ID,
+						AppID:          profile.AppID,
+						CollectionName: collection,
+						Key:            "outbound_ip",
+						Value:          conn.IP,
+					})
+				}
+			}
 		}
 	}
 
 	// Save records to database
-	err = s.Repo.SaveAppEmbeddedProfiles(records)
+	seenAt := time.Now().UTC()
+	saved, err := s.Repo.SaveAppEmbeddedProfiles(tenant, records, seenAt)
 	if err != nil {
-		return fmt.Errorf("failed to save app-embedded profiles: %v", err)
+		return result, fmt.Errorf("failed to save app-embedded profiles: %v", err)
 	}
+	result.Saved = true
+	result.RowsSaved = saved
+	jobProgress(ctx).AddRows(saved)
 
-	fmt.Printf("Successfully saved data from %d app-embedded profiles to database\n", len(profiles))
-	return nil
+	if err := s.recordDrift(&result, KindAppEmbedded, seenAt); err != nil {
+		return result, err
+	}
+
+	logger.Printf("Successfully saved data from %d app-embedded profiles to database\n", len(profiles))
+	return result, nil
 }
 
-func (s *Service) FetchAndSaveAppEmbeddedPolicies() error {
-	token, err := login(s.Cfg.AccessKeyId, s.Cfg.SecretAccessKey)
+func (s *Service) FetchAndSaveAppEmbeddedPolicies(ctx context.Context, tenant string) error {
+	client, err := s.client(tenant)
 	if err != nil {
-		return fmt.Errorf("login failed: %v", err)
+		return err
 	}
 
-	policy, err := getAppEmbeddedPolicy(token)
+	policy, err := client.GetAppEmbeddedPolicy(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get app-embedded policies: %v", err)
 	}
 
 	// Save policies to database
-	err = s.Repo.SaveAppEmbeddedRules(policy)
+	_, err = s.storePolicy(tenant, KindAppEmbedded, SnapshotSync, policy)
 	if err != nil {
 		return fmt.Errorf("failed to save app-embedded policies: %v", err)
 	}
+	jobProgress(ctx).AddRows(len(policy.Rules))
 
-	fmt.Printf("Successfully saved data from app-embedded policy %s with %d rules to database\n", policy.ID, len(policy.Rules))
+	logger.Printf("Successfully saved data from app-embedded policy %s with %d rules to database\n", policy.ID, len(policy.Rules))
 	return nil
 }
 
-func (s *Service) PushVerdictToPrismaCloud(verdicts []CapabilitiesCSVHeader) (int, error) {
-	// Filter only legitimate verdicts
-	var legitimateVerdicts []CapabilitiesCSVHeader
-	for _, v := range verdicts {
-		if v.Verdict == "legitimate" {
-			legitimateVerdicts = append(legitimateVerdicts, v)
-		}
-	}
+// VerdictImportResult reports what an uploaded verdict CSV changed
+type VerdictImportResult struct {
+	Tenant        string `json:"tenant"`
+	Kind          string `json:"kind"`
+	UpdatedCount  int    `json:"updated_count"`
+	TotalRecords  int    `json:"total_records"`
+	PCPushedCount int    `json:"pc_pushed_count"`
+	PCPushError   string `json:"pc_push_error,omitempty"`
+	// PCConflicts lists the rules changed in the console that stopped the push
+	PCConflicts []RuleConflict `json:"pc_conflicts,omitempty"`
+	// Validation reports the rows of the imported file
+	Validation *VerdictValidation `json:"validation,omitempty"`
+}
 
-	if len(legitimateVerdicts) == 0 {
-		fmt.Println("No legitimate verdicts to push to Prisma Cloud")
-		return 0, nil
-	}
+// ImportVerdicts stores reviewed verdicts of a profile kind, recording who
+// changed what in the verdict history, and, when push is set, pushes the
+// reviewed ones to the matching Prisma Cloud runtime policy. A failed push is
+// reported in the result but is not an error, since the verdicts are already
+// saved locally.
+func (s *Service) ImportVerdicts(ctx context.Context, tenant, kind string, capabilities []CapabilitiesCSVHeader, push bool, provenance VerdictProvenance) (VerdictImportResult, error) {
+	result := VerdictImportResult{Tenant: tenant, Kind: kind, TotalRecords: len(capabilities)}
 
-	// Update rules in database for each verdict
-	addedCount := 0
-	for _, v := range legitimateVerdicts {
-		err := s.Repo.UpdateRuleWithVerdict(v.CollectionName, v.Key, v.Value)
-		if err != nil {
-			return 0, fmt.Errorf("failed to update rule for collection %s: %v", v.CollectionName, err)
-		}
-		addedCount++
-	}
-
-	// Get all rules from the database
-	rules, err := s.Repo.GetAllRules()
+	// Update verdicts in database
+	updatedCount, err := s.Repo.UpdateVerdicts(tenant, kind, capabilities, provenance)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get all rules: %v", err)
+		return result, fmt.Errorf("failed to update verdicts: %v", err)
 	}
+	result.UpdatedCount = updatedCount
 
-	if len(rules) == 0 {
-		fmt.Println("No rules found in database to push")
-		return 0, nil
+	if !push {
+		return result, nil
 	}
 
-	// Login to get token
-	token, err := login(s.Cfg.AccessKeyId, s.Cfg.SecretAccessKey)
+	// Push reviewed verdicts to Prisma Cloud
+	pcPushedCount, err := s.PushVerdicts(ctx, tenant, kind, capabilities)
 	if err != nil {
-		return 0, fmt.Errorf("login failed: %v", err)
-	}
+		// Log error but don't fail - local DB update succeeded
+		logger.Printf("Warning: Failed to push to Prisma Cloud: %v\n", err)
+		result.PCPushError = err.Error()
 
-	// Build policy with all rules from database
-	policy := ContainerPolicy{
-		ID:    "containerRuntime",
-		Rules: rules,
+		var conflict *PolicyConflictError
+		if errors.As(err, &conflict) {
+			result.PCConflicts = conflict.Conflicts
+		}
 	}
+	result.PCPushedCount = pcPushedCount
 
-	// Push updated policy back to Prisma Cloud
-	err = updateRuntimeContainerPolicy(token, policy)
-	if err != nil {
-		return 0, fmt.Errorf("failed to update runtime container policy: %v", err)
-	}
+	return result, nil
+}
 
-	fmt.Printf("Successfully pushed %d new rules to Prisma Cloud\n", addedCount)
-	return addedCount, nil
+// WeeklyReportResult summarizes a weekly CSPM alert report
+type WeeklyReportResult struct {
+	Tenant         string   `json:"tenant"`
+	AWSAlertsCount int      `json:"aws_alerts_count"`
+	GCPAlertsCount int      `json:"gcp_alerts_count"`
+	EmailedTo      string   `json:"emailed_to,omitempty"`
+	DryRun         bool     `json:"dry_run,omitempty"`
+	Files          []string `json:"files,omitempty"` // CSV files kept by a dry run
 }
 
-// GenerateWeeklyAlertReport generates the weekly CSPM alert report
-func (s *Service) GenerateWeeklyAlertReport() (int, int, error) {
-	// Login to Prisma Cloud
-	token, err := login(s.Cfg.AccessKeyId, s.Cfg.SecretAccessKey)
+// GenerateWeeklyAlertReport generates the weekly CSPM alert report. A dry run
+// fetches the alerts and writes the CSV files but keeps them instead of emailing.
+func (s *Service) GenerateWeeklyAlertReport(ctx context.Context, tenant string, dryRun bool) (WeeklyReportResult, error) {
+	result := WeeklyReportResult{Tenant: tenant, DryRun: dryRun}
+
+	client, err := s.client(tenant)
 	if err != nil {
-		return 0, 0, fmt.Errorf("login failed: %v", err)
+		return result, err
 	}
 
 	// Fetch AWS alerts
-	awsAlerts, err := getCSPMAlerts(token, s.Cfg.ComplianceStandard, "AWS", true)
+	awsAlerts, err := client.GetCSPMAlerts(ctx, s.Cfg.ComplianceStandard, "AWS", true)
 	if err != nil {
-		return 0, 0, fmt.Errorf("failed to fetch AWS alerts: %v", err)
+		return result, fmt.Errorf("failed to fetch AWS alerts: %v", err)
 	}
+	result.AWSAlertsCount = len(awsAlerts)
 
 	// Fetch GCP alerts
-	gcpAlerts, err := getCSPMAlerts(token, s.Cfg.ComplianceStandard, "GCP", true)
+	gcpAlerts, err := client.GetCSPMAlerts(ctx, s.Cfg.ComplianceStandard, "GCP", true)
 	if err != nil {
-		return 0, 0, fmt.Errorf("failed to fetch GCP alerts: %v", err)
+		return result, fmt.Errorf("failed to fetch GCP alerts: %v", err)
 	}
+	result.GCPAlertsCount = len(gcpAlerts)
 
 	// Combine alerts for CSV generation
 	allAlerts := append(awsAlerts, gcpAlerts...)
@@ -425,27 +695,38 @@ func (s *Service) GenerateWeeklyAlertReport() (int, int, error) {
 	// Generate CSV files
 	awsFile, gcpFile, err := generateAWSAndGCPCSVs(allAlerts)
 	if err != nil {
-		return 0, 0, fmt.Errorf("failed to generate CSV files: %v", err)
+		return result, fmt.Errorf("failed to generate CSV files: %v", err)
+	}
+
+	if dryRun {
+		for _, file := range []string{awsFile, gcpFile} {
+			if file != "" {
+				result.Files = append(result.Files, file)
+			}
+		}
+		logger.Printf("Weekly alert report dry run completed: AWS=%d, GCP=%d\n", len(awsAlerts), len(gcpAlerts))
+		return result, nil
 	}
 
 	// Send email with attachments
-	err = sendAlertEmailWithCSVs(s.Cfg, awsFile, gcpFile, s.Cfg.ComplianceStandard, len(awsAlerts), len(gcpAlerts))
+	err = sendAlertEmailWithCSVs(s.Cfg, tenant, awsFile, gcpFile, s.Cfg.ComplianceStandard, len(awsAlerts), len(gcpAlerts))
 	if err != nil {
-		return 0, 0, fmt.Errorf("failed to send email: %v", err)
+		return result, fmt.Errorf("failed to send email: %v", err)
 	}
+	result.EmailedTo = s.Cfg.WeeklyReportTo
 
 	// Cleanup CSV files after sending
 	if awsFile != "" {
 		if err := os.Remove(awsFile); err != nil {
-			fmt.Printf("Warning: failed to delete AWS CSV file: %v\n", err)
+			logger.Printf("Warning: failed to delete AWS CSV file: %v\n", err)
 		}
 	}
 	if gcpFile != "" {
 		if err := os.Remove(gcpFile); err != nil {
-			fmt.Printf("Warning: failed to delete GCP CSV file: %v\n", err)
+			logger.Printf("Warning: failed to delete GCP CSV file: %v\n", err)
 		}
 	}
 
-	fmt.Printf("Weekly alert report completed: AWS=%d, GCP=%d\n", len(awsAlerts), len(gcpAlerts))
-	return len(awsAlerts), len(gcpAlerts), nil
+	logger.Printf("Weekly alert report completed: AWS=%d, GCP=%d\n", len(awsAlerts), len(gcpAlerts))
+	return result, nil
 }
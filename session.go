@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// sessionDefaultTTL is used when the token expiry cannot be read from the JWT
+	sessionDefaultTTL = 10 * time.Minute
+	// sessionRenewBefore renews the token this long before it actually expires
+	sessionRenewBefore = 2 * time.Minute
+)
+
+// PCSession caches the Prisma Cloud token and renews it before it expires,
+// so a sync of several endpoints only authenticates when it has to
+type PCSession struct {
+	login func(ctx context.Context) (string, error)
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// NewPCSession caches the tokens returned by login
+func NewPCSession(login func(ctx context.Context) (string, error)) *PCSession {
+	return &PCSession{login: login}
+}
+
+// Token returns the cached token, logging in again when it is missing or about to expire
+func (s *PCSession) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token != "" && time.Until(s.expiresAt) > sessionRenewBefore {
+		return s.token, nil
+	}
+
+	token, err := s.login(ctx)
+	if err != nil {
+		return "", fmt.Errorf("login failed: %v", err)
+	}
+	if token == "" {
+		return "", fmt.Errorf("login failed: empty token in response")
+	}
+
+	s.token = token
+	s.expiresAt = tokenExpiry(token, time.Now())
+	logger.Printf("Authenticated to Prisma Cloud, token valid until %s\n", s.expiresAt.Format(time.RFC3339))
+
+	return s.token, nil
+}
+
+// Invalidate drops the cached token if it is still the given one, so the next
+// Token call re-authenticates. Passing the rejected token avoids throwing away
+// a token another caller has already renewed.
+func (s *PCSession) Invalidate(token string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.token == token {
+		s.token = ""
+		s.expiresAt = time.Time{}
+	}
+}
+
+// tokenExpiry reads the exp claim of a JWT, falling back to sessionDefaultTTL
+func tokenExpiry(token string, now time.Time) time.Time {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return now.Add(sessionDefaultTTL)
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return now.Add(sessionDefaultTTL)
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return now.Add(sessionDefaultTTL)
+	}
+
+	return time.Unix(claims.Exp, 0)
+}
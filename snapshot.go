@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Where a policy snapshot comes from
+const (
+	SnapshotSync           = "sync"
+	SnapshotPushBefore     = "push_before"
+	SnapshotPushAfter      = "push_after"
+	SnapshotRollbackBefore = "rollback_before"
+	SnapshotRollbackAfter  = "rollback_after"
+)
+
+var errSnapshotNotFound = errors.New("policy snapshot not found")
+
+// PolicySnapshot is one stored version of a runtime policy
+type PolicySnapshot struct {
+	ID          int64           `json:"id"`
+	Tenant      string          `json:"tenant"`
+	Kind        string          `json:"kind"`
+	Source      string          `json:"source"`
+	Fingerprint string          `json:"fingerprint"`
+	Rules       int             `json:"rules"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Policy      json.RawMessage `json:"policy,omitempty"`
+}
+
+// recordSnapshot stores a version of a runtime policy. Syncs only store a
+// version when the policy changed since the latest one.
+func (s *Service) recordSnapshot(tenant, kind, source string, policy any) (int64, error) {
+	policyJSON, err := json.Marshal(policy)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal policy: %v", err)
+	}
+
+	var rules struct {
+		Rules []json.RawMessage `json:"rules"`
+	}
+	if err := json.Unmarshal(policyJSON, &rules); err != nil {
+		return 0, fmt.Errorf("failed to decode policy: %v", err)
+	}
+
+	sum := sha256.Sum256(policyJSON)
+	snapshot := PolicySnapshot{
+		Tenant:      tenant,
+		Kind:        kind,
+		Source:      source,
+		Fingerprint: hex.EncodeToString(sum[:]),
+		Rules:       len(rules.Rules),
+		CreatedAt:   time.Now().UTC(),
+		Policy:      policyJSON,
+	}
+
+	id, err := s.Repo.SavePolicySnapshot(snapshot, source == SnapshotSync)
+	if err != nil {
+		return 0, fmt.Errorf("failed to save %s policy snapshot: %v", kind, err)
+	}
+	return id, nil
+}
+
+// storePolicy saves a runtime policy as fetched from Prisma Cloud: its rules
+// by collection, the synced copy verdict pushes merge against, and a version
+// in the snapshot history
+func (s *Service) storePolicy(tenant, kind, source string, policy any) (int64, error) {
+	var err error
+	switch p := policy.(type) {
+	case ContainerPolicy:
+		err = s.Repo.SaveRules(tenant, p)
+	case HostPolicy:
+		err = s.Repo.SaveHostRules(tenant, p)
+	case AppEmbeddedPolicy:
+		err = s.Repo.SaveAppEmbeddedRules(tenant, p)
+	default:
+		return 0, fmt.Errorf("unknown policy type %T", policy)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.Repo.SaveSyncedPolicy(tenant, kind, policy, time.Now().UTC()); err != nil {
+		return 0, fmt.Errorf("failed to save synced policy: %v", err)
+	}
+
+	return s.recordSnapshot(tenant, kind, source, policy)
+}
+
+// livePolicy fetches the runtime policy of a profile kind from Prisma Cloud
+func (s *Service) livePolicy(ctx context.Context, tenant, kind string) (any, error) {
+	if _, _, err := verdictTable(kind); err != nil {
+		return nil, err
+	}
+
+	client, err := s.client(tenant)
+	if err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case KindContainer:
+		return client.GetContainerPolicy(ctx)
+	case KindHost:
+		return client.GetHostPolicy(ctx)
+	default:
+		return client.GetAppEmbeddedPolicy(ctx)
+	}
+}
+
+// putPolicy replaces the runtime policy of its kind in Prisma Cloud
+func (s *Service) putPolicy(ctx context.Context, tenant string, policy any) error {
+	client, err := s.client(tenant)
+	if err != nil {
+		return err
+	}
+
+	switch p := policy.(type) {
+	case ContainerPolicy:
+		return client.PutContainerPolicy(ctx, p)
+	case HostPolicy:
+		return client.PutHostPolicy(ctx, p)
+	case AppEmbeddedPolicy:
+		return client.PutAppEmbeddedPolicy(ctx, p)
+	}
+	return fmt.Errorf("unknown policy type %T", policy)
+}
+
+// decodePolicy turns a stored policy back into the policy type of its kind
+func decodePolicy(kind string, data json.RawMessage) (any, error) {
+	var policy any
+	var err error
+	switch kind {
+	case KindContainer:
+		var p ContainerPolicy
+		err = json.Unmarshal(data, &p)
+		policy = p
+	case KindHost:
+		var p HostPolicy
+		err = json.Unmarshal(data, &p)
+		policy = p
+	case KindAppEmbedded:
+		var p AppEmbeddedPolicy
+		err = json.Unmarshal(data, &p)
+		policy = p
+	default:
+		_, _, err = verdictTable(kind)
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s policy: %v", kind, err)
+	}
+	return policy, nil
+}
+
+// ListSnapshots returns the latest policy versions of a tenant, all kinds when kind is empty
+func (s *Service) ListSnapshots(tenant, kind string, limit int) ([]PolicySnapshot, error) {
+	if kind != "" {
+		if _, _, err := verdictTable(kind); err != nil {
+			return nil, err
+		}
+	}
+	return s.Repo.ListPolicySnapshots(tenant, kind, limit)
+}
+
+// GetSnapshot returns a policy version of a tenant, policy included
+func (s *Service) GetSnapshot(tenant string, id int64) (PolicySnapshot, error) {
+	return s.Repo.GetPolicySnapshot(tenant, id)
+}
+
+// SnapshotDiff is what changed between two versions of a runtime policy
+type SnapshotDiff struct {
+	Kind string     `json:"kind"`
+	From string     `json:"from"`
+	To   string     `json:"to"`
+	Diff PolicyDiff `json:"diff"`
+}
+
+// DiffSnapshots compares two versions of the same runtime policy. Either side
+// is a snapshot id or "live" for the policy now in Prisma Cloud.
+func (s *Service) DiffSnapshots(ctx context.Context, tenant, from, to string) (SnapshotDiff, error) {
+	result := SnapshotDiff{From: from, To: to}
+	if from == "live" && to == "live" {
+		return result, fmt.Errorf("at least one side of a diff must be a snapshot id")
+	}
+
+	// The snapshot sides decide the kind, so resolve them before "live"
+	sides := map[string]any{}
+	for _, side := range []string{from, to} {
+		if side == "live" {
+			continue
+		}
+		id, err := strconv.ParseInt(side, 10, 64)
+		if err != nil {
+			return result, fmt.Errorf("invalid snapshot id %q, use a number or live", side)
+		}
+		snapshot, err := s.GetSnapshot(tenant, id)
+		if err != nil {
+			return result, err
+		}
+		if result.Kind != "" && result.Kind != snapshot.Kind {
+			return result, fmt.Errorf("cannot diff a %s policy against a %s policy", result.Kind, snapshot.Kind)
+		}
+		result.Kind = snapshot.Kind
+		sides[side] = snapshot.Policy
+	}
+	if from == "live" || to == "live" {
+		live, err := s.livePolicy(ctx, tenant, result.Kind)
+		if err != nil {
+			return result, fmt.Errorf("failed to get live %s policy: %v", result.Kind, err)
+		}
+		sides["live"] = live
+	}
+
+	diff, err := diffPolicies(sides[from], sides[to])
+	if err != nil {
+		return result, err
+	}
+	result.Diff = diff
+	return result, nil
+}
+
+// RollbackResult reports a rollback of a runtime policy to a stored version
+type RollbackResult struct {
+	Tenant string `json:"tenant"`
+	Kind   string `json:"kind"`
+	// SnapshotID is the version rolled back to
+	SnapshotID int64 `json:"snapshot_id"`
+	// BeforeID and AfterID are the versions stored around the rollback, so it can be undone
+	BeforeID int64      `json:"before_id,omitempty"`
+	AfterID  int64      `json:"after_id,omitempty"`
+	DryRun   bool       `json:"dry_run"`
+	Diff     PolicyDiff `json:"diff"`
+}
+
+// RollbackPolicy puts a stored version of a runtime policy back into Prisma
+// Cloud. A dry run only returns what the rollback would change in the live policy.
+func (s *Service) RollbackPolicy(ctx context.Context, tenant string, id int64, dryRun bool) (RollbackResult, error) {
+	result := RollbackResult{Tenant: tenant, SnapshotID: id, DryRun: dryRun}
+
+	snapshot, err := s.GetSnapshot(tenant, id)
+	if err != nil {
+		return result, err
+	}
+	result.Kind = snapshot.Kind
+
+	target, err := decodePolicy(snapshot.Kind, snapshot.Policy)
+	if err != nil {
+		return result, err
+	}
+
+	live, err := s.livePolicy(ctx, tenant, snapshot.Kind)
+	if err != nil {
+		return result, fmt.Errorf("failed to get live %s policy: %v", snapshot.Kind, err)
+	}
+
+	result.Diff, err = diffPolicies(live, target)
+	if err != nil {
+		return result, err
+	}
+	if dryRun {
+		return result, nil
+	}
+
+	result.BeforeID, err = s.recordSnapshot(tenant, snapshot.Kind, SnapshotRollbackBefore, live)
+	if err != nil {
+		return result, err
+	}
+
+	if err := s.putPolicy(ctx, tenant, target); err != nil {
+		return result, fmt.Errorf("failed to roll back %s runtime policy: %v", snapshot.Kind, err)
+	}
+
+	restored, err := s.livePolicy(ctx, tenant, snapshot.Kind)
+	if err == nil {
+		result.AfterID, err = s.storePolicy(tenant, snapshot.Kind, SnapshotRollbackAfter, restored)
+	}
+	if err != nil {
+		return result, fmt.Errorf("policy was rolled back but syncing it again failed, sync it before the next push: %v", err)
+	}
+
+	logger.Printf("Rolled back %s runtime policy of tenant %s to snapshot %d\n", snapshot.Kind, tenant, id)
+	return result, nil
+}
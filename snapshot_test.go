@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRollbackPolicy(t *testing.T) {
+	rule := newContainerRule("payments")
+	rule.Name = "payments-rule"
+	rule.Modified = "2026-10-01T00:00:00Z"
+	rule.Processes.AllowedList = []string{"/bin/sh"}
+	original := ContainerPolicy{ID: "containerRuntime", Rules: []ContainerRule{rule}}
+
+	var mu sync.Mutex
+	live := original
+	var pushed []ContainerPolicy
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/policies/runtime/container", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Method == http.MethodPut {
+			var policy ContainerPolicy
+			if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			pushed = append(pushed, policy)
+			live = policy
+			return
+		}
+		json.NewEncoder(w).Encode(live)
+	})
+	service := consoleStub(t, mux)
+	service.Tenants = append(service.Tenants, Tenant{Name: "other"})
+	if err := service.Repo.SaveSyncedPolicy(defaultTenant, KindContainer, original, time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	verdicts := []CapabilitiesCSVHeader{containerVerdict("payments", "processes", "/app/server", "legitimate")}
+	if _, err := service.PushVerdicts(ctx, defaultTenant, KindContainer, verdicts); err != nil {
+		t.Fatal(err)
+	}
+
+	snapshots, err := service.ListSnapshots(defaultTenant, KindContainer, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var before PolicySnapshot
+	for _, snapshot := range snapshots {
+		if snapshot.Source == SnapshotPushBefore {
+			before = snapshot
+		}
+	}
+	if before.ID == 0 {
+		t.Fatalf("snapshots = %+v, want one taken before the push", snapshots)
+	}
+
+	// A dry run shows the diff back to the snapshot and pushes nothing
+	preview, err := service.RollbackPolicy(ctx, defaultTenant, before.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Diff.Empty() || preview.BeforeID != 0 || len(pushed) != 1 {
+		t.Fatalf("dry run = %+v after %d pushes, want a diff and no push", preview, len(pushed))
+	}
+
+	// Snapshots of another tenant and unknown ones are refused before any push
+	for _, tt := range []struct {
+		tenant string
+		id     int64
+	}{{"other", before.ID}, {defaultTenant, 999}} {
+		if _, err := service.RollbackPolicy(ctx, tt.tenant, tt.id, false); err != errSnapshotNotFound {
+			t.Errorf("rollback of snapshot %d for %s = %v, want errSnapshotNotFound", tt.id, tt.tenant, err)
+		}
+	}
+	if len(pushed) != 1 {
+		t.Fatalf("%d pushes, want no push for a refused rollback", len(pushed))
+	}
+
+	result, err := service.RollbackPolicy(ctx, defaultTenant, before.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pushed) != 2 {
+		t.Fatalf("%d pushes, want the rollback pushed", len(pushed))
+	}
+	if !reflect.DeepEqual(pushed[1], original) {
+		t.Errorf("rolled back to %+v\nwant the policy before the push %+v", pushed[1], original)
+	}
+
+	// The versions around the rollback are stored, so it can be undone
+	for id, source := range map[int64]string{result.BeforeID: SnapshotRollbackBefore, result.AfterID: SnapshotRollbackAfter} {
+		snapshot, err := service.GetSnapshot(defaultTenant, id)
+		if err != nil || snapshot.Source != source {
+			t.Errorf("snapshot %d = %+v, %v, want a %s snapshot", id, snapshot, err, source)
+		}
+	}
+	after, err := service.GetSnapshot(defaultTenant, result.AfterID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Fingerprint != before.Fingerprint {
+		t.Errorf("rolled back policy fingerprint %s, want %s of the snapshot", after.Fingerprint, before.Fingerprint)
+	}
+
+	// The stored rules follow the rolled back policy
+	var synced ContainerPolicy
+	if found, err := service.Repo.GetSyncedPolicy(defaultTenant, KindContainer, &synced); err != nil || !found {
+		t.Fatalf("synced policy found %v, %v", found, err)
+	}
+	if !slices.Equal(synced.Rules[0].Processes.AllowedList, []string{"/bin/sh"}) {
+		t.Errorf("synced policy allows %q, want only /bin/sh", synced.Rules[0].Processes.AllowedList)
+	}
+}
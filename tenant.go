@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// defaultTenant is used when TENANTS is not set; existing rows were migrated to it
+const defaultTenant = "default"
+
+var (
+	apiVersionPattern = regexp.MustCompile(`^v\d+\.\d+$`)
+	tenantNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+)
+
+// Tenant is a single Prisma Cloud Compute console managed by adam
+type Tenant struct {
+	Name            string
+	AccessKeyId     string
+	SecretAccessKey string
+	ConsoleURL      string
+	APIVersion      string
+}
+
+// BaseURL returns the Prisma Cloud Compute API base URL, e.g. <console>/api/v34.03
+func (t Tenant) BaseURL() string {
+	return fmt.Sprintf("%s/api/%s", strings.TrimRight(t.ConsoleURL, "/"), t.APIVersion)
+}
+
+// loadTenants builds the tenant list from Config. When TENANTS is empty a single
+// "default" tenant uses the top-level settings. Otherwise every tenant reads
+// TENANT_<NAME>_ACCESS_KEY_ID, TENANT_<NAME>_SECRET_ACCESS_KEY,
+// TENANT_<NAME>_CONSOLE_URL and TENANT_<NAME>_API_VERSION, falling back to the
+// top-level value for anything not set.
+func loadTenants(cfg Config) ([]Tenant, error) {
+	fallback := Tenant{
+		Name:            defaultTenant,
+		AccessKeyId:     cfg.AccessKeyId,
+		SecretAccessKey: cfg.SecretAccessKey,
+		ConsoleURL:      cfg.ConsoleURL,
+		APIVersion:      cfg.APIVersion,
+	}
+
+	if strings.TrimSpace(cfg.Tenants) == "" {
+		if err := validateTenant(fallback); err != nil {
+			return nil, err
+		}
+		return []Tenant{fallback}, nil
+	}
+
+	var tenants []Tenant
+	seen := make(map[string]string) // env prefix -> tenant name
+	for _, name := range strings.Split(cfg.Tenants, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if !tenantNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("invalid tenant name %q: use lowercase letters, digits, '-' and '_'", name)
+		}
+
+		// '-' and '_' both become '_' in the prefix, so a-b and a_b would share settings
+		prefix := "TENANT_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+		if other, ok := seen[prefix]; ok {
+			if other == name {
+				return nil, fmt.Errorf("tenant %q is listed twice in TENANTS", name)
+			}
+			return nil, fmt.Errorf("tenants %q and %q would both read %s* settings, rename one of them", other, name, prefix)
+		}
+		seen[prefix] = name
+
+		tenant := Tenant{
+			Name:            name,
+			AccessKeyId:     envOr(prefix+"ACCESS_KEY_ID", fallback.AccessKeyId),
+			SecretAccessKey: envOr(prefix+"SECRET_ACCESS_KEY", fallback.SecretAccessKey),
+			ConsoleURL:      envOr(prefix+"CONSOLE_URL", fallback.ConsoleURL),
+			APIVersion:      envOr(prefix+"API_VERSION", fallback.APIVersion),
+		}
+		if err := validateTenant(tenant); err != nil {
+			return nil, err
+		}
+		tenants = append(tenants, tenant)
+	}
+
+	if len(tenants) == 0 {
+		return nil, fmt.Errorf("TENANTS is set but contains no tenant names")
+	}
+
+	return tenants, nil
+}
+
+// validateTenant checks the settings that would otherwise only fail on the first Prisma Cloud call
+func validateTenant(t Tenant) error {
+	if t.AccessKeyId == "" || t.SecretAccessKey == "" {
+		return fmt.Errorf("tenant %s: access key id and secret access key are required", t.Name)
+	}
+
+	consoleURL, err := url.Parse(t.ConsoleURL)
+	if err != nil {
+		return fmt.Errorf("tenant %s: console URL is not a valid URL: %v", t.Name, err)
+	}
+	if consoleURL.Scheme != "http" && consoleURL.Scheme != "https" {
+		return fmt.Errorf("tenant %s: console URL must start with http:// or https://, got %q", t.Name, t.ConsoleURL)
+	}
+	if consoleURL.Host == "" {
+		return fmt.Errorf("tenant %s: console URL has no host: %q", t.Name, t.ConsoleURL)
+	}
+	if consoleURL.RawQuery != "" || consoleURL.Fragment != "" {
+		return fmt.Errorf("tenant %s: console URL must not contain a query or fragment: %q", t.Name, t.ConsoleURL)
+	}
+	if strings.Contains(consoleURL.Path, "/api/") || strings.HasSuffix(consoleURL.Path, "/api") {
+		return fmt.Errorf("tenant %s: console URL must not include /api/<version>: %q", t.Name, t.ConsoleURL)
+	}
+
+	if !apiVersionPattern.MatchString(t.APIVersion) {
+		return fmt.Errorf("tenant %s: API version must look like v34.03, got %q", t.Name, t.APIVersion)
+	}
+
+	return nil
+}
+
+func envOr(key, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return fallback
+}
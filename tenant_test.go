@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadTenants(t *testing.T) {
+	cfg := Config{AccessKeyId: "id", SecretAccessKey: "secret", ConsoleURL: "https://console.example.com", APIVersion: "v34.03"}
+
+	tests := []struct {
+		tenants string
+		want    []string
+		wantErr string
+	}{
+		{"", []string{"default"}, ""},
+		{" Prod, dev-eu ,", []string{"prod", "dev-eu"}, ""},
+		{"prod,prod", nil, "listed twice"},
+		{"dev-eu,dev_eu", nil, "TENANT_DEV_EU_*"},
+		{"prod,Bad.Name", nil, "invalid tenant name"},
+		{" , ", nil, "no tenant names"},
+	}
+	for _, tt := range tests {
+		cfg.Tenants = tt.tenants
+		tenants, err := loadTenants(cfg)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("loadTenants(%q) error = %v, want one mentioning %q", tt.tenants, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("loadTenants(%q): %v", tt.tenants, err)
+			continue
+		}
+		var names []string
+		for _, tenant := range tenants {
+			names = append(names, tenant.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("loadTenants(%q) = %v, want %v", tt.tenants, names, tt.want)
+		}
+	}
+}
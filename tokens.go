@@ -0,0 +1,199 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Scopes an API token can carry. admin implies every other scope.
+const (
+	ScopeSync   = "sync"   // fetch profiles and policies from Prisma Cloud
+	ScopeReview = "review" // read profiles, drift, snapshots and verdict history, preview verdicts
+	ScopePush   = "push"   // save verdicts and change runtime policies in Prisma Cloud
+	ScopeReport = "report" // send the verdict, drift and weekly report emails
+	ScopeAdmin  = "admin"  // manage tokens and retention
+)
+
+var tokenScopes = []string{ScopeSync, ScopeReview, ScopePush, ScopeReport, ScopeAdmin}
+
+// tokenPrefix starts every issued token, followed by its id and secret
+const tokenPrefix = "adam_"
+
+// tokenSecretBytes is the length of a token's secret before hex encoding
+const tokenSecretBytes = 32
+
+// sharedTokenName is the caller name of the shared TOKEN. Reviewers using it
+// are recorded as "token:<name>", so no issued token may take either form.
+const sharedTokenName = "token"
+
+var (
+	errUnauthorized  = errors.New("unauthorized")
+	errTokenNotFound = errors.New("api token not found")
+)
+
+// ForbiddenError rejects a valid token that lacks the scope of a request
+type ForbiddenError struct {
+	Scope string
+}
+
+func (e *ForbiddenError) Error() string {
+	return fmt.Sprintf("token lacks the %s scope", e.Scope)
+}
+
+// APIToken is a named token as stored, without its secret
+type APIToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// IssuedToken is a newly issued token with the secret to hand to its user
+type IssuedToken struct {
+	APIToken
+	Token string `json:"token"`
+}
+
+// Caller is who sent an authenticated request
+type Caller struct {
+	Name   string
+	Scopes []string
+	// Shared is set for the TOKEN from the configuration, which everyone
+	// holding it uses under the same name
+	Shared bool
+}
+
+// Can reports whether the caller holds a scope. An empty scope only needs a valid token.
+func (c Caller) Can(scope string) bool {
+	return scope == "" || slices.Contains(c.Scopes, ScopeAdmin) || slices.Contains(c.Scopes, scope)
+}
+
+// parseScopes validates a comma-separated list of scopes
+func parseScopes(value string) ([]string, error) {
+	scopes := []string{}
+	for _, scope := range strings.Split(value, ",") {
+		scope = strings.TrimSpace(scope)
+		if scope == "" || slices.Contains(scopes, scope) {
+			continue
+		}
+		if !slices.Contains(tokenScopes, scope) {
+			return nil, fmt.Errorf("unknown scope: %s (valid: %s)", scope, strings.Join(tokenScopes, ", "))
+		}
+		scopes = append(scopes, scope)
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("a token needs at least one scope (valid: %s)", strings.Join(tokenScopes, ", "))
+	}
+	return scopes, nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueToken creates a named token with scopes, expiring after ttl unless ttl is 0
+func (s *Service) IssueToken(name string, scopes []string, ttl time.Duration) (IssuedToken, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return IssuedToken{}, fmt.Errorf("a token needs a name")
+	}
+	if name == sharedTokenName || strings.HasPrefix(name, sharedTokenName+":") {
+		return IssuedToken{}, fmt.Errorf("token name %q is reserved for the shared TOKEN", name)
+	}
+	if ttl < 0 {
+		return IssuedToken{}, fmt.Errorf("token expiry must not be negative")
+	}
+
+	secret := make([]byte, tokenSecretBytes)
+	if _, err := rand.Read(secret); err != nil {
+		return IssuedToken{}, err
+	}
+	secretHex := hex.EncodeToString(secret)
+
+	token := IssuedToken{APIToken: APIToken{Name: name, Scopes: scopes, CreatedAt: time.Now().UTC()}}
+	if ttl > 0 {
+		expiresAt := token.CreatedAt.Add(ttl)
+		token.ExpiresAt = &expiresAt
+	}
+
+	id, err := s.Repo.CreateAPIToken(token.APIToken, hashSecret(secretHex))
+	if err != nil {
+		return token, fmt.Errorf("failed to issue token %s: %v", name, err)
+	}
+	token.ID = id
+	token.Token = fmt.Sprintf("%s%d_%s", tokenPrefix, id, secretHex)
+
+	logger.Printf("Issued API token %d (%s) with scopes %s\n", id, name, strings.Join(scopes, ","))
+	return token, nil
+}
+
+// ListTokens returns every issued token, revoked ones included, without secrets
+func (s *Service) ListTokens() ([]APIToken, error) {
+	return s.Repo.ListAPITokens()
+}
+
+// RevokeToken stops a token from authenticating
+func (s *Service) RevokeToken(id int64) (APIToken, error) {
+	token, err := s.Repo.RevokeAPIToken(id, time.Now().UTC())
+	if err != nil {
+		return token, err
+	}
+
+	logger.Printf("Revoked API token %d (%s)\n", id, token.Name)
+	return token, nil
+}
+
+// Authenticate resolves a bearer token to its caller and checks it holds
+// scope. Secrets are compared in constant time.
+func (s *Service) Authenticate(bearer, scope string) (Caller, error) {
+	var caller Caller
+
+	if s.Cfg.Token != "" && subtle.ConstantTimeCompare([]byte(bearer), []byte(s.Cfg.Token)) == 1 {
+		caller = Caller{Name: sharedTokenName, Scopes: []string{ScopeAdmin}, Shared: true}
+	} else {
+		idText, secret, ok := strings.Cut(strings.TrimPrefix(bearer, tokenPrefix), "_")
+		if !ok || !strings.HasPrefix(bearer, tokenPrefix) || len(secret) != 2*tokenSecretBytes {
+			return caller, errUnauthorized
+		}
+		id, err := strconv.ParseInt(idText, 10, 64)
+		if err != nil {
+			return caller, errUnauthorized
+		}
+
+		token, hash, err := s.Repo.GetAPIToken(id)
+		if errors.Is(err, errTokenNotFound) {
+			return caller, errUnauthorized
+		}
+		if err != nil {
+			return caller, err
+		}
+
+		now := time.Now().UTC()
+		if subtle.ConstantTimeCompare([]byte(hashSecret(secret)), []byte(hash)) != 1 ||
+			token.RevokedAt != nil || (token.ExpiresAt != nil && !now.Before(*token.ExpiresAt)) {
+			return caller, errUnauthorized
+		}
+
+		if err := s.Repo.TouchAPIToken(id, now); err != nil {
+			logger.Printf("Warning: failed to record use of API token %d: %v\n", id, err)
+		}
+		caller = Caller{Name: token.Name, Scopes: token.Scopes}
+	}
+
+	if !caller.Can(scope) {
+		return caller, &ForbiddenError{Scope: scope}
+	}
+	return caller, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuthenticate(t *testing.T) {
+	service := &Service{Repo: newTestRepo(t), Cfg: Config{Token: "shared-secret"}}
+
+	issue := func(name string, scopes ...string) IssuedToken {
+		t.Helper()
+		token, err := service.IssueToken(name, scopes, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	reviewer := issue("alice", ScopeReview)
+	admin := issue("ops", ScopeAdmin)
+	expired := issue("bob", ScopeReview)
+	if _, err := service.Repo.DB.Exec(`UPDATE api_tokens SET expires_at = ? WHERE id = ?`, time.Now().UTC().Add(-time.Minute), expired.ID); err != nil {
+		t.Fatal(err)
+	}
+	revoked := issue("carol", ScopeReview)
+	if _, err := service.RevokeToken(revoked.ID); err != nil {
+		t.Fatal(err)
+	}
+	// The id and secret of the reviewer's token, to build malformed ones from
+	id, secret, _ := strings.Cut(strings.TrimPrefix(reviewer.Token, tokenPrefix), "_")
+
+	tests := []struct {
+		name      string
+		bearer    string
+		scope     string
+		wantName  string
+		forbidden bool
+	}{
+		{name: "token with the scope", bearer: reviewer.Token, scope: ScopeReview, wantName: "alice"},
+		{name: "any valid token without a scope", bearer: reviewer.Token, wantName: "alice"},
+		{name: "admin holds every scope", bearer: admin.Token, scope: ScopePush, wantName: "ops"},
+		{name: "token without the scope", bearer: reviewer.Token, scope: ScopePush, forbidden: true},
+		{name: "shared TOKEN", bearer: "shared-secret", scope: ScopeAdmin, wantName: sharedTokenName},
+		{name: "expired token", bearer: expired.Token, scope: ScopeReview},
+		{name: "revoked token", bearer: revoked.Token, scope: ScopeReview},
+		{name: "empty", bearer: "", scope: ScopeReview},
+		{name: "no prefix", bearer: strings.TrimPrefix(reviewer.Token, tokenPrefix), scope: ScopeReview},
+		{name: "no secret", bearer: tokenPrefix + id, scope: ScopeReview},
+		{name: "id not a number", bearer: tokenPrefix + "x_" + secret, scope: ScopeReview},
+		{name: "unknown id", bearer: tokenPrefix + "999_" + secret, scope: ScopeReview},
+		{name: "another token's id", bearer: tokenPrefix + "2_" + secret, scope: ScopeReview},
+		{name: "short secret", bearer: tokenPrefix + id + "_" + secret[1:], scope: ScopeReview},
+		{name: "long secret", bearer: reviewer.Token + "0", scope: ScopeReview},
+		{name: "wrong secret", bearer: tokenPrefix + id + "_" + strings.Repeat("0", len(secret)), scope: ScopeReview},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller, err := service.Authenticate(tt.bearer, tt.scope)
+
+			var forbidden *ForbiddenError
+			switch {
+			case tt.forbidden:
+				if !errors.As(err, &forbidden) || forbidden.Scope != tt.scope {
+					t.Errorf("err = %v, want a ForbiddenError for %s", err, tt.scope)
+				}
+			case tt.wantName == "":
+				if !errors.Is(err, errUnauthorized) {
+					t.Errorf("err = %v, want errUnauthorized", err)
+				}
+			default:
+				if err != nil {
+					t.Fatal(err)
+				}
+				if caller.Name != tt.wantName || caller.Shared != (tt.wantName == sharedTokenName) {
+					t.Errorf("caller = %+v, want %s", caller, tt.wantName)
+				}
+			}
+		})
+	}
+
+	// Without a TOKEN configured, an empty bearer does not match it
+	service.Cfg.Token = ""
+	if _, err := service.Authenticate("", ""); !errors.Is(err, errUnauthorized) {
+		t.Errorf("empty bearer without TOKEN = %v, want errUnauthorized", err)
+	}
+}
+
+func TestIssueToken(t *testing.T) {
+	service := &Service{Repo: newTestRepo(t)}
+
+	token, err := service.IssueToken(" alice ", []string{ScopeReview}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Name != "alice" || token.ExpiresAt != nil || !strings.HasPrefix(token.Token, tokenPrefix) {
+		t.Errorf("token = %+v, want alice without an expiry", token)
+	}
+
+	stored, hash, err := service.Repo.GetAPIToken(token.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(token.Token, hash) || hash != hashSecret(token.Token[strings.LastIndex(token.Token, "_")+1:]) {
+		t.Error("want only the hash of the secret stored")
+	}
+	if stored.Name != "alice" || len(stored.Scopes) != 1 || stored.Scopes[0] != ScopeReview {
+		t.Errorf("stored = %+v", stored)
+	}
+
+	// Empty names, the shared TOKEN's reviewer names and names of active tokens are refused
+	for _, name := range []string{"", "  ", "token", "token:", "token:alice", "alice"} {
+		if _, err := service.IssueToken(name, []string{ScopeReview}, time.Hour); err == nil {
+			t.Errorf("IssueToken(%q) issued a token, want an error", name)
+		}
+	}
+	if _, err := service.IssueToken("tokens", []string{ScopeReview}, time.Hour); err != nil {
+		t.Errorf("IssueToken(tokens) = %v, only the shared TOKEN's names are reserved", err)
+	}
+	if _, err := service.IssueToken("bob", []string{ScopeReview}, -time.Hour); err == nil {
+		t.Error("want an error for a negative expiry")
+	}
+}
+
+func TestRevokeToken(t *testing.T) {
+	service := &Service{Repo: newTestRepo(t)}
+
+	token, err := service.IssueToken("alice", []string{ScopeReview}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked, err := service.RevokeToken(token.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if revoked.RevokedAt == nil {
+		t.Fatal("revoked token has no revoked_at")
+	}
+
+	// Revoking again keeps the first revocation
+	again, err := service.RevokeToken(token.ID)
+	if err != nil || !again.RevokedAt.Equal(*revoked.RevokedAt) {
+		t.Errorf("second revoke = %v, %v, want revoked_at %v", again.RevokedAt, err, revoked.RevokedAt)
+	}
+
+	if _, err := service.RevokeToken(999); !errors.Is(err, errTokenNotFound) {
+		t.Errorf("revoking an unknown token = %v, want errTokenNotFound", err)
+	}
+
+	// The name is free again for a new token
+	if _, err := service.IssueToken("alice", []string{ScopeReview}, 0); err != nil {
+		t.Errorf("reissuing a revoked token's name = %v", err)
+	}
+}
@@ -9,31 +9,39 @@ import (
 func validateBearer(r *http.Request) (string, error) {
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
-		return "", errors.New("unauthorized")
+		return "", errUnauthorized
 	}
 
 	parts := strings.Split(authHeader, "Bearer ")
 	if len(parts) != 2 {
-		return "", errors.New("unauthorized")
+		return "", errUnauthorized
 	}
 
 	token := strings.TrimSpace(parts[1])
 	if len(token) == 0 {
-		return "", errors.New("unauthorized")
+		return "", errUnauthorized
 	}
 
 	return token, nil
 }
 
-func validateToken(r *http.Request, token string) error {
+// validateToken authenticates the bearer token of a request and checks it
+// holds scope, an empty scope accepting any valid token
+func validateToken(r *http.Request, service *Service, scope string) (Caller, error) {
 	bearer, err := validateBearer(r)
 	if err != nil {
-		return err
+		return Caller{}, err
 	}
 
-	if token != bearer {
-		return errors.New("unauthorized")
-	}
+	return service.Authenticate(bearer, scope)
+}
 
-	return nil
+// writeAuthError answers 403 for a token lacking a scope and 401 otherwise
+func writeAuthError(w http.ResponseWriter, err error) {
+	var forbidden *ForbiddenError
+	if errors.As(err, &forbidden) {
+		http.Error(w, "Forbidden: "+forbidden.Error(), http.StatusForbidden)
+		return
+	}
+	http.Error(w, "Unauthorized", http.StatusUnauthorized)
 }
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// How a row of a verdict CSV was validated
+const (
+	RowAccepted  = "accepted"  // valid and changes the verdict or remarks
+	RowUnchanged = "unchanged" // valid but the entry already has this verdict and remarks
+	RowRejected  = "rejected"  // not applied, see the reason
+)
+
+// VerdictCSVRow is a row of an uploaded verdict CSV. Problem is set when the
+// row could not be read into a record, e.g. because it is missing columns.
+type VerdictCSVRow struct {
+	Line    int
+	Record  CapabilitiesCSVHeader
+	Problem string
+}
+
+// VerdictRowResult is the validation outcome of one CSV row
+type VerdictRowResult struct {
+	Line    int    `json:"line"`
+	ID      string `json:"id"`
+	Status  string `json:"status"`
+	Verdict string `json:"verdict,omitempty"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// VerdictValidation reports every row of a verdict CSV
+type VerdictValidation struct {
+	Accepted  int                `json:"accepted"`
+	Unchanged int                `json:"unchanged"`
+	Rejected  int                `json:"rejected"`
+	Lenient   bool               `json:"lenient"`
+	Rows      []VerdictRowResult `json:"rows"`
+}
+
+// VerdictValidationError refuses a verdict CSV with rejected rows. In lenient
+// mode it is only returned when no row is valid.
+type VerdictValidationError struct {
+	Validation VerdictValidation
+}
+
+func (e *VerdictValidationError) Error() string {
+	if e.Validation.Lenient {
+		return fmt.Sprintf("all %d rows were rejected", e.Validation.Rejected)
+	}
+	return fmt.Sprintf("%d of %d rows were rejected, nothing was applied; fix them or upload in lenient mode to apply only the valid rows",
+		e.Validation.Rejected, len(e.Validation.Rows))
+}
+
+// ValidateVerdicts checks every row of a verdict CSV against the stored
+// entries of a kind: the id must exist, its collection, key and value must
+// match the stored row and the verdict must be valid. It returns the records
+// of the valid rows, accepted and unchanged alike, so a re-upload still
+// retries their push. Any rejected row fails the whole file unless lenient.
+func (s *Service) ValidateVerdicts(tenant, kind string, rows []VerdictCSVRow, lenient bool) ([]CapabilitiesCSVHeader, VerdictValidation, error) {
+	validation := VerdictValidation{Lenient: lenient, Rows: []VerdictRowResult{}}
+	records := []CapabilitiesCSVHeader{}
+	lines := map[int64]int{} // line of each id, to reject duplicates
+
+	for _, row := range rows {
+		status, reason, err := s.checkVerdictRow(tenant, kind, row, lines)
+		if err != nil {
+			return nil, validation, err
+		}
+
+		switch status {
+		case RowAccepted:
+			validation.Accepted++
+		case RowUnchanged:
+			validation.Unchanged++
+		case RowRejected:
+			validation.Rejected++
+		}
+		if status != RowRejected {
+			records = append(records, row.Record)
+		}
+		validation.Rows = append(validation.Rows, VerdictRowResult{
+			Line:    row.Line,
+			ID:      row.Record.ID,
+			Status:  status,
+			Verdict: row.Record.Verdict,
+			Reason:  reason,
+		})
+	}
+
+	if validation.Rejected > 0 && (!lenient || len(records) == 0) {
+		return nil, validation, &VerdictValidationError{Validation: validation}
+	}
+	return records, validation, nil
+}
+
+// checkVerdictRow validates one row and returns its status with the reason of
+// a rejection. Errors are only returned when the stored entry cannot be read.
+func (s *Service) checkVerdictRow(tenant, kind string, row VerdictCSVRow, lines map[int64]int) (string, string, error) {
+	if row.Problem != "" {
+		return RowRejected, row.Problem, nil
+	}
+	record := row.Record
+
+	id, err := strconv.ParseInt(record.ID, 10, 64)
+	if err != nil || id < 1 {
+		return RowRejected, fmt.Sprintf("invalid id %q", record.ID), nil
+	}
+	if line, ok := lines[id]; ok {
+		return RowRejected, fmt.Sprintf("id %d is already on line %d", id, line), nil
+	}
+	lines[id] = row.Line
+
+	if err := checkVerdict(record); err != nil {
+		return RowRejected, fmt.Sprintf("invalid verdict %q, must be not_yet, legitimate or not_legitimate", record.Verdict), nil
+	}
+
+	entry, err := s.Repo.GetProfileEntry(tenant, kind, id)
+	if errors.Is(err, errProfileEntryNotFound) {
+		return RowRejected, fmt.Sprintf("no %s entry with id %d", kind, id), nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read entry %d: %v", id, err)
+	}
+
+	for _, column := range []struct {
+		name, file, stored string
+	}{
+		{"collection_name", record.CollectionName, entry.Collection},
+		{"key", record.Key, entry.Key},
+		{"value", record.Value, entry.Value},
+	} {
+		if column.file != strings.TrimSpace(column.stored) {
+			return RowRejected, fmt.Sprintf("%s is %q but entry %d has %q", column.name, column.file, id, column.stored), nil
+		}
+	}
+
+	if entry.Verdict == record.Verdict && entry.Remarks == record.Remarks {
+		return RowUnchanged, "", nil
+	}
+	return RowAccepted, "", nil
+}
+
+// rejectedNote mentions the rows a lenient import left out, if any
+func rejectedNote(validation VerdictValidation) string {
+	if validation.Rejected == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", %d rejected rows skipped", validation.Rejected)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestValidateVerdicts(t *testing.T) {
+	service := &Service{Repo: newTestRepo(t)}
+	for _, entry := range []struct{ tenant, value, verdict, remarks string }{
+		{defaultTenant, "/bin/sh", "not_yet", ""},            // id 1
+		{defaultTenant, "/usr/bin/curl", "legitimate", "ok"}, // id 2
+		{"other", "/bin/nc", "not_yet", ""},                  // id 3
+	} {
+		if _, err := service.Repo.DB.Exec(`
+			INSERT INTO container_profiles (tenant, collection_name, key, value, verdict, remarks, updated_at)
+			VALUES (?, 'payments', 'processes', ?, ?, ?, CURRENT_TIMESTAMP)
+		`, entry.tenant, entry.value, entry.verdict, entry.remarks); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const header = "id,collection_name,key,value,verdict,remarks\n"
+	tests := []struct {
+		name        string
+		rows        string
+		lenient     bool
+		want        []string // status of each row
+		wantReasons []string // part of the reason of each rejected row, in order
+		wantRecords int
+		wantErr     bool
+	}{
+		{
+			name:        "accepted and unchanged",
+			rows:        "1,payments,processes,/bin/sh,legitimate,\n2,payments,processes,/usr/bin/curl,legitimate,ok\n",
+			want:        []string{RowAccepted, RowUnchanged},
+			wantRecords: 2,
+		},
+		{
+			name:        "new remarks change an entry",
+			rows:        "2,payments,processes,/usr/bin/curl,legitimate,checked again\n",
+			want:        []string{RowAccepted},
+			wantRecords: 1,
+		},
+		{
+			name:        "unknown id",
+			rows:        "99,payments,processes,/bin/sh,legitimate,\n",
+			want:        []string{RowRejected},
+			wantReasons: []string{"no container entry with id 99"},
+			wantErr:     true,
+		},
+		{
+			name:        "id of another tenant",
+			rows:        "3,payments,processes,/bin/nc,legitimate,\n",
+			want:        []string{RowRejected},
+			wantReasons: []string{"no container entry with id 3"},
+			wantErr:     true,
+		},
+		{
+			name:        "invalid ids",
+			rows:        "abc,payments,processes,/bin/sh,legitimate,\n0,payments,processes,/bin/sh,legitimate,\n",
+			want:        []string{RowRejected, RowRejected},
+			wantReasons: []string{`invalid id "abc"`, `invalid id "0"`},
+			wantErr:     true,
+		},
+		{
+			name:        "collection and key that do not match the stored row",
+			rows:        "1,billing,processes,/bin/sh,legitimate,\n2,payments,dns_queries,/usr/bin/curl,legitimate,\n",
+			want:        []string{RowRejected, RowRejected},
+			wantReasons: []string{`collection_name is "billing" but entry 1 has "payments"`, `key is "dns_queries"`},
+			wantErr:     true,
+		},
+		{
+			name:        "value that does not match the stored row",
+			rows:        "2,payments,processes,/usr/bin/wget,legitimate,\n",
+			want:        []string{RowRejected},
+			wantReasons: []string{`value is "/usr/bin/wget" but entry 2 has "/usr/bin/curl"`},
+			wantErr:     true,
+		},
+		{
+			name:        "duplicate id",
+			rows:        "1,payments,processes,/bin/sh,legitimate,\n1,payments,processes,/bin/sh,not_legitimate,\n",
+			want:        []string{RowAccepted, RowRejected},
+			wantReasons: []string{"id 1 is already on line 2"},
+			wantErr:     true,
+		},
+		{
+			name:        "bad verdict",
+			rows:        "1,payments,processes,/bin/sh,approved,\n2,payments,processes,/usr/bin/curl,,\n",
+			want:        []string{RowRejected, RowRejected},
+			wantReasons: []string{`invalid verdict "approved"`, `invalid verdict ""`},
+			wantErr:     true,
+		},
+		{
+			name:        "short row",
+			rows:        "1,payments,processes\n",
+			want:        []string{RowRejected},
+			wantReasons: []string{"row has 3 columns, missing value, verdict"},
+			wantErr:     true,
+		},
+		{
+			name:        "short row without remarks",
+			rows:        "1,payments,processes,/bin/sh,legitimate\n",
+			want:        []string{RowAccepted},
+			wantRecords: 1,
+		},
+		{
+			name:        "extra columns are ignored",
+			rows:        "1,payments,processes,/bin/sh,legitimate,,extra\n",
+			want:        []string{RowAccepted},
+			wantRecords: 1,
+		},
+		{
+			name:        "a value split by an unquoted comma shifts the verdict",
+			rows:        "1,payments,processes,/bin/sh,-c,legitimate,\n",
+			want:        []string{RowRejected},
+			wantReasons: []string{`invalid verdict "-c"`},
+			wantErr:     true,
+		},
+		{
+			name:        "strict mode refuses the file for one rejected row",
+			rows:        "1,payments,processes,/bin/sh,legitimate,\n99,payments,processes,/bin/sh,legitimate,\n",
+			want:        []string{RowAccepted, RowRejected},
+			wantReasons: []string{"no container entry"},
+			wantErr:     true,
+		},
+		{
+			name:        "lenient mode applies the valid rows",
+			rows:        "1,payments,processes,/bin/sh,legitimate,\n99,payments,processes,/bin/sh,legitimate,\n",
+			lenient:     true,
+			want:        []string{RowAccepted, RowRejected},
+			wantReasons: []string{"no container entry"},
+			wantRecords: 1,
+		},
+		{
+			name:        "lenient mode still refuses a file without valid rows",
+			rows:        "99,payments,processes,/bin/sh,legitimate,\n",
+			lenient:     true,
+			want:        []string{RowRejected},
+			wantReasons: []string{"no container entry"},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := parseCSVWithAutoDetect(strings.NewReader(header + tt.rows))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			records, validation, err := service.ValidateVerdicts(defaultTenant, KindContainer, rows, tt.lenient)
+			var invalid *VerdictValidationError
+			if tt.wantErr != errors.As(err, &invalid) {
+				t.Fatalf("err = %v, want a VerdictValidationError: %v", err, tt.wantErr)
+			}
+			if len(records) != tt.wantRecords {
+				t.Errorf("%d records, want %d", len(records), tt.wantRecords)
+			}
+
+			if len(validation.Rows) != len(tt.want) {
+				t.Fatalf("rows = %+v, want statuses %q", validation.Rows, tt.want)
+			}
+			counts := map[string]int{}
+			var reasons []string
+			for i, row := range validation.Rows {
+				counts[row.Status]++
+				if row.Status != tt.want[i] {
+					t.Errorf("line %d is %s (%s), want %s", row.Line, row.Status, row.Reason, tt.want[i])
+				}
+				if row.Status == RowRejected {
+					reasons = append(reasons, row.Reason)
+				} else if row.Reason != "" {
+					t.Errorf("line %d is %s with reason %q", row.Line, row.Status, row.Reason)
+				}
+			}
+			for i, want := range tt.wantReasons {
+				if i >= len(reasons) || !strings.Contains(reasons[i], want) {
+					t.Errorf("reasons = %q, want %q at %d", reasons, want, i)
+				}
+			}
+			if validation.Accepted != counts[RowAccepted] || validation.Unchanged != counts[RowUnchanged] ||
+				validation.Rejected != counts[RowRejected] || validation.Lenient != tt.lenient {
+				t.Errorf("validation = %+v, does not add up", validation)
+			}
+		})
+	}
+}
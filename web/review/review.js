@@ -0,0 +1,295 @@
+// Review UI for entries awaiting a verdict. Everything goes through the API:
+// /profile/entries lists the entries, /verdict/review previews the decisions
+// and /verdict/update?confirm= pushes the previewed verdicts.
+"use strict";
+
+const $ = (id) => document.getElementById(id);
+
+const state = {
+  entries: [],
+  selected: new Set(),
+  decisions: new Map(), // entry id -> {verdict, remarks}
+  previewToken: "",
+  busy: false,
+};
+
+const verdictLabels = { legitimate: "approve", not_legitimate: "deny" };
+
+// Settings survive a reload; the token only lives as long as the tab
+for (const id of ["reviewer", "tenant", "kind"]) {
+  const saved = localStorage.getItem("adam." + id);
+  if (saved) $(id).value = saved;
+  $(id).addEventListener("change", () => localStorage.setItem("adam." + id, $(id).value));
+}
+$("token").value = sessionStorage.getItem("adam.token") || "";
+$("token").addEventListener("change", () => sessionStorage.setItem("adam.token", $("token").value));
+
+function setStatus(message, isError) {
+  $("status").textContent = message;
+  $("status").className = isError ? "error" : "";
+}
+
+function el(tag, props, ...children) {
+  const node = document.createElement(tag);
+  Object.assign(node, props || {});
+  for (const child of children) {
+    node.append(child);
+  }
+  return node;
+}
+
+// api calls an adam endpoint and returns its message and data. Errors come
+// back as plain text from http.Error or as a JSON Response.
+async function api(method, path, params, body) {
+  const query = new URLSearchParams(params);
+  const tenant = $("tenant").value.trim();
+  if (tenant) query.set("tenant", tenant);
+
+  const headers = { Authorization: "Bearer " + $("token").value.trim() };
+  const reviewer = $("reviewer").value.trim();
+  if (reviewer) headers["X-Reviewer"] = reviewer;
+  if (body !== undefined) headers["Content-Type"] = "application/json";
+
+  const res = await fetch(path + "?" + query, {
+    method,
+    headers,
+    body: body === undefined ? undefined : JSON.stringify(body),
+  });
+  const text = await res.text();
+  let message = text.trim();
+  let data;
+  try {
+    const parsed = JSON.parse(text);
+    message = parsed.message;
+    data = parsed.data;
+  } catch (e) {
+    // plain text error
+  }
+  return { ok: res.ok, status: res.status, message, data };
+}
+
+async function load() {
+  if (state.busy) return;
+  state.busy = true;
+  setStatus("Loading…");
+  resetPreview();
+  state.entries = [];
+  state.selected.clear();
+  state.decisions.clear();
+
+  try {
+    let cursor = "";
+    do {
+      const params = { kind: $("kind").value, verdict: "not_yet", limit: "1000" };
+      if (cursor) params.cursor = cursor;
+      const res = await api("GET", "/profile/entries", params);
+      if (!res.ok) {
+        setStatus(res.message, true);
+        return;
+      }
+      state.entries.push(...res.data.entries);
+      cursor = res.data.next_cursor || "";
+    } while (cursor);
+    setStatus(state.entries.length + " entries awaiting a verdict");
+  } catch (e) {
+    setStatus("Failed to load entries: " + e.message, true);
+  } finally {
+    state.busy = false;
+    render();
+  }
+}
+
+// groups sorts the entries by collection, then by key
+function groups() {
+  const collections = new Map();
+  for (const entry of state.entries) {
+    if (!collections.has(entry.collection)) collections.set(entry.collection, new Map());
+    const keys = collections.get(entry.collection);
+    if (!keys.has(entry.key)) keys.set(entry.key, []);
+    keys.get(entry.key).push(entry);
+  }
+  return [...collections.entries()].sort((a, b) => a[0].localeCompare(b[0]));
+}
+
+function formatSeen(value) {
+  return value ? new Date(value).toLocaleString() : "";
+}
+
+function render() {
+  const container = $("entries");
+  container.replaceChildren();
+
+  for (const [collection, keys] of groups()) {
+    const total = [...keys.values()].reduce((n, entries) => n + entries.length, 0);
+    container.append(el("h2", { textContent: collection + " " }, el("span", { className: "counts", textContent: total + " entries" })));
+
+    for (const [key, entries] of [...keys.entries()].sort((a, b) => a[0].localeCompare(b[0]))) {
+      const groupBox = el("input", { type: "checkbox" });
+      groupBox.checked = entries.every((entry) => state.selected.has(entry.id));
+      groupBox.addEventListener("change", () => {
+        for (const entry of entries) {
+          if (groupBox.checked) state.selected.add(entry.id);
+          else state.selected.delete(entry.id);
+        }
+        render();
+      });
+      container.append(el("h3", {}, el("label", {}, groupBox, key + " (" + entries.length + ")")));
+
+      const table = el("table", {}, el("tr", {},
+        el("th", {}), el("th", { textContent: "value" }), el("th", { textContent: "decision" }),
+        el("th", { textContent: "remarks" }), el("th", { textContent: "first seen" }), el("th", { textContent: "last seen" })));
+      for (const entry of entries) {
+        const decision = state.decisions.get(entry.id);
+        const box = el("input", { type: "checkbox", checked: state.selected.has(entry.id) });
+        box.addEventListener("change", () => {
+          if (box.checked) state.selected.add(entry.id);
+          else state.selected.delete(entry.id);
+          render();
+        });
+        const value = entry.source ? entry.value + "  [" + entry.source + "]" : entry.value;
+        table.append(el("tr", { className: decision ? decision.verdict : "" },
+          el("td", {}, box),
+          el("td", { className: "value", textContent: value }),
+          el("td", { className: "decision", textContent: decision ? verdictLabels[decision.verdict] : "" }),
+          el("td", { textContent: decision ? decision.remarks : "" }),
+          el("td", { className: "seen", textContent: formatSeen(entry.first_seen) }),
+          el("td", { className: "seen", textContent: formatSeen(entry.last_seen) })));
+      }
+      container.append(table);
+    }
+  }
+
+  $("select-all").checked = state.entries.length > 0 && state.selected.size === state.entries.length;
+  $("approve").disabled = $("deny").disabled = $("clear").disabled = state.selected.size === 0;
+  $("preview-button").disabled = state.decisions.size === 0;
+  $("push").disabled = !state.previewToken;
+}
+
+// decide gives the selected entries a verdict, or clears it without one
+function decide(verdict) {
+  const remarks = $("remarks").value.trim();
+  for (const id of state.selected) {
+    if (verdict) state.decisions.set(id, { verdict, remarks });
+    else state.decisions.delete(id);
+  }
+  state.selected.clear();
+  resetPreview();
+  setStatus(state.decisions.size + " decisions, preview them before pushing");
+  render();
+}
+
+function resetPreview() {
+  state.previewToken = "";
+  $("preview").hidden = true;
+  $("preview").replaceChildren();
+}
+
+function list(items, className) {
+  return el("ul", {}, ...items.map((item) => el("li", { className: className || "", textContent: item })));
+}
+
+function renderDiff(preview) {
+  const section = $("preview");
+  const diff = preview.diff || {};
+  section.replaceChildren(el("h2", { textContent: "Policy diff for " + preview.applied + " of " + preview.total_records + " decisions" }));
+
+  if (!diff.rules_added && !diff.rules_removed && !diff.rules) {
+    section.append(el("p", { textContent: "The policy does not change; pushing only stores the verdicts." }));
+  }
+  if (diff.rules_added) section.append(el("h3", { textContent: "Rules added" }), list(diff.rules_added, "added"));
+  if (diff.shadowed) {
+    section.append(list(diff.shadowed.map((s) => s.rule + " is placed ahead of " + s.shadows + ", which no longer applies to collection " + s.collection + "; it starts as a copy of it")));
+  }
+  if (diff.rules_removed) section.append(el("h3", { textContent: "Rules removed" }), list(diff.rules_removed, "removed"));
+  for (const rule of diff.rules || []) {
+    section.append(el("h3", { textContent: "Rule " + rule.name }));
+    for (const [field, values] of Object.entries(rule.added || {})) {
+      section.append(list(values.map((v) => "+ " + field + ": " + v), "added"));
+    }
+    for (const [field, values] of Object.entries(rule.removed || {})) {
+      section.append(list(values.map((v) => "- " + field + ": " + v), "removed"));
+    }
+    if (rule.changed) {
+      section.append(list(rule.changed.map((c) => c.field + ": " + c.from + " → " + c.to)));
+    }
+  }
+  section.append(el("p", { textContent: "Preview expires " + new Date(preview.expires_at).toLocaleString() + "." }));
+  section.hidden = false;
+}
+
+function renderConflicts(message, conflicts) {
+  const section = $("preview");
+  section.replaceChildren(el("h2", { className: "removed", textContent: "Conflicts" }), el("p", { textContent: message }));
+  if (conflicts) {
+    section.append(list(conflicts.map((c) => c.rule + " (" + c.collection + "): " + c.reason)));
+  }
+  section.hidden = false;
+}
+
+async function preview() {
+  const decisions = [...state.decisions.entries()].map(([id, d]) => ({ id, verdict: d.verdict, remarks: d.remarks }));
+  setStatus("Previewing…");
+  resetPreview();
+  try {
+    const res = await api("POST", "/verdict/review", { kind: $("kind").value }, { decisions });
+    if (res.status === 409) {
+      renderConflicts(res.message, res.data);
+      setStatus("The policy changed in Prisma Cloud, sync it and review again", true);
+    } else if (!res.ok) {
+      setStatus(res.message, true);
+    } else {
+      state.previewToken = res.data.token;
+      renderDiff(res.data);
+      setStatus("Review the diff, then push");
+    }
+  } catch (e) {
+    setStatus("Failed to preview: " + e.message, true);
+  }
+  render();
+}
+
+async function push() {
+  if (!state.previewToken || !confirm("Save " + state.decisions.size + " verdicts and push them to Prisma Cloud?")) return;
+  setStatus("Pushing…");
+  $("push").disabled = true;
+  try {
+    const res = await api("POST", "/verdict/update", { kind: $("kind").value, confirm: state.previewToken });
+    if (res.status === 409 && Array.isArray(res.data)) {
+      renderConflicts(res.message, res.data);
+      setStatus("The policy changed since the preview, preview again", true);
+      state.previewToken = "";
+      render();
+      return;
+    }
+    if (!res.ok) {
+      setStatus(res.message, true);
+      render();
+      return;
+    }
+    if (res.data.pc_push_error) {
+      // The verdicts are saved; the preview stays confirmable to retry the push
+      setStatus("Saved " + res.data.updated_count + " verdicts, push failed: " + res.data.pc_push_error, true);
+      render();
+      return;
+    }
+    await load();
+    setStatus(res.message + ", pushed " + res.data.pc_pushed_count + " to Prisma Cloud");
+  } catch (e) {
+    setStatus("Failed to push: " + e.message, true);
+    render();
+  }
+}
+
+$("load").addEventListener("click", load);
+$("kind").addEventListener("change", load);
+$("select-all").addEventListener("change", () => {
+  state.selected = new Set($("select-all").checked ? state.entries.map((entry) => entry.id) : []);
+  render();
+});
+$("approve").addEventListener("click", () => decide("legitimate"));
+$("deny").addEventListener("click", () => decide("not_legitimate"));
+$("clear").addEventListener("click", () => decide(""));
+$("preview-button").addEventListener("click", preview);
+$("push").addEventListener("click", push);
+
+if ($("token").value) load();